@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"hype/hyperuntime"
+)
+
+// collectAssets reads every file under the embed directories, keyed by the
+// name the assets module serves it under
+func collectAssets(dirs []string) (map[string][]byte, error) {
+	fsys, err := hyperuntime.DirAssets(dirs)
+	if err != nil {
+		return nil, err
+	}
+
+	assets := make(map[string][]byte)
+	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return fmt.Errorf("failed to read asset %s: %w", name, err)
+		}
+		assets[name] = data
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return assets, nil
+}
+
+// writeAssets writes collected assets below dir
+func writeAssets(dir string, assets map[string][]byte) error {
+	for name, data := range assets {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
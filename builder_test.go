@@ -1,12 +1,17 @@
 package main
 
 import (
+	"go/parser"
+	"go/token"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"testing"
+
+	"hype/hyperuntime"
 )
 
 func TestBuildExecutable(t *testing.T) {
@@ -118,6 +123,63 @@ func TestBuildExecutableInvalidScript(t *testing.T) {
 	}
 }
 
+func TestWriteRuntimeSources(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "luax-runtime-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if err := writeRuntimeSources(tempDir); err != nil {
+		t.Fatalf("writeRuntimeSources failed: %v", err)
+	}
+
+	for _, name := range []string{"go.mod", "go.sum", "hyperuntime/runtime.go", "hyperuntime/http_module.go", "pluginsdk/plugin.go"} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); err != nil {
+			t.Fatalf("Expected %s in build directory: %v", name, err)
+		}
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(tempDir, "*", "*_test.go"))
+	if len(matches) > 0 {
+		t.Fatalf("Test files should not be copied into the build directory: %v", matches)
+	}
+}
+
+func TestRuntimeMainTemplate(t *testing.T) {
+	for _, variant := range []struct{ bytecode, assets, defines bool }{{false, false, false}, {true, false, false}, {false, true, false}, {true, true, true}} {
+		tempDir, err := os.MkdirTemp("", "luax-template-test-*")
+		if err != nil {
+			t.Fatalf("Failed to create temp directory: %v", err)
+		}
+		defer os.RemoveAll(tempDir)
+
+		config := &BuildConfig{
+			BuildOptions:  BuildOptions{Bytecode: variant.bytecode},
+			ScriptContent: strconv.Quote(`print("hi")`),
+			HasAssets:     variant.assets,
+			SourceMap: &hyperuntime.SourceMap{
+				Chunk:    "main.lua",
+				Sections: []hyperuntime.SourceSection{{Start: 2, End: 4, File: "lib/util.lua", Line: 1}},
+			},
+		}
+		if variant.defines {
+			config.Info = hyperuntime.BuildInfo{
+				Version: "1.2.3",
+				Plugins: []hyperuntime.PluginInfo{{Name: "fs", Version: "1.0.0"}},
+				Defines: map[string]string{"API_URL": "https://example.com", "QUOTE": "say \"hi\"\n"},
+			}
+		}
+		if err := generateRuntimeCode(tempDir, config); err != nil {
+			t.Fatalf("generateRuntimeCode failed: %v", err)
+		}
+
+		if _, err := parser.ParseFile(token.NewFileSet(), filepath.Join(tempDir, "main.go"), nil, 0); err != nil {
+			t.Fatalf("Generated main.go (bytecode=%v, assets=%v, defines=%v) does not parse: %v", variant.bytecode, variant.assets, variant.defines, err)
+		}
+	}
+}
+
 func TestIntegrationCLI(t *testing.T) {
 	// First build the luax binary
 	cmd := exec.Command("go", "build", "-o", "luax-test", ".")
@@ -163,4 +225,40 @@ os.exit(0)
 	if _, err := os.Stat(expectedPath); os.IsNotExist(err) {
 		t.Fatalf("CLI did not create executable at %s", expectedPath)
 	}
-}
\ No newline at end of file
+}
+
+func TestIntegrationStubBuild(t *testing.T) {
+	cmd := exec.Command("go", "build", "-o", "luax-stub-test", ".")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to build luax binary: %v", err)
+	}
+	defer os.Remove("luax-stub-test")
+
+	tempDir, err := os.MkdirTemp("", "luax-stub-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	scriptPath := filepath.Join(tempDir, "stub-test.lua")
+	if err := os.WriteFile(scriptPath, []byte(`print("stub says " .. arg[1])`), 0644); err != nil {
+		t.Fatalf("Failed to write test script: %v", err)
+	}
+
+	outputPath := filepath.Join(tempDir, "stub-test-app")
+	cmd = exec.Command("./luax-stub-test", "build", scriptPath, "-o", outputPath, "--mode", "stub")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("CLI stub build failed: %v\nOutput: %s", err, output)
+	}
+
+	if runtime.GOOS == "windows" {
+		outputPath += ".exe"
+	}
+	output, err := exec.Command(outputPath, "hello").CombinedOutput()
+	if err != nil {
+		t.Fatalf("Stub executable failed: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(string(output), "stub says hello") {
+		t.Fatalf("Unexpected stub executable output: %s", output)
+	}
+}
@@ -5,12 +5,20 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"regexp"
+	"sort"
 	"strings"
+
+	"hype/hyperuntime"
 )
 
 // bundleScript bundles a Lua script with its dependencies into a single file
 func bundleScript(scriptPath, outputFile string) error {
+	return bundleScriptWithModules(scriptPath, outputFile, make(map[string]bool), nil)
+}
+
+// bundleScriptWithModules bundles a Lua script, leaving requires of the
+// available (plugin) modules to be resolved at runtime
+func bundleScriptWithModules(scriptPath, outputFile string, availableModules map[string]bool, luaPaths []string) error {
 	// Generate default output filename if not provided
 	if outputFile == "" {
 		ext := filepath.Ext(scriptPath)
@@ -18,13 +26,14 @@ func bundleScript(scriptPath, outputFile string) error {
 		outputFile = name + "-bundled.lua"
 	}
 	
-	bundledScript, err := resolveDependencies(scriptPath, make(map[string]bool))
+	bundled, err := bundleDependencies(scriptPath, make(map[string]bool), availableModules, luaPaths)
 	if err != nil {
 		return fmt.Errorf("failed to resolve dependencies: %v", err)
 	}
+	bundled.printWarnings()
 	
 	// Write bundled script to output file
-	if err := ioutil.WriteFile(outputFile, []byte(bundledScript), 0644); err != nil {
+	if err := ioutil.WriteFile(outputFile, []byte(bundled.Source), 0644); err != nil {
 		return fmt.Errorf("failed to write bundled script: %v", err)
 	}
 	
@@ -33,78 +42,274 @@ func bundleScript(scriptPath, outputFile string) error {
 }
 
 
+// bundleRequireHelper starts every bundle that has local modules. Each
+// chunk gets a local require that maps the names it uses for local modules
+// to their canonical names and leaves other names to the global require.
+const bundleRequireHelper = "local __hype_require = function(names) return function(name) return require(names[name] or name) end end\n"
+
 // resolveDependencies recursively resolves and bundles Lua dependencies
 func resolveDependencies(scriptPath string, visited map[string]bool) (string, error) {
 	return resolveDependenciesWithModules(scriptPath, visited, make(map[string]bool))
 }
 
+// resolveDependenciesWithModules bundles a script with the local modules it
+// requires and prints warnings about requires that cannot be bundled to
+// stderr. visited receives the absolute path of every file bundled.
 func resolveDependenciesWithModules(scriptPath string, visited map[string]bool, availableModules map[string]bool) (string, error) {
-	// Convert to absolute path for tracking
-	absPath, err := filepath.Abs(scriptPath)
+	bundled, err := bundleDependencies(scriptPath, visited, availableModules, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to get absolute path for %s: %v", scriptPath, err)
+		return "", err
 	}
-	
-	// Check for circular dependencies
-	if visited[absPath] {
-		return "", fmt.Errorf("circular dependency detected: %s", absPath)
+	bundled.printWarnings()
+	return bundled.Source, nil
+}
+
+// scriptBundle is a script bundled with its local modules
+type scriptBundle struct {
+	Source    string
+	SourceMap *hyperuntime.SourceMap // Maps Source lines to the bundled files
+	Warnings  []string               // Requires that could not be bundled, with file:line
+}
+
+// printWarnings prints the bundle's warnings to stderr
+func (b *scriptBundle) printWarnings() {
+	for _, warning := range b.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
+}
+
+// bundleDependencies bundles a script with the local modules it requires.
+// Each module is registered once in package.preload under its path relative
+// to the script, e.g. "./lib/util", and every require of it resolves to that
+// name, so require caches it as Lua normally would. Module sources are kept
+// line for line and the source map records where each one starts. Requires
+// whose module name is computed at runtime are reported as warnings.
+// Module names not found next to the requiring file are looked up in
+// luaPaths, package.path style templates such as "lua_modules/?.lua".
+func bundleDependencies(scriptPath string, visited map[string]bool, availableModules map[string]bool, luaPaths []string) (*scriptBundle, error) {
+	return bundleScriptDependencies(scriptPath, visited, availableModules, luaPaths, false)
+}
+
+// bundleRunDependencies bundles a script the way bundleDependencies does for
+// hype run. A module name that cannot be found is reported as a warning and
+// left to require, which may still find it through package.path or never
+// reach it, as in an optional require inside pcall.
+func bundleRunDependencies(scriptPath string, visited map[string]bool, availableModules map[string]bool, luaPaths []string) (*scriptBundle, error) {
+	return bundleScriptDependencies(scriptPath, visited, availableModules, luaPaths, true)
+}
+
+// bundleScriptDependencies implements bundleDependencies and
+// bundleRunDependencies
+func bundleScriptDependencies(scriptPath string, visited map[string]bool, availableModules map[string]bool, luaPaths []string, allowMissing bool) (*scriptBundle, error) {
+	entryPath, err := filepath.Abs(scriptPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path for %s: %v", scriptPath, err)
 	}
-	visited[absPath] = true
 	
-	// Read the script file
-	content, err := ioutil.ReadFile(scriptPath)
+	b := &bundler{
+		entryPath:        entryPath,
+		rootDir:          filepath.Dir(entryPath),
+		visited:          visited,
+		availableModules: availableModules,
+		luaPaths:         luaPaths,
+		allowMissing:     allowMissing,
+	}
+	main, err := b.process(entryPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to read %s: %v", scriptPath, err)
+		return nil, err
+	}
+
+	entryFile := filepath.Base(entryPath)
+	result := &scriptBundle{
+		SourceMap: &hyperuntime.SourceMap{Chunk: entryFile},
+		Warnings:  b.warnings,
+	}
+
+	// Scripts without local modules are left untouched
+	if len(b.modules) == 0 {
+		result.Source = main.source
+		result.SourceMap.Sections = []hyperuntime.SourceSection{
+			{Start: 1, End: countLines(main.source), File: entryFile, Line: 1},
+		}
+		return result, nil
+	}
+
+	var bundled strings.Builder
+	line := 1
+	write := func(text string) {
+		bundled.WriteString(text)
+		line += strings.Count(text, "\n")
+	}
+	addSection := func(file, source string) {
+		result.SourceMap.Sections = append(result.SourceMap.Sections, hyperuntime.SourceSection{
+			Start: line,
+			End:   line + countLines(source) - 1,
+			File:  file,
+			Line:  1,
+		})
+	}
+
+	write(bundleRequireHelper)
+	for _, module := range b.modules {
+		source := strings.TrimSuffix(module.source, "\n")
+		write(fmt.Sprintf("package.preload[%s] = function(...)%s\n", luaQuote(module.name), module.localRequire()))
+		addSection(b.displayName(module.path), source)
+		write(source + "\nend\n")
+	}
+	write(strings.TrimPrefix(main.localRequire(), " ") + "\n")
+	addSection(entryFile, main.source)
+	write(main.source)
+
+	result.Source = bundled.String()
+	return result, nil
+}
+
+// countLines returns the number of lines Lua sees in source
+func countLines(source string) int {
+	return strings.Count(source, "\n") + 1
+}
+
+// bundler collects the modules required by an entry script
+type bundler struct {
+	entryPath        string
+	rootDir          string
+	visited          map[string]bool
+	availableModules map[string]bool
+	luaPaths         []string
+	allowMissing     bool // Warn about module names that are not found instead of failing
+	modules          []*bundledModule
+	warnings         []string
+}
+
+// bundledModule is a module registered in package.preload
+type bundledModule struct {
+	name     string            // Canonical name, e.g. "./lib/util"
+	path     string            // Absolute path
+	source   string            // Source as written
+	requires map[string]string // Names used for local modules -> canonical names
+}
+
+// localRequire returns the statement that gives the module's chunk its
+// require, or nothing when it requires no local modules
+func (m *bundledModule) localRequire() string {
+	if len(m.requires) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(m.requires))
+	for name := range m.requires {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var entries []string
+	for _, name := range names {
+		entries = append(entries, fmt.Sprintf("[%s] = %s", luaQuote(name), luaQuote(m.requires[name])))
 	}
+	return " local require = __hype_require({" + strings.Join(entries, ", ") + "})"
+}
+
+// process reads a file and bundles the modules it requires
+func (b *bundler) process(absPath string) (*bundledModule, error) {
+	b.visited[absPath] = true
 	
-	scriptContent := string(content)
-	scriptDir := filepath.Dir(scriptPath)
+	content, err := ioutil.ReadFile(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", b.displayName(absPath), err)
+	}
 	
-	// Find all require statements
-	requirePattern := regexp.MustCompile(`require\s*\(\s*['"]([^'"]+)['"]\s*\)`)
-	matches := requirePattern.FindAllStringSubmatch(scriptContent, -1)
+	module := &bundledModule{
+		name:     b.canonicalName(absPath),
+		path:     absPath,
+		source:   string(content),
+		requires: make(map[string]string),
+	}
+
+	calls, err := findRequires(module.source, displayPath(absPath))
+	if err != nil {
+		return nil, err
+	}
 	
-	// Process each require statement
-	for _, match := range matches {
-		if len(match) < 2 {
+	scriptDir := filepath.Dir(absPath)
+	for _, call := range calls {
+		if call.Dynamic {
+			b.warnings = append(b.warnings, fmt.Sprintf("%s:%d: require with a computed module name cannot be bundled; the module must be available at runtime", displayPath(absPath), call.Line))
 			continue
 		}
 		
-		moduleName := match[1]
-		
-		// Skip built-in modules and plugin modules
-		if isBuiltinModule(moduleName) || availableModules[moduleName] {
+		// Skip built-in modules and plugin modules, including the modules
+		// in a plugin's namespace such as bubbletea.lib.style
+		namespace, _, _ := strings.Cut(call.Name, ".")
+		if isBuiltinModule(call.Name) || b.availableModules[call.Name] || b.availableModules[namespace] {
 			continue
 		}
 		
-		// Resolve module path
-		modulePath, err := resolveModulePath(moduleName, scriptDir)
+		modulePath, err := resolveModulePath(call.Name, scriptDir, b.luaPaths)
+		if err != nil && b.allowMissing && !isPathRequire(call.Name) {
+			b.warnings = append(b.warnings, fmt.Sprintf("%s:%d: module %s not found; it must be available to require at runtime", displayPath(absPath), call.Line, call.Name))
+			continue
+		}
 		if err != nil {
-			return "", fmt.Errorf("failed to resolve module %s: %v", moduleName, err)
+			return nil, fmt.Errorf("%s:%d: failed to resolve module %s: %v", displayPath(absPath), call.Line, call.Name, err)
 		}
-		
-		// Recursively resolve dependencies
-		moduleContent, err := resolveDependenciesWithModules(modulePath, visited, availableModules)
+		modulePath, err = filepath.Abs(modulePath)
 		if err != nil {
-			return "", fmt.Errorf("failed to resolve dependencies for %s: %v", modulePath, err)
+			return nil, err
+		}
+		if modulePath == b.entryPath {
+			return nil, fmt.Errorf("%s:%d: requires the entry script %s; move the shared code into its own module", displayPath(absPath), call.Line, b.displayName(modulePath))
 		}
 		
-		// Replace require statement with module content
-		requireStatement := match[0]
-		
-		// Wrap module content in an immediately invoked function expression
-		// This ensures the module is properly loaded and returned
-		wrappedContent := fmt.Sprintf("(function()\n%s\nend)()", moduleContent)
-		
-		scriptContent = strings.Replace(scriptContent, requireStatement, wrappedContent, 1)
+		module.requires[call.Name] = b.canonicalName(modulePath)
+
+		// A module already visited is registered already, or is being
+		// processed further up a require cycle; either way it is not added twice
+		if !b.visited[modulePath] {
+			required, err := b.process(modulePath)
+			if err != nil {
+				return nil, err
+			}
+			b.modules = append(b.modules, required)
+		}
 	}
 	
-	return scriptContent, nil
+	return module, nil
+}
+
+// canonicalName names a module by its path relative to the entry script's
+// directory, without the .lua extension
+func (b *bundler) canonicalName(absPath string) string {
+	rel, err := filepath.Rel(b.rootDir, absPath)
+	if err != nil {
+		rel = absPath
+	}
+	rel = filepath.ToSlash(strings.TrimSuffix(rel, ".lua"))
+	if !strings.HasPrefix(rel, "../") && !strings.HasPrefix(rel, "/") {
+		rel = "./" + rel
+	}
+	return rel
+}
+
+// displayName shortens a path for error messages
+func (b *bundler) displayName(absPath string) string {
+	if rel, err := filepath.Rel(b.rootDir, absPath); err == nil {
+		return rel
+	}
+	return absPath
+}
+
+// luaQuote returns s as a double-quoted Lua string literal
+func luaQuote(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+	return `"` + replacer.Replace(s) + `"`
 }
 
 // isBuiltinModule checks if a module is a built-in Hype module
 func isBuiltinModule(moduleName string) bool {
-	builtins := []string{"http", "kv", "tui", "crypto", "httpsig", "websocket"}
+	builtins := []string{
+		"http", "kv", "tui", "crypto", "httpsig", "websocket", "assets", "hype",
+		// Standard libraries the runtime preloads
+		"_G", "package", "coroutine", "table", "io", "os", "string", "math", "debug",
+	}
 	for _, builtin := range builtins {
 		if moduleName == builtin {
 			return true
@@ -113,8 +318,16 @@ func isBuiltinModule(moduleName string) bool {
 	return false
 }
 
-// resolveModulePath resolves a module name to a file path
-func resolveModulePath(moduleName, scriptDir string) (string, error) {
+// isPathRequire reports whether a module name is a relative or absolute
+// path rather than a name searched for like package.path
+func isPathRequire(moduleName string) bool {
+	return strings.HasPrefix(moduleName, "./") || strings.HasPrefix(moduleName, "../") || filepath.IsAbs(moduleName)
+}
+
+// resolveModulePath resolves a module name to a file path. Module names are
+// searched for next to the script, in the working directory and then in
+// luaPaths, where ? is replaced by the name with dots as separators.
+func resolveModulePath(moduleName, scriptDir string, luaPaths []string) (string, error) {
 	// Handle relative paths
 	if strings.HasPrefix(moduleName, "./") || strings.HasPrefix(moduleName, "../") {
 		path := filepath.Join(scriptDir, moduleName)
@@ -139,10 +352,16 @@ func resolveModulePath(moduleName, scriptDir string) (string, error) {
 		return "", fmt.Errorf("module file not found: %s", path)
 	}
 	
-	// Handle module names (search in script directory)
+	// Handle module names (search in script directory, then in the working
+	// directory like the runtime's ./?.lua package path)
 	searchPaths := []string{
 		filepath.Join(scriptDir, moduleName+".lua"),
 		filepath.Join(scriptDir, moduleName, "init.lua"),
+		moduleName + ".lua",
+		filepath.Join(moduleName, "init.lua"),
+	}
+	for _, template := range luaPaths {
+		searchPaths = append(searchPaths, strings.ReplaceAll(template, "?", filepath.FromSlash(strings.ReplaceAll(moduleName, ".", "/"))))
 	}
 	
 	for _, path := range searchPaths {
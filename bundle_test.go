@@ -0,0 +1,234 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"hype/hyperuntime"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// writeLuaFiles writes files relative to dir
+func writeLuaFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestResolveDependenciesDiamond(t *testing.T) {
+	dir := t.TempDir()
+	writeLuaFiles(t, dir, map[string]string{
+		"main.lua": `
+local a = require("./a")
+local b = require('b')
+local util = require("./lib/util")
+result = a.name .. "," .. b.name .. "," .. util.loads .. "," .. tostring(a.util == b.util)
+`,
+		"a.lua": `
+local util = require("./lib/util")
+return {name = "a", util = util}
+`,
+		"b.lua": `
+local util = require("lib/util")
+return {name = "b", util = util}
+`,
+		"lib/util.lua": `
+local count = (count_loads or 0) + 1
+count_loads = count
+return {loads = count}
+`,
+	})
+
+	visited := make(map[string]bool)
+	bundled, err := resolveDependenciesWithModules(filepath.Join(dir, "main.lua"), visited, map[string]bool{})
+	if err != nil {
+		t.Fatalf("Diamond dependency was rejected: %v", err)
+	}
+	if len(visited) != 4 {
+		t.Errorf("Expected 4 visited files, got %v", visited)
+	}
+	if n := strings.Count(bundled, `package.preload["./lib/util"]`); n != 1 {
+		t.Fatalf("Expected lib/util to be bundled once, found %d times:\n%s", n, bundled)
+	}
+
+	L := lua.NewState()
+	defer L.Close()
+	if err := L.DoString(bundled); err != nil {
+		t.Fatalf("Bundled script failed: %v\n%s", err, bundled)
+	}
+	if got := L.GetGlobal("result").String(); got != "a,b,1,true" {
+		t.Errorf("result = %q, want a,b,1,true (module loaded once and shared)", got)
+	}
+}
+
+func TestResolveDependenciesCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeLuaFiles(t, dir, map[string]string{
+		"main.lua": `result = require("./ping").run(3)`,
+		// Requires inside functions make a cycle that Lua resolves lazily
+		"ping.lua": `
+local M = {}
+function M.run(n) if n == 0 then return "ping" end return require("./pong").run(n - 1) end
+return M
+`,
+		"pong.lua": `
+local M = {}
+function M.run(n) if n == 0 then return "pong" end return require("./ping").run(n - 1) end
+return M
+`,
+	})
+
+	bundled, err := resolveDependenciesWithModules(filepath.Join(dir, "main.lua"), make(map[string]bool), map[string]bool{})
+	if err != nil {
+		t.Fatalf("resolveDependencies failed: %v", err)
+	}
+
+	L := lua.NewState()
+	defer L.Close()
+	if err := L.DoString(bundled); err != nil {
+		t.Fatalf("Bundled script failed: %v\n%s", err, bundled)
+	}
+	if got := L.GetGlobal("result").String(); got != "pong" {
+		t.Errorf("result = %q, want pong", got)
+	}
+}
+
+func TestResolveDependenciesErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeLuaFiles(t, dir, map[string]string{
+		"plain.lua":   `local http = require("http"); local fs = require("fs"); print("hi")`,
+		"missing.lua": `require("./nowhere")`,
+		"loop.lua":    `require("./back")`,
+		"back.lua":    `require("./loop")`,
+	})
+
+	// Built-in and plugin modules are left to the runtime
+	source := `local http = require("http"); local fs = require("fs"); print("hi")`
+	bundled, err := resolveDependenciesWithModules(filepath.Join(dir, "plain.lua"), make(map[string]bool), map[string]bool{"fs": true})
+	if err != nil {
+		t.Fatalf("resolveDependencies failed: %v", err)
+	}
+	if bundled != source {
+		t.Errorf("Expected a script without local modules to be unchanged, got:\n%s", bundled)
+	}
+
+	if _, err := resolveDependenciesWithModules(filepath.Join(dir, "missing.lua"), make(map[string]bool), map[string]bool{}); err == nil || !strings.Contains(err.Error(), "nowhere") {
+		t.Errorf("Expected a missing module error, got %v", err)
+	}
+	if _, err := resolveDependenciesWithModules(filepath.Join(dir, "loop.lua"), make(map[string]bool), map[string]bool{}); err == nil || !strings.Contains(err.Error(), "entry script") {
+		t.Errorf("Expected an error for a module requiring the entry script, got %v", err)
+	}
+}
+
+func TestResolveDependenciesRequireForms(t *testing.T) {
+	dir := t.TempDir()
+	writeLuaFiles(t, dir, map[string]string{
+		"main.lua": `-- require("./commented") is not a dependency
+local config = require "./config"
+local a = require './lib/a'
+local name = "./config"
+local dynamic = require(name)
+result = config.name .. "," .. a.config.name .. "," .. tostring(dynamic == config)
+`,
+		"config.lua": `return {name = "root"}`,
+		// ./config means lib/config.lua here, not the root config
+		"lib/a.lua":      `return {config = require("./config")}`,
+		"lib/config.lua": `return {name = "lib"}`,
+	})
+
+	result, err := bundleDependencies(filepath.Join(dir, "main.lua"), make(map[string]bool), map[string]bool{}, nil)
+	if err != nil {
+		t.Fatalf("bundleDependencies failed: %v", err)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "main.lua:5:") {
+		t.Errorf("Expected one warning for main.lua:5, got %v", result.Warnings)
+	}
+	bundled := result.Source
+	for _, name := range []string{"./config", "./lib/a", "./lib/config"} {
+		if !strings.Contains(bundled, "package.preload[\""+name+"\"]") {
+			t.Errorf("Expected %s to be bundled:\n%s", name, bundled)
+		}
+	}
+
+	L := lua.NewState()
+	defer L.Close()
+	if err := L.DoString(bundled); err != nil {
+		t.Fatalf("Bundled script failed: %v\n%s", err, bundled)
+	}
+	// The dynamic require is not rewritten, so it finds the module by the
+	// canonical name it happens to use
+	if got := L.GetGlobal("result").String(); got != "root,lib,true" {
+		t.Errorf("result = %q, want root,lib,true", got)
+	}
+}
+
+func TestBundleSourceMap(t *testing.T) {
+	dir := t.TempDir()
+	writeLuaFiles(t, dir, map[string]string{
+		"main.lua": `local util = require("./lib/util")
+local other = require("./lib/other")
+
+util.explode()
+`,
+		"lib/util.lua": `local M = {}
+
+function M.explode()
+  error("boom")
+end
+
+return M
+`,
+		"lib/other.lua": `return {}`,
+	})
+
+	result, err := bundleDependencies(filepath.Join(dir, "main.lua"), make(map[string]bool), map[string]bool{}, nil)
+	if err != nil {
+		t.Fatalf("bundleDependencies failed: %v", err)
+	}
+	if result.SourceMap.Chunk != "main.lua" {
+		t.Errorf("Chunk = %q, want main.lua", result.SourceMap.Chunk)
+	}
+
+	// Every mapped line holds the original line it maps to
+	lines := strings.Split(result.Source, "\n")
+	for _, section := range result.SourceMap.Sections {
+		content, err := os.ReadFile(filepath.Join(dir, section.File))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", section.File, err)
+		}
+		original := strings.Split(string(content), "\n")
+		for line := section.Start; line <= section.End; line++ {
+			file, originalLine, ok := result.SourceMap.Lookup(line)
+			if !ok || file != section.File {
+				t.Fatalf("Lookup(%d) = %s, %v", line, file, ok)
+			}
+			if lines[line-1] != original[originalLine-1] {
+				t.Errorf("Chunk line %d is %q, but maps to %s:%d %q", line, lines[line-1], file, originalLine, original[originalLine-1])
+			}
+		}
+	}
+
+	L := lua.NewState()
+	defer L.Close()
+	err = hyperuntime.DoSource(L, result.Source, result.SourceMap.Chunk)
+	if err == nil {
+		t.Fatalf("Expected the bundled script to fail")
+	}
+	message := result.SourceMap.RewriteError(err).Error()
+	if !strings.HasPrefix(message, filepath.Join("lib", "util.lua")+":4: boom") {
+		t.Errorf("Error not mapped to lib/util.lua:4:\n%s", message)
+	}
+	if !strings.Contains(message, "main.lua:4:") {
+		t.Errorf("Traceback not mapped to main.lua:4:\n%s", message)
+	}
+}
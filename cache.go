@@ -0,0 +1,354 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// The build cache keeps, per cache key, a prepared module directory holding
+// the runtime sources, Go plugin sources and a tidied go.mod, plus a Go build
+// cache of compiled packages shared by all keys:
+//
+//	<cache>/modules/<key>/   prepared module, copied into each build
+//	<cache>/go-build/        GOCACHE for cached builds
+//	<cache>/sdk/<hash>/      hype/pluginsdk module Go plugins build against
+//
+// Keys hash everything that goes into the prepared module, so entries never
+// need invalidating; `hype cache clean` reclaims the space. The plugin cache
+// (see plugin_cache.go) lives under the same root and is only removed by
+// `hype cache clean --plugins`.
+const (
+	buildCacheEnv       = "HYPE_CACHE_DIR"
+	buildCacheModules   = "modules"
+	buildCacheGoBuild   = "go-build"
+	buildCacheEntryFile = "hype-cache.json"
+)
+
+// BuildCacheEntry describes a prepared module in the build cache
+type BuildCacheEntry struct {
+	Key         string    `json:"key"`
+	HypeVersion string    `json:"hype_version"`
+	GoVersion   string    `json:"go_version"`
+	Target      string    `json:"target"`
+	Plugins     []string  `json:"plugins"`
+	Created     time.Time `json:"created"`
+	LastUsed    time.Time `json:"-"` // Modification time of the entry file
+	Size        int64     `json:"-"`
+}
+
+var (
+	goVersionOnce sync.Once
+	goVersion     string
+	goVersionErr  error
+)
+
+// localGoVersion returns the version of the go command builds use
+func localGoVersion() (string, error) {
+	goVersionOnce.Do(func() {
+		output, err := exec.Command("go", "env", "GOVERSION").Output()
+		if err != nil {
+			goVersionErr = fmt.Errorf("failed to get Go version: %w", err)
+			return
+		}
+		goVersion = strings.TrimSpace(string(output))
+	})
+	return goVersion, goVersionErr
+}
+
+// buildCacheDir returns the build cache location: $HYPE_CACHE_DIR, or hype
+// under the user cache directory
+func buildCacheDir() (string, error) {
+	if dir := os.Getenv(buildCacheEnv); dir != "" {
+		return filepath.Abs(dir)
+	}
+	userCache, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user cache directory: %w", err)
+	}
+	return filepath.Join(userCache, "hype"), nil
+}
+
+// buildCacheKey hashes the hype version, Go version, target, embedded
+// runtime sources and plugin set of a build
+func buildCacheKey(config *BuildConfig, target BuildTarget, goVersion string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "hype %s\ngo %s\ntarget %s\n", version, goVersion, target)
+
+	err := fs.WalkDir(runtimeSources, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := runtimeSources.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "runtime %s %x\n", name, sha256.Sum256(data))
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to hash runtime sources: %w", err)
+	}
+
+	for _, plugin := range cachePluginNames(config) {
+		fmt.Fprintf(h, "plugin %s\n", plugin)
+	}
+	for _, plugin := range config.GoPlugins {
+		hash, err := hashModuleDir(plugin.Dir)
+		if err != nil {
+			return "", fmt.Errorf("failed to hash plugin %s: %w", plugin.Name, err)
+		}
+		fmt.Fprintf(h, "source %s %s %s\n", plugin.Package, plugin.ModulePath, hash)
+	}
+	deps := append([]string(nil), config.PluginDependencies...)
+	sort.Strings(deps)
+	for _, dep := range deps {
+		fmt.Fprintf(h, "dependency %s\n", dep)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// cachePluginNames returns the build's plugins as sorted name@version strings
+func cachePluginNames(config *BuildConfig) []string {
+	var names []string
+	if config.PluginRegistry != nil {
+		for _, plugin := range config.PluginRegistry.plugins {
+			names = append(names, plugin.Name()+"@"+plugin.Version())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// prepareCachedModule returns the prepared module directory for a build,
+// creating it on first use
+func prepareCachedModule(cacheDir string, config *BuildConfig, target BuildTarget) (string, error) {
+	goVersion, err := localGoVersion()
+	if err != nil {
+		return "", err
+	}
+	key, err := buildCacheKey(config, target, goVersion)
+	if err != nil {
+		return "", err
+	}
+
+	modulesDir := filepath.Join(cacheDir, buildCacheModules)
+	moduleDir := filepath.Join(modulesDir, key)
+	entryFile := filepath.Join(moduleDir, buildCacheEntryFile)
+	if _, err := os.Stat(entryFile); err == nil {
+		now := time.Now()
+		os.Chtimes(entryFile, now, now)
+		return moduleDir, nil
+	}
+
+	// Prepare next to the final location and rename, so concurrent builds
+	// never see a half-written module
+	if err := os.MkdirAll(modulesDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create build cache: %w", err)
+	}
+	tempDir, err := os.MkdirTemp(modulesDir, ".tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create build cache entry: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if err := writeRuntimeSources(tempDir); err != nil {
+		return "", err
+	}
+	if err := writeGoPlugins(tempDir, config.GoPlugins); err != nil {
+		return "", err
+	}
+	if len(config.GoPlugins) > 0 || len(config.PluginDependencies) > 0 {
+		// Only main.go imports the plugins, so it is written for tidy to
+		// keep their requirements and removed again; each build writes its own
+		if err := writeRuntimeMain(tempDir, config); err != nil {
+			return "", fmt.Errorf("failed to generate runtime code: %w", err)
+		}
+		if err := tidyModule(tempDir); err != nil {
+			return "", err
+		}
+		if err := os.Remove(filepath.Join(tempDir, "main.go")); err != nil {
+			return "", err
+		}
+	}
+
+	entry := BuildCacheEntry{
+		Key:         key,
+		HypeVersion: version,
+		GoVersion:   goVersion,
+		Target:      target.String(),
+		Plugins:     cachePluginNames(config),
+		Created:     time.Now(),
+	}
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, buildCacheEntryFile), data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write build cache entry: %w", err)
+	}
+
+	if err := os.Rename(tempDir, moduleDir); err != nil {
+		// Another build prepared the same key first
+		if _, statErr := os.Stat(entryFile); statErr != nil {
+			return "", fmt.Errorf("failed to store build cache entry: %w", err)
+		}
+	}
+
+	return moduleDir, nil
+}
+
+// copyModuleDir copies a prepared module, without its cache entry file, into
+// a build directory
+func copyModuleDir(moduleDir, buildDir string) error {
+	return filepath.WalkDir(moduleDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(moduleDir, path)
+		if err != nil {
+			return err
+		}
+		if rel == buildCacheEntryFile {
+			return nil
+		}
+
+		target := filepath.Join(buildDir, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		dst, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(dst, src); err != nil {
+			dst.Close()
+			return err
+		}
+		return dst.Close()
+	})
+}
+
+// listBuildCache returns the prepared modules in the build cache, most
+// recently used first
+func listBuildCache(cacheDir string) ([]BuildCacheEntry, error) {
+	dirs, err := os.ReadDir(filepath.Join(cacheDir, buildCacheModules))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []BuildCacheEntry
+	for _, dir := range dirs {
+		moduleDir := filepath.Join(cacheDir, buildCacheModules, dir.Name())
+		entryFile := filepath.Join(moduleDir, buildCacheEntryFile)
+
+		data, err := os.ReadFile(entryFile)
+		if err != nil {
+			continue
+		}
+		var entry BuildCacheEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			continue
+		}
+		if info, err := os.Stat(entryFile); err == nil {
+			entry.LastUsed = info.ModTime()
+		}
+		entry.Size = dirSize(moduleDir)
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].LastUsed.After(entries[j].LastUsed) })
+	return entries, nil
+}
+
+// printBuildCacheInfo prints the cache location, sizes and entries
+func printBuildCacheInfo(w io.Writer, cacheDir string) error {
+	entries, err := listBuildCache(cacheDir)
+	if err != nil {
+		return fmt.Errorf("failed to read build cache: %w", err)
+	}
+
+	var modulesSize int64
+	for _, entry := range entries {
+		modulesSize += entry.Size
+	}
+
+	fmt.Fprintf(w, "Build cache: %s\n", cacheDir)
+	fmt.Fprintf(w, "Modules:     %d (%s)\n", len(entries), formatSize(modulesSize))
+	fmt.Fprintf(w, "Compiled:    %s\n", formatSize(dirSize(filepath.Join(cacheDir, buildCacheGoBuild))))
+	fmt.Fprintf(w, "Plugins:     %s\n", formatSize(dirSize(filepath.Join(cacheDir, pluginCacheDir))))
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tTARGET\tHYPE\tGO\tPLUGINS\tLAST USED")
+	for _, entry := range entries {
+		plugins := "-"
+		if len(entry.Plugins) > 0 {
+			plugins = strings.Join(entry.Plugins, ",")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.Key[:12], entry.Target, entry.HypeVersion, entry.GoVersion, plugins, entry.LastUsed.Format("2006-01-02 15:04"))
+	}
+	return tw.Flush()
+}
+
+// cleanBuildCache removes the prepared modules, compiled packages and plugin
+// SDK modules of the build cache, and the plugin cache when plugins is set,
+// and returns the space freed. Nothing else under cacheDir is touched.
+func cleanBuildCache(cacheDir string, plugins bool) (int64, error) {
+	dirs := []string{buildCacheModules, buildCacheGoBuild, buildCacheSDK}
+	if plugins {
+		dirs = append(dirs, pluginCacheDir)
+	}
+
+	var freed int64
+	for _, dir := range dirs {
+		path := filepath.Join(cacheDir, dir)
+		size := dirSize(path)
+		if err := os.RemoveAll(path); err != nil {
+			return freed, fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+		freed += size
+	}
+	return freed, nil
+}
+
+// dirSize returns the total size of the files under dir
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
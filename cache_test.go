@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"hype/hyperuntime"
+)
+
+func TestBuildCacheKey(t *testing.T) {
+	linux := BuildTarget{GOOS: "linux", GOARCH: "amd64"}
+	config := &BuildConfig{}
+
+	key, err := buildCacheKey(config, linux, "go1.24.3")
+	if err != nil {
+		t.Fatalf("buildCacheKey failed: %v", err)
+	}
+	again, err := buildCacheKey(&BuildConfig{}, linux, "go1.24.3")
+	if err != nil {
+		t.Fatalf("buildCacheKey failed: %v", err)
+	}
+	if key != again {
+		t.Fatalf("Expected a stable key, got %s and %s", key, again)
+	}
+
+	// The script, assets and options embedded into main.go are not part of
+	// the prepared module
+	scripted := &BuildConfig{BundledScript: `print("hi")`, BuildOptions: BuildOptions{Bytecode: true}}
+	if other, _ := buildCacheKey(scripted, linux, "go1.24.3"); other != key {
+		t.Fatalf("Expected the script not to change the key")
+	}
+
+	pluginDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(pluginDir, "plugin.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("Failed to write plugin source: %v", err)
+	}
+	pluginConfig := &BuildConfig{GoPlugins: []GoPluginPackage{{Name: "greet", Dir: pluginDir, Package: "greet"}}}
+	pluginKey, err := buildCacheKey(pluginConfig, linux, "go1.24.3")
+	if err != nil {
+		t.Fatalf("buildCacheKey failed: %v", err)
+	}
+
+	variants := map[string]func() (string, error){
+		"go version": func() (string, error) {
+			return buildCacheKey(config, linux, "go1.25.0")
+		},
+		"target": func() (string, error) {
+			return buildCacheKey(config, BuildTarget{GOOS: "linux", GOARCH: "arm64"}, "go1.24.3")
+		},
+		"plugin source": func() (string, error) {
+			return pluginKey, nil
+		},
+		"plugin dependencies": func() (string, error) {
+			return buildCacheKey(&BuildConfig{PluginDependencies: []string{"example.com/dep v1.0.0"}}, linux, "go1.24.3")
+		},
+	}
+	for name, variant := range variants {
+		other, err := variant()
+		if err != nil {
+			t.Fatalf("%s: buildCacheKey failed: %v", name, err)
+		}
+		if other == key {
+			t.Fatalf("Expected a different %s to change the key", name)
+		}
+	}
+
+	// Every file of a plugin package counts, not just its main file
+	if err := os.WriteFile(filepath.Join(pluginDir, "helpers.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("Failed to write plugin source: %v", err)
+	}
+	if other, _ := buildCacheKey(pluginConfig, linux, "go1.24.3"); other == pluginKey {
+		t.Fatalf("Expected a new plugin file to change the key")
+	}
+}
+
+func TestPrepareCachedModule(t *testing.T) {
+	cacheDir := t.TempDir()
+	target := BuildTarget{GOOS: "linux", GOARCH: "amd64"}
+
+	moduleDir, err := prepareCachedModule(cacheDir, &BuildConfig{}, target)
+	if err != nil {
+		t.Fatalf("prepareCachedModule failed: %v", err)
+	}
+	for _, name := range []string{"go.mod", "go.sum", "hyperuntime/runtime.go", buildCacheEntryFile} {
+		if _, err := os.Stat(filepath.Join(moduleDir, name)); err != nil {
+			t.Fatalf("Prepared module is missing %s: %v", name, err)
+		}
+	}
+
+	// A second build with the same key reuses the entry
+	again, err := prepareCachedModule(cacheDir, &BuildConfig{}, target)
+	if err != nil {
+		t.Fatalf("prepareCachedModule failed: %v", err)
+	}
+	if again != moduleDir {
+		t.Fatalf("Expected %s to be reused, got %s", moduleDir, again)
+	}
+
+	buildDir := t.TempDir()
+	if err := copyModuleDir(moduleDir, buildDir); err != nil {
+		t.Fatalf("copyModuleDir failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(buildDir, "hyperuntime", "runtime.go")); err != nil {
+		t.Fatalf("Build directory is missing the runtime: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(buildDir, buildCacheEntryFile)); !os.IsNotExist(err) {
+		t.Fatalf("Expected the cache entry file not to be copied")
+	}
+
+	entries, err := listBuildCache(cacheDir)
+	if err != nil {
+		t.Fatalf("listBuildCache failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Target != "linux/amd64" || entries[0].HypeVersion != version {
+		t.Fatalf("Unexpected cache entries: %+v", entries)
+	}
+}
+
+func TestPrepareCachedModuleGoPlugin(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go mod tidy")
+	}
+
+	// Nothing in the prepared module imports the plugin but main.go, which
+	// each build writes; tidy must still keep the plugin's requirement
+	dir := t.TempDir()
+	writeGoPlugin(t, dir, "greet", "module example.com/greet\n\ngo 1.21\n\nrequire github.com/yuin/gopher-lua v1.1.1\n")
+	plugin, err := newGoPluginPackage("greet", filepath.Join(dir, "greet"), map[string]bool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &BuildConfig{
+		GoPlugins:     []GoPluginPackage{plugin},
+		PluginImports: "\t" + plugin.Alias() + " \"" + plugin.ImportPath() + "\"\n",
+		SourceMap:     &hyperuntime.SourceMap{Chunk: "main.lua"},
+	}
+
+	moduleDir, err := prepareCachedModule(t.TempDir(), config, BuildTarget{GOOS: "linux", GOARCH: "amd64"})
+	if err != nil {
+		t.Fatalf("prepareCachedModule failed: %v", err)
+	}
+	goMod, err := os.ReadFile(filepath.Join(moduleDir, "go.mod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(goMod), "example.com/greet v0.0.0") {
+		t.Errorf("Prepared go.mod does not require the plugin:\n%s", goMod)
+	}
+	if _, err := os.Stat(filepath.Join(moduleDir, "main.go")); !os.IsNotExist(err) {
+		t.Errorf("Expected main.go to be left to the build")
+	}
+}
+
+func TestBuildCacheInfoAndClean(t *testing.T) {
+	cacheDir := filepath.Join(t.TempDir(), "hype")
+	t.Setenv(buildCacheEnv, cacheDir)
+
+	dir, err := buildCacheDir()
+	if err != nil {
+		t.Fatalf("buildCacheDir failed: %v", err)
+	}
+	if dir != cacheDir {
+		t.Fatalf("Expected %s from $%s, got %s", cacheDir, buildCacheEnv, dir)
+	}
+
+	// An empty or missing cache is not an error
+	var out bytes.Buffer
+	if err := printBuildCacheInfo(&out, cacheDir); err != nil {
+		t.Fatalf("printBuildCacheInfo failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Modules:     0") {
+		t.Fatalf("Unexpected info for an empty cache:\n%s", out.String())
+	}
+
+	if _, err := prepareCachedModule(cacheDir, &BuildConfig{}, BuildTarget{GOOS: "darwin", GOARCH: "arm64"}); err != nil {
+		t.Fatalf("prepareCachedModule failed: %v", err)
+	}
+
+	out.Reset()
+	if err := printBuildCacheInfo(&out, cacheDir); err != nil {
+		t.Fatalf("printBuildCacheInfo failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Modules:     1") || !strings.Contains(out.String(), "darwin/arm64") {
+		t.Fatalf("Unexpected cache info:\n%s", out.String())
+	}
+
+	// Clean removes build entries only; fetched plugins and anything else
+	// under the cache root stay unless asked for
+	pluginFile := filepath.Join(cacheDir, pluginCacheDir, "keep")
+	otherFile := filepath.Join(cacheDir, "other", "keep")
+	for _, file := range []string{pluginFile, otherFile} {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte("keep"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	freed, err := cleanBuildCache(cacheDir, false)
+	if err != nil {
+		t.Fatalf("cleanBuildCache failed: %v", err)
+	}
+	if freed == 0 {
+		t.Fatalf("Expected clean to report the space freed")
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, buildCacheModules)); !os.IsNotExist(err) {
+		t.Fatalf("Expected the prepared modules to be removed")
+	}
+	if _, err := os.Stat(pluginFile); err != nil {
+		t.Fatalf("Expected the plugin cache to be kept: %v", err)
+	}
+
+	if _, err := cleanBuildCache(cacheDir, true); err != nil {
+		t.Fatalf("cleanBuildCache failed: %v", err)
+	}
+	if _, err := os.Stat(pluginFile); !os.IsNotExist(err) {
+		t.Fatalf("Expected the plugin cache to be removed")
+	}
+	if _, err := os.Stat(otherFile); err != nil {
+		t.Fatalf("Expected files outside the caches to be kept: %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunAssetsMirrorBuild(t *testing.T) {
+	dir := t.TempDir()
+	writeLuaFiles(t, dir, map[string]string{
+		"secret.txt":        "not an asset",
+		"public/index.html": "<h1>hi</h1>",
+		"empty.lua":         `assert(#require("assets").list() == 0, "working directory served as assets")`,
+		"embedded.lua":      `assert(require("assets").read("public/index.html") == "<h1>hi</h1>")`,
+	})
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	// Without embedded directories nothing is served, as in a build
+	// without --embed
+	if err := runScriptWithOptions(filepath.Join(dir, "empty.lua"), nil, nil, RunOptions{}); err != nil {
+		t.Errorf("Run without --embed failed: %v", err)
+	}
+	options := RunOptions{EmbedDirs: []string{filepath.Join(dir, "public")}}
+	if err := runScriptWithOptions(filepath.Join(dir, "embedded.lua"), nil, nil, options); err != nil {
+		t.Errorf("Run with --embed failed: %v", err)
+	}
+}
+
+func TestRunUnresolvedRequires(t *testing.T) {
+	dir := t.TempDir()
+	writeLuaFiles(t, dir, map[string]string{
+		"optional.lua": `local ok = pcall(function() return require("not_installed") end)
+if not ok then result = "fallback" end
+if false then require("never_loaded") end
+assert(result == "fallback")`,
+		"missing.lua": `require("./nowhere")`,
+	})
+
+	// Module names the bundler cannot find are left to require
+	if err := runScriptWithOptions(filepath.Join(dir, "optional.lua"), nil, nil, RunOptions{}); err != nil {
+		t.Errorf("Run with optional requires failed: %v", err)
+	}
+	// Relative paths name a file, which has to exist
+	if err := runScriptWithOptions(filepath.Join(dir, "missing.lua"), nil, nil, RunOptions{}); err == nil || !strings.Contains(err.Error(), "nowhere") {
+		t.Errorf("Expected a missing module error, got %v", err)
+	}
+}
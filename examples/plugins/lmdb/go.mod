@@ -5,4 +5,5 @@ go 1.21
 require (
 	github.com/bmatsuo/lmdb-go v1.8.0
 	github.com/yuin/gopher-lua v1.1.1
+	hype v0.0.0
 )
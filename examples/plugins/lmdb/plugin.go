@@ -4,61 +4,23 @@ import (
 	"fmt"
 	"os"
 
+	"hype/pluginsdk"
+
 	"github.com/bmatsuo/lmdb-go/lmdb"
 	"github.com/yuin/gopher-lua"
 )
 
-// HypePlugin interface (required for plugin implementation)
-type HypePlugin interface {
-	Name() string
-	Version() string
-	Description() string
-	Register(L *lua.LState) error
-	Dependencies() []string
-	Close() error
-}
-
-// LMDBPlugin implements the HypePlugin interface for LMDB database operations
-type LMDBPlugin struct {
-	name        string
-	version     string
-	description string
-}
+// LMDBPlugin implements pluginsdk.Plugin for LMDB database operations
+type LMDBPlugin struct{}
 
 // NewPlugin creates a new LMDB plugin instance
-func NewPlugin() interface{} {
-	return &LMDBPlugin{
-		name:        "lmdb",
-		version:     "1.0.0",
-		description: "LMDB database plugin for high-performance key-value storage",
-	}
-}
-
-// Name returns the plugin name
-func (p *LMDBPlugin) Name() string {
-	return p.name
-}
-
-// Version returns the plugin version
-func (p *LMDBPlugin) Version() string {
-	return p.version
-}
-
-// Description returns the plugin description
-func (p *LMDBPlugin) Description() string {
-	return p.description
-}
-
-// Dependencies returns the Go dependencies needed for this plugin
-func (p *LMDBPlugin) Dependencies() []string {
-	return []string{
-		"github.com/bmatsuo/lmdb-go/lmdb",
-	}
+func NewPlugin() pluginsdk.Plugin {
+	return &LMDBPlugin{}
 }
 
-// Close cleans up plugin resources
-func (p *LMDBPlugin) Close() error {
-	return nil
+// APIVersion returns the plugin API version the plugin was written for
+func (p *LMDBPlugin) APIVersion() int {
+	return 1
 }
 
 // Register registers the LMDB module with the Lua state
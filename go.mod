@@ -6,15 +6,16 @@ toolchain go1.24.3
 
 require (
 	github.com/gdamore/tcell/v2 v2.8.1
+	github.com/gorilla/websocket v1.5.3
 	github.com/rivo/tview v0.0.0-20250501113434-0c592cd31026
 	github.com/spf13/cobra v1.8.1
 	github.com/yuin/gopher-lua v1.1.1
 	go.etcd.io/bbolt v1.4.1
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
 	github.com/gdamore/encoding v1.0.1 // indirect
-	github.com/gorilla/websocket v1.5.3 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
 	github.com/mattn/go-runewidth v0.0.16 // indirect
@@ -23,5 +24,4 @@ require (
 	golang.org/x/sys v0.29.0 // indirect
 	golang.org/x/term v0.28.0 // indirect
 	golang.org/x/text v0.21.0 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
@@ -0,0 +1,216 @@
+// assets.go - Assets module implementation for Hype
+package hyperuntime
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// RegisterAssetsModule registers the assets module backed by fsys. Built
+// executables pass their embedded files; `hype run` passes the same
+// directories on disk. A nil fsys gives an empty module.
+func RegisterAssetsModule(L *lua.LState, fsys fs.FS) {
+	L.PreloadModule("assets", func(L *lua.LState) int {
+		assetsModule := L.NewTable()
+
+		L.SetField(assetsModule, "read", L.NewFunction(func(L *lua.LState) int {
+			name, err := cleanAssetPath(L.CheckString(1))
+			if err == nil && fsys == nil {
+				err = fmt.Errorf("asset not found: %s", name)
+			}
+			if err != nil {
+				L.Push(lua.LNil)
+				L.Push(lua.LString(err.Error()))
+				return 2
+			}
+
+			data, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				L.Push(lua.LNil)
+				L.Push(lua.LString(fmt.Sprintf("asset not found: %s", name)))
+				return 2
+			}
+
+			L.Push(lua.LString(string(data)))
+			return 1
+		}))
+
+		L.SetField(assetsModule, "exists", L.NewFunction(func(L *lua.LState) int {
+			name, err := cleanAssetPath(L.CheckString(1))
+			if err != nil || fsys == nil {
+				L.Push(lua.LFalse)
+				return 1
+			}
+
+			info, err := fs.Stat(fsys, name)
+			L.Push(lua.LBool(err == nil && !info.IsDir()))
+			return 1
+		}))
+
+		L.SetField(assetsModule, "list", L.NewFunction(func(L *lua.LState) int {
+			result := L.NewTable()
+			dir, err := cleanAssetPath(L.OptString(1, "."))
+			if err != nil || fsys == nil {
+				L.Push(result)
+				return 1
+			}
+
+			var names []string
+			fs.WalkDir(fsys, dir, func(name string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return nil
+				}
+				if !d.IsDir() {
+					names = append(names, name)
+				}
+				return nil
+			})
+
+			sort.Strings(names)
+			for _, name := range names {
+				result.Append(lua.LString(name))
+			}
+
+			L.Push(result)
+			return 1
+		}))
+
+		L.Push(assetsModule)
+		return 1
+	})
+}
+
+// cleanAssetPath normalizes a script-supplied asset path such as
+// "./public/index.html" or "/public/index.html" to "public/index.html"
+func cleanAssetPath(name string) (string, error) {
+	name = path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+	name = strings.TrimPrefix(name, "/")
+	if name == "" {
+		name = "."
+	}
+	if !fs.ValidPath(name) {
+		return "", fmt.Errorf("invalid asset path: %s", name)
+	}
+	return name, nil
+}
+
+// DirAssets exposes directories on disk as an asset tree. Each directory is
+// mounted under its base name, so `--embed ./web/public` serves
+// "public/index.html" in both `hype run` and built executables.
+func DirAssets(dirs []string) (fs.FS, error) {
+	mounts := make(map[string]string)
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, fmt.Errorf("asset directory %s: %w", dir, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("asset directory %s is not a directory", dir)
+		}
+
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Base(abs)
+		if existing, ok := mounts[name]; ok && existing != abs {
+			return nil, fmt.Errorf("asset directories %s and %s both mount as %q", existing, abs, name)
+		}
+		mounts[name] = abs
+	}
+
+	return &mountFS{mounts: mounts}, nil
+}
+
+// mountFS serves each mounted directory under its name, with a synthetic
+// root listing the mounts
+type mountFS struct {
+	mounts map[string]string
+}
+
+func (m *mountFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if name == "." {
+		var entries []fs.DirEntry
+		for mount, dir := range m.mounts {
+			info, err := os.Stat(dir)
+			if err != nil {
+				continue
+			}
+			entries = append(entries, mountEntry{name: mount, info: info})
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+		return &mountRoot{entries: entries}, nil
+	}
+
+	mount, _, _ := strings.Cut(name, "/")
+	dir, ok := m.mounts[mount]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	// The mount name is the directory's base name, so open through the
+	// parent to keep names consistent for the mount point itself
+	return os.DirFS(filepath.Dir(dir)).Open(name)
+}
+
+// mountEntry is a mount point in the synthetic root
+type mountEntry struct {
+	name string
+	info fs.FileInfo
+}
+
+func (e mountEntry) Name() string               { return e.name }
+func (e mountEntry) IsDir() bool                { return true }
+func (e mountEntry) Type() fs.FileMode          { return fs.ModeDir }
+func (e mountEntry) Info() (fs.FileInfo, error) { return e.info, nil }
+
+// mountRoot is the synthetic root directory of a mountFS
+type mountRoot struct {
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (r *mountRoot) Stat() (fs.FileInfo, error) { return mountRootInfo{}, nil }
+func (r *mountRoot) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: ".", Err: fs.ErrInvalid}
+}
+func (r *mountRoot) Close() error { return nil }
+
+func (r *mountRoot) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := r.entries[r.offset:]
+	if n <= 0 {
+		r.offset = len(r.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	r.offset += n
+	return remaining[:n], nil
+}
+
+// mountRootInfo describes the synthetic root directory
+type mountRootInfo struct{}
+
+func (mountRootInfo) Name() string       { return "." }
+func (mountRootInfo) Size() int64        { return 0 }
+func (mountRootInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (mountRootInfo) ModTime() time.Time { return time.Time{} }
+func (mountRootInfo) IsDir() bool        { return true }
+func (mountRootInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,82 @@
+package hyperuntime
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestAssetsModule(t *testing.T) {
+	fsys := fstest.MapFS{
+		"public/index.html":   {Data: []byte("<h1>hi</h1>")},
+		"public/css/site.css": {Data: []byte("body{}")},
+	}
+
+	L := lua.NewState()
+	defer L.Close()
+	RegisterAssetsModule(L, fsys)
+
+	script := `
+local assets = require("assets")
+html = assets.read("/public/index.html")
+missing, missingErr = assets.read("public/nope.html")
+exists = assets.exists("./public/css/site.css")
+dirExists = assets.exists("public")
+escaped = assets.read("../../etc/passwd")
+local all = assets.list()
+listed = table.concat(all, ",")
+css = table.concat(assets.list("public/css"), ",")
+`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %v", err)
+	}
+
+	checks := map[string]string{
+		"html":       "<h1>hi</h1>",
+		"missing":    "nil",
+		"missingErr": "asset not found: public/nope.html",
+		"exists":     "true",
+		"dirExists":  "false",
+		"escaped":    "nil",
+		"listed":     "public/css/site.css,public/index.html",
+		"css":        "public/css/site.css",
+	}
+	for name, want := range checks {
+		if got := L.GetGlobal(name).String(); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestDirAssets(t *testing.T) {
+	root := t.TempDir()
+	public := filepath.Join(root, "web", "public")
+	if err := os.MkdirAll(public, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(public, "index.html"), []byte("hi"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys, err := DirAssets([]string{public})
+	if err != nil {
+		t.Fatalf("DirAssets failed: %v", err)
+	}
+	if err := fstest.TestFS(fsys, "public/index.html"); err != nil {
+		t.Fatalf("DirAssets tree is invalid: %v", err)
+	}
+
+	other := filepath.Join(root, "public")
+	if err := os.MkdirAll(other, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DirAssets([]string{public, other}); err == nil {
+		t.Fatalf("Expected an error for two directories mounted as public")
+	}
+	if _, err := DirAssets([]string{filepath.Join(public, "index.html")}); err == nil {
+		t.Fatalf("Expected an error for a file passed as an asset directory")
+	}
+}
@@ -0,0 +1,245 @@
+// bytecode.go - Precompiled Lua chunk serialization for Hype
+package hyperuntime
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"reflect"
+	"strings"
+	"unsafe"
+
+	"github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// bytecodeMagic prefixes every serialized chunk
+const bytecodeMagic = "HYPELUAC"
+
+// bytecodeFormat is bumped whenever the serialized layout changes
+const bytecodeFormat = 1
+
+// Constant kinds stored in a serialized prototype
+const (
+	constNil uint8 = iota
+	constBool
+	constNumber
+	constString
+)
+
+// bytecodeConstant is a serialized entry of FunctionProto.Constants
+type bytecodeConstant struct {
+	Kind   uint8
+	Bool   bool
+	Number float64
+	String string
+}
+
+// bytecodeProto mirrors lua.FunctionProto with only exported fields so it
+// can be gob-encoded
+type bytecodeProto struct {
+	SourceName         string
+	LineDefined        int
+	LastLineDefined    int
+	NumUpvalues        uint8
+	NumParameters      uint8
+	IsVarArg           uint8
+	NumUsedRegisters   uint8
+	Code               []uint32
+	Constants          []bytecodeConstant
+	FunctionPrototypes []*bytecodeProto
+	DbgSourcePositions []int
+	DbgLocals          []lua.DbgLocalInfo
+	DbgCalls           []lua.DbgCall
+	DbgUpvalues        []string
+}
+
+// bytecodeChunk is the top-level serialized form
+type bytecodeChunk struct {
+	Format int
+	Proto  *bytecodeProto
+}
+
+// CompileBytecode parses and compiles Lua source into a serialized chunk
+func CompileBytecode(source, chunkName string) ([]byte, error) {
+	chunk, err := parse.Parse(strings.NewReader(source), chunkName)
+	if err != nil {
+		return nil, err
+	}
+
+	proto, err := lua.Compile(chunk, chunkName)
+	if err != nil {
+		return nil, err
+	}
+
+	serialized, err := protoToBytecode(proto)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(bytecodeMagic)
+	if err := gob.NewEncoder(&buf).Encode(bytecodeChunk{Format: bytecodeFormat, Proto: serialized}); err != nil {
+		return nil, fmt.Errorf("failed to encode bytecode: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// IsBytecode reports whether data is a serialized chunk
+func IsBytecode(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(bytecodeMagic))
+}
+
+// LoadBytecode turns a serialized chunk into a callable function
+func LoadBytecode(L *lua.LState, data []byte) (*lua.LFunction, error) {
+	if !IsBytecode(data) {
+		return nil, fmt.Errorf("not a hype bytecode chunk")
+	}
+
+	var chunk bytecodeChunk
+	if err := gob.NewDecoder(bytes.NewReader(data[len(bytecodeMagic):])).Decode(&chunk); err != nil {
+		return nil, fmt.Errorf("failed to decode bytecode: %w", err)
+	}
+	if chunk.Format != bytecodeFormat {
+		return nil, fmt.Errorf("unsupported bytecode format %d (expected %d)", chunk.Format, bytecodeFormat)
+	}
+
+	proto, err := bytecodeToProto(chunk.Proto)
+	if err != nil {
+		return nil, err
+	}
+
+	return L.NewFunctionFromProto(proto), nil
+}
+
+// DoBytecode loads and runs a serialized chunk, like L.DoString does for source
+func DoBytecode(L *lua.LState, data []byte) error {
+	fn, err := LoadBytecode(L, data)
+	if err != nil {
+		return err
+	}
+	L.Push(fn)
+	return L.PCall(0, lua.MultRet, nil)
+}
+
+func protoToBytecode(proto *lua.FunctionProto) (*bytecodeProto, error) {
+	bp := &bytecodeProto{
+		SourceName:         proto.SourceName,
+		LineDefined:        proto.LineDefined,
+		LastLineDefined:    proto.LastLineDefined,
+		NumUpvalues:        proto.NumUpvalues,
+		NumParameters:      proto.NumParameters,
+		IsVarArg:           proto.IsVarArg,
+		NumUsedRegisters:   proto.NumUsedRegisters,
+		Code:               proto.Code,
+		DbgSourcePositions: proto.DbgSourcePositions,
+		DbgCalls:           proto.DbgCalls,
+		DbgUpvalues:        proto.DbgUpvalues,
+	}
+
+	for _, constant := range proto.Constants {
+		switch v := constant.(type) {
+		case *lua.LNilType:
+			bp.Constants = append(bp.Constants, bytecodeConstant{Kind: constNil})
+		case lua.LBool:
+			bp.Constants = append(bp.Constants, bytecodeConstant{Kind: constBool, Bool: bool(v)})
+		case lua.LNumber:
+			bp.Constants = append(bp.Constants, bytecodeConstant{Kind: constNumber, Number: float64(v)})
+		case lua.LString:
+			bp.Constants = append(bp.Constants, bytecodeConstant{Kind: constString, String: string(v)})
+		default:
+			return nil, fmt.Errorf("unsupported constant type %s", constant.Type())
+		}
+	}
+
+	for _, local := range proto.DbgLocals {
+		bp.DbgLocals = append(bp.DbgLocals, *local)
+	}
+
+	for _, child := range proto.FunctionPrototypes {
+		childBP, err := protoToBytecode(child)
+		if err != nil {
+			return nil, err
+		}
+		bp.FunctionPrototypes = append(bp.FunctionPrototypes, childBP)
+	}
+
+	return bp, nil
+}
+
+func bytecodeToProto(bp *bytecodeProto) (*lua.FunctionProto, error) {
+	if bp == nil {
+		return nil, fmt.Errorf("missing function prototype")
+	}
+
+	proto := &lua.FunctionProto{
+		SourceName:         bp.SourceName,
+		LineDefined:        bp.LineDefined,
+		LastLineDefined:    bp.LastLineDefined,
+		NumUpvalues:        bp.NumUpvalues,
+		NumParameters:      bp.NumParameters,
+		IsVarArg:           bp.IsVarArg,
+		NumUsedRegisters:   bp.NumUsedRegisters,
+		Code:               bp.Code,
+		Constants:          make([]lua.LValue, 0, len(bp.Constants)),
+		FunctionPrototypes: make([]*lua.FunctionProto, 0, len(bp.FunctionPrototypes)),
+		DbgSourcePositions: bp.DbgSourcePositions,
+		DbgLocals:          make([]*lua.DbgLocalInfo, 0, len(bp.DbgLocals)),
+		DbgCalls:           bp.DbgCalls,
+		DbgUpvalues:        bp.DbgUpvalues,
+	}
+
+	stringConstants := make([]string, 0, len(bp.Constants))
+	for _, constant := range bp.Constants {
+		switch constant.Kind {
+		case constNil:
+			proto.Constants = append(proto.Constants, lua.LNil)
+			stringConstants = append(stringConstants, "")
+		case constBool:
+			proto.Constants = append(proto.Constants, lua.LBool(constant.Bool))
+			stringConstants = append(stringConstants, "")
+		case constNumber:
+			proto.Constants = append(proto.Constants, lua.LNumber(constant.Number))
+			stringConstants = append(stringConstants, "")
+		case constString:
+			proto.Constants = append(proto.Constants, lua.LString(constant.String))
+			stringConstants = append(stringConstants, constant.String)
+		default:
+			return nil, fmt.Errorf("unknown constant kind %d", constant.Kind)
+		}
+	}
+	if err := setStringConstants(proto, stringConstants); err != nil {
+		return nil, err
+	}
+
+	for i := range bp.DbgLocals {
+		local := bp.DbgLocals[i]
+		proto.DbgLocals = append(proto.DbgLocals, &local)
+	}
+
+	for _, childBP := range bp.FunctionPrototypes {
+		child, err := bytecodeToProto(childBP)
+		if err != nil {
+			return nil, err
+		}
+		proto.FunctionPrototypes = append(proto.FunctionPrototypes, child)
+	}
+
+	return proto, nil
+}
+
+// setStringConstants fills FunctionProto's unexported string constant cache.
+// The compiler builds it alongside Constants and the VM indexes it directly
+// for global and field access, so a decoded prototype is unusable without it.
+// gopher-lua offers no way to set it, so this relies on the layout of the
+// pinned gopher-lua version; TestBytecodeGopherLuaLayout fails when either
+// changes.
+func setStringConstants(proto *lua.FunctionProto, values []string) error {
+	field := reflect.ValueOf(proto).Elem().FieldByName("stringConstants")
+	if !field.IsValid() || field.Type() != reflect.TypeOf(values) {
+		return fmt.Errorf("incompatible gopher-lua version: FunctionProto.stringConstants not found")
+	}
+	reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem().Set(reflect.ValueOf(values))
+	return nil
+}
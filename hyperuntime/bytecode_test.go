@@ -0,0 +1,148 @@
+package hyperuntime
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	source := `
+local function fib(n) if n < 2 then return n end return fib(n - 1) + fib(n - 2) end
+local t = { name = "hype", values = { 1.5, 2.5 } }
+result = string.format("%s:%d:%.1f", t.name, fib(10), t.values[1] + t.values[2])
+`
+
+	bytecode, err := CompileBytecode(source, "<string>")
+	if err != nil {
+		t.Fatalf("CompileBytecode failed: %v", err)
+	}
+	if !IsBytecode(bytecode) {
+		t.Fatalf("Compiled chunk is missing the bytecode header")
+	}
+	if strings.Contains(string(bytecode), "local function fib") {
+		t.Fatalf("Compiled chunk should not contain the script source")
+	}
+
+	L := lua.NewState()
+	defer L.Close()
+
+	if err := DoBytecode(L, bytecode); err != nil {
+		t.Fatalf("DoBytecode failed: %v", err)
+	}
+
+	if got := L.GetGlobal("result").String(); got != "hype:55:4.0" {
+		t.Fatalf("Unexpected result: %s", got)
+	}
+}
+
+func TestBytecodeErrorsKeepLineNumbers(t *testing.T) {
+	bytecode, err := CompileBytecode("local x = 1\nerror('boom')\n", "<string>")
+	if err != nil {
+		t.Fatalf("CompileBytecode failed: %v", err)
+	}
+
+	L := lua.NewState()
+	defer L.Close()
+
+	err = DoBytecode(L, bytecode)
+	if err == nil || !strings.Contains(err.Error(), "<string>:2: boom") {
+		t.Fatalf("Expected error at line 2, got: %v", err)
+	}
+}
+
+func TestCompileBytecodeSyntaxError(t *testing.T) {
+	if _, err := CompileBytecode("local = 1", "<string>"); err == nil {
+		t.Fatalf("Expected a syntax error")
+	}
+}
+
+// gopherLuaLayoutVersion is the gopher-lua version whose FunctionProto layout
+// setStringConstants was checked against
+const gopherLuaLayoutVersion = "v1.1.1"
+
+func TestBytecodeGopherLuaLayout(t *testing.T) {
+	goMod, err := os.ReadFile(filepath.Join("..", "go.mod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var required string
+	for _, line := range strings.Split(string(goMod), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "github.com/yuin/gopher-lua" {
+			required = fields[1]
+		}
+	}
+	if required != gopherLuaLayoutVersion {
+		t.Errorf("go.mod requires gopher-lua %s, but setStringConstants was checked against %s; check FunctionProto and update this test", required, gopherLuaLayoutVersion)
+	}
+
+	var fields []string
+	protoType := reflect.TypeOf(lua.FunctionProto{})
+	for i := 0; i < protoType.NumField(); i++ {
+		fields = append(fields, protoType.Field(i).Name+" "+protoType.Field(i).Type.String())
+	}
+	want := []string{
+		"SourceName string",
+		"LineDefined int",
+		"LastLineDefined int",
+		"NumUpvalues uint8",
+		"NumParameters uint8",
+		"IsVarArg uint8",
+		"NumUsedRegisters uint8",
+		"Code []uint32",
+		"Constants []lua.LValue",
+		"FunctionPrototypes []*lua.FunctionProto",
+		"DbgSourcePositions []int",
+		"DbgLocals []*lua.DbgLocalInfo",
+		"DbgCalls []lua.DbgCall",
+		"DbgUpvalues []string",
+		"stringConstants []string",
+	}
+	if strings.Join(fields, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("FunctionProto layout changed:\n%s", strings.Join(fields, "\n"))
+	}
+
+	// A decoded prototype must hold the string constants the compiler built
+	chunk, err := parse.Parse(strings.NewReader(`local t = {name = "x"} function f() return t.name, 1, nil end`), "<string>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := lua.Compile(chunk, "<string>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serialized, err := protoToBytecode(compiled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := bytecodeToProto(serialized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var compare func(compiled, decoded *lua.FunctionProto)
+	compare = func(compiled, decoded *lua.FunctionProto) {
+		if got, want := stringConstants(decoded), stringConstants(compiled); !reflect.DeepEqual(got, want) {
+			t.Errorf("Decoded string constants = %q, compiled %q", got, want)
+		}
+		for i := range compiled.FunctionPrototypes {
+			compare(compiled.FunctionPrototypes[i], decoded.FunctionPrototypes[i])
+		}
+	}
+	compare(compiled, decoded)
+}
+
+// stringConstants reads FunctionProto's unexported string constants
+func stringConstants(proto *lua.FunctionProto) []string {
+	field := reflect.ValueOf(proto).Elem().FieldByName("stringConstants")
+	values := make([]string, field.Len())
+	for i := range values {
+		values[i] = field.Index(i).String()
+	}
+	return values
+}
@@ -1,5 +1,5 @@
 // crypto_functions.go - Crypto module implementation for Hype
-package main
+package hyperuntime
 
 import (
 	"crypto"
@@ -340,6 +340,16 @@ func cryptoVerify(L *lua.LState) int {
 	return 1
 }
 
+// SignWithJWK signs data with a private JWK, the way crypto.sign does
+func SignWithJWK(jwk *JWK, data []byte) ([]byte, error) {
+	return signWithJWK(jwk, data)
+}
+
+// VerifyWithJWK verifies a signature made by SignWithJWK or crypto.sign
+func VerifyWithJWK(jwk *JWK, data []byte, signature []byte) (bool, error) {
+	return verifyWithJWK(jwk, data, signature)
+}
+
 // signWithJWK signs data using a JWK
 func signWithJWK(jwk *JWK, data []byte) ([]byte, error) {
 	switch jwk.Kty {
@@ -833,6 +843,20 @@ func cryptoJWKThumbprint(L *lua.LState) int {
 		return 2
 	}
 	
+	thumbprint, err := JWKThumbprint(jwk)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	L.Push(lua.LString(thumbprint))
+	return 1
+}
+
+// JWKThumbprint returns the RFC 7638 thumbprint of a JWK, which is the same
+// for its private and public forms
+func JWKThumbprint(jwk *JWK) (string, error) {
 	// Create canonical JSON for thumbprint (RFC 7638)
 	var canonical map[string]interface{}
 	switch jwk.Kty {
@@ -856,23 +880,16 @@ func cryptoJWKThumbprint(L *lua.LState) int {
 			"x":   jwk.X,
 		}
 	default:
-		L.Push(lua.LNil)
-		L.Push(lua.LString("unsupported key type for thumbprint: " + jwk.Kty))
-		return 2
+		return "", fmt.Errorf("unsupported key type for thumbprint: %s", jwk.Kty)
 	}
 	
 	canonicalJSON, err := json.Marshal(canonical)
 	if err != nil {
-		L.Push(lua.LNil)
-		L.Push(lua.LString("failed to create canonical JSON: " + err.Error()))
-		return 2
+		return "", fmt.Errorf("failed to create canonical JSON: %w", err)
 	}
 	
 	hash := sha256.Sum256(canonicalJSON)
-	thumbprint := base64.RawURLEncoding.EncodeToString(hash[:])
-	
-	L.Push(lua.LString(thumbprint))
-	return 1
+	return base64.RawURLEncoding.EncodeToString(hash[:]), nil
 }
 
 // cryptoJWKToJSON converts JWK to JSON string
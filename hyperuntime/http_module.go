@@ -1,4 +1,4 @@
-package main
+package hyperuntime
 
 import (
 	"bytes"
@@ -16,11 +16,12 @@ import (
 
 // HTTPServer represents an HTTP server instance
 type HTTPServer struct {
-	server   *http.Server
-	mux      *http.ServeMux
-	handlers map[string]*lua.LFunction
-	L        *lua.LState
-	mu       sync.RWMutex
+	server     *http.Server
+	mux        *http.ServeMux
+	handlers   map[string]*lua.LFunction
+	L          *lua.LState
+	mu         sync.RWMutex
+	unregister func()
 }
 
 // ResponseWriter wraps http.ResponseWriter to track if headers were written
@@ -54,16 +55,16 @@ func RegisterHTTPModule(L *lua.LState) {
 		httpModule := L.NewTable()
 		
 		// Client methods
-		L.SetField(httpModule, "get", L.NewFunction(httpGet))
-		L.SetField(httpModule, "post", L.NewFunction(httpPost))
-		L.SetField(httpModule, "put", L.NewFunction(httpPut))
-		L.SetField(httpModule, "delete", L.NewFunction(httpDelete))
-		L.SetField(httpModule, "head", L.NewFunction(httpHead))
-		L.SetField(httpModule, "patch", L.NewFunction(httpPatch))
-		L.SetField(httpModule, "request", L.NewFunction(httpRequest))
+		L.SetField(httpModule, "get", L.NewFunction(requirePermission(PermissionNetDial, httpGet)))
+		L.SetField(httpModule, "post", L.NewFunction(requirePermission(PermissionNetDial, httpPost)))
+		L.SetField(httpModule, "put", L.NewFunction(requirePermission(PermissionNetDial, httpPut)))
+		L.SetField(httpModule, "delete", L.NewFunction(requirePermission(PermissionNetDial, httpDelete)))
+		L.SetField(httpModule, "head", L.NewFunction(requirePermission(PermissionNetDial, httpHead)))
+		L.SetField(httpModule, "patch", L.NewFunction(requirePermission(PermissionNetDial, httpPatch)))
+		L.SetField(httpModule, "request", L.NewFunction(requirePermission(PermissionNetDial, httpRequest)))
 		
 		// Server methods
-		L.SetField(httpModule, "newServer", L.NewFunction(httpNewServer))
+		L.SetField(httpModule, "newServer", L.NewFunction(requirePermission(PermissionNetListen, httpNewServer)))
 		
 		L.Push(httpModule)
 		return 1
@@ -395,6 +396,7 @@ func serverIndex(L *lua.LState) int {
 				WriteTimeout: 30 * time.Second,
 				IdleTimeout:  120 * time.Second,
 			}
+			server.unregister = onShutdown(L, server.server.Shutdown)
 			
 			// Start server in goroutine
 			go func() {
@@ -409,6 +411,7 @@ func serverIndex(L *lua.LState) int {
 	case "stop":
 		L.Push(L.NewFunction(func(L *lua.LState) int {
 			if server.server != nil {
+				server.unregister()
 				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 				defer cancel()
 				server.server.Shutdown(ctx)
@@ -0,0 +1,89 @@
+// hype_module.go - Hype module implementation for Hype
+package hyperuntime
+
+import (
+	"runtime"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// Values of BuildInfo.Mode
+const (
+	ModeRun   = "run"   // Started with hype run
+	ModeBuilt = "built" // Running as a built executable
+)
+
+// BuildInfo is what the hype module tells a script about how it was built
+// and how it is running
+type BuildInfo struct {
+	Version string            // hype version of the runtime
+	Commit  string            // hype commit of the runtime
+	Date    string            // When the executable was built, or the run started (RFC 3339)
+	Mode    string            // ModeRun or ModeBuilt
+	Plugins []PluginInfo      // Plugins compiled in or loaded, in load order
+	Defines map[string]string // Values from hype.yaml and --define
+}
+
+// PluginInfo identifies a plugin in BuildInfo
+type PluginInfo struct {
+	Name    string
+	Version string
+}
+
+// RegisterHypeModule registers the read-only hype module. hype.target is
+// always the platform the script is running on.
+func RegisterHypeModule(L *lua.LState, info BuildInfo) {
+	target := runtime.GOOS + "/" + runtime.GOARCH
+
+	L.PreloadModule("hype", func(L *lua.LState) int {
+		// Fields are served through __index so assignments can be refused;
+		// tables are fresh copies so changing them does not leak either
+		fields := func(L *lua.LState, key string) lua.LValue {
+			switch key {
+			case "version":
+				return lua.LString(info.Version)
+			case "commit":
+				return lua.LString(info.Commit)
+			case "date":
+				return lua.LString(info.Date)
+			case "target":
+				return lua.LString(target)
+			case "mode":
+				return lua.LString(info.Mode)
+			case "plugins":
+				plugins := L.NewTable()
+				for _, plugin := range info.Plugins {
+					entry := L.NewTable()
+					entry.RawSetString("name", lua.LString(plugin.Name))
+					entry.RawSetString("version", lua.LString(plugin.Version))
+					plugins.Append(entry)
+				}
+				return plugins
+			case "defines":
+				defines := L.NewTable()
+				for key, value := range info.Defines {
+					defines.RawSetString(key, lua.LString(value))
+				}
+				return defines
+			}
+			return lua.LNil
+		}
+
+		hypeModule := L.NewTable()
+		meta := L.NewTable()
+		L.SetField(meta, "__index", L.NewFunction(func(L *lua.LState) int {
+			key, _ := L.Get(2).(lua.LString)
+			L.Push(fields(L, string(key)))
+			return 1
+		}))
+		L.SetField(meta, "__newindex", L.NewFunction(func(L *lua.LState) int {
+			L.RaiseError("hype module is read-only")
+			return 0
+		}))
+		L.SetField(meta, "__metatable", lua.LFalse)
+		L.SetMetatable(hypeModule, meta)
+
+		L.Push(hypeModule)
+		return 1
+	})
+}
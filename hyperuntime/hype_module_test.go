@@ -0,0 +1,74 @@
+package hyperuntime
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestHypeModuleDefines(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	RegisterHypeModule(L, BuildInfo{Defines: map[string]string{"API_URL": "https://example.com"}})
+
+	if err := L.DoString(`local hype = require("hype"); url = hype.defines.API_URL; missing = hype.defines.MISSING`); err != nil {
+		t.Fatalf("Script failed: %v", err)
+	}
+	if got := L.GetGlobal("url").String(); got != "https://example.com" {
+		t.Errorf("hype.defines.API_URL = %q", got)
+	}
+	if got := L.GetGlobal("missing"); got != lua.LNil {
+		t.Errorf("hype.defines.MISSING = %v, want nil", got)
+	}
+}
+
+func TestHypeModuleBuildInfo(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	RegisterHypeModule(L, BuildInfo{
+		Version: "1.2.3",
+		Commit:  "abc123",
+		Date:    "2025-01-02T03:04:05Z",
+		Mode:    ModeBuilt,
+		Plugins: []PluginInfo{{Name: "fs", Version: "1.0.0"}, {Name: "json", Version: "2.1.0"}},
+		Defines: map[string]string{"APP_VERSION": "0.9.0"},
+	})
+
+	script := `
+		local hype = require("hype")
+		summary = table.concat({hype.version, hype.commit, hype.date, hype.target, hype.mode}, " ")
+		local names = {}
+		for i, plugin in ipairs(hype.plugins) do
+			names[i] = plugin.name .. "@" .. plugin.version
+		end
+		plugins = table.concat(names, ",")
+
+		-- Tables are copies, so changing them is not seen by later reads
+		hype.defines.APP_VERSION = "changed"
+		app_version = hype.defines.APP_VERSION
+	`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %v", err)
+	}
+
+	want := "1.2.3 abc123 2025-01-02T03:04:05Z " + runtime.GOOS + "/" + runtime.GOARCH + " built"
+	if got := L.GetGlobal("summary").String(); got != want {
+		t.Errorf("summary = %q, want %q", got, want)
+	}
+	if got := L.GetGlobal("plugins").String(); got != "fs@1.0.0,json@2.1.0" {
+		t.Errorf("plugins = %q", got)
+	}
+	if got := L.GetGlobal("app_version").String(); got != "0.9.0" {
+		t.Errorf("hype.defines.APP_VERSION = %q after assignment, want 0.9.0", got)
+	}
+
+	err := L.DoString(`require("hype").version = "9.9.9"`)
+	if err == nil || !strings.Contains(err.Error(), "read-only") {
+		t.Fatalf("Expected assigning hype.version to fail, got %v", err)
+	}
+	if err := L.DoString(`assert(getmetatable(require("hype")) == false)`); err != nil {
+		t.Fatalf("Expected the hype metatable to be protected: %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+// lifecycle.go - Shutdown of the servers, apps and plugins a Lua state starts
+package hyperuntime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// shutdownHooks holds, per Lua state, the functions that stop the HTTP
+// servers, WebSocket servers and TUI apps the state has started. States are
+// keyed by their Global so coroutines share their parent's hooks.
+var (
+	shutdownMu     sync.Mutex
+	shutdownHooks  = make(map[*lua.Global]map[int]func(context.Context) error)
+	nextShutdownID int
+)
+
+// onShutdown registers fn to run when L is shut down. The returned function
+// unregisters it, for servers and apps the script stops itself.
+func onShutdown(L *lua.LState, fn func(context.Context) error) func() {
+	shutdownMu.Lock()
+	defer shutdownMu.Unlock()
+
+	hooks := shutdownHooks[L.G]
+	if hooks == nil {
+		hooks = make(map[int]func(context.Context) error)
+		shutdownHooks[L.G] = hooks
+	}
+	nextShutdownID++
+	id := nextShutdownID
+	hooks[id] = fn
+
+	return func() {
+		shutdownMu.Lock()
+		defer shutdownMu.Unlock()
+		delete(shutdownHooks[L.G], id)
+	}
+}
+
+// Shutdown gracefully stops every HTTP server, WebSocket server and TUI app
+// started from L. In-flight requests may finish until ctx is done; open
+// WebSocket connections receive a close frame.
+func Shutdown(ctx context.Context, L *lua.LState) error {
+	shutdownMu.Lock()
+	hooks := shutdownHooks[L.G]
+	delete(shutdownHooks, L.G)
+	shutdownMu.Unlock()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(hooks))
+	for _, hook := range hooks {
+		wg.Add(1)
+		go func(hook func(context.Context) error) {
+			defer wg.Done()
+			if err := hook(ctx); err != nil {
+				errs <- err
+			}
+		}(hook)
+	}
+	wg.Wait()
+	close(errs)
+
+	var all []error
+	for err := range errs {
+		all = append(all, err)
+	}
+	return errors.Join(all...)
+}
+
+// pluginHook is the shutdown hook of one plugin
+type pluginHook struct {
+	name string
+	fn   func(context.Context) error
+}
+
+// pluginHooks holds, per Lua state, the shutdown hooks of its plugins in the
+// order the plugins were initialized
+var pluginHooks = make(map[*lua.Global][]pluginHook)
+
+// OnPluginShutdown registers the shutdown hook of the plugin name, to run
+// when ShutdownPlugins is called for L
+func OnPluginShutdown(L *lua.LState, name string, fn func(context.Context) error) {
+	shutdownMu.Lock()
+	defer shutdownMu.Unlock()
+	pluginHooks[L.G] = append(pluginHooks[L.G], pluginHook{name: name, fn: fn})
+}
+
+// ShutdownPlugins runs the shutdown hooks of L's plugins one at a time, the
+// plugin initialized last first, so a plugin shuts down before the plugins
+// it was set up with. Hooks of Lua plugins run Lua code, so it must be
+// called from the goroutine running L once the script has returned.
+func ShutdownPlugins(ctx context.Context, L *lua.LState) error {
+	shutdownMu.Lock()
+	hooks := pluginHooks[L.G]
+	delete(pluginHooks, L.G)
+	shutdownMu.Unlock()
+
+	var all []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i].fn(ctx); err != nil {
+			all = append(all, fmt.Errorf("plugin %s: %w", hooks[i].name, err))
+		}
+	}
+	return errors.Join(all...)
+}
+
+// ShutdownTimeout bounds how long servers and plugins get to shut down when
+// a script finishes or is interrupted
+const ShutdownTimeout = 5 * time.Second
+
+// SignalContext returns a context that is cancelled on SIGINT or SIGTERM.
+// Once it is cancelled the signals are handled as usual again, so a second
+// Ctrl-C kills a script that does not shut down.
+func SignalContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+	return ctx, stop
+}
+
+// Run runs a script in L with run and then shuts down what it started: its
+// servers and TUI apps, then its plugins. Cancelling ctx stops the servers
+// and apps and aborts the VM, so a script blocked in a server or app
+// returns; a script stopped that way returns nil. Shutdown errors are
+// reported on stderr.
+func Run(ctx context.Context, L *lua.LState, run func() error) error {
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		defer cancel()
+		if err := Shutdown(shutdownCtx, L); err != nil {
+			fmt.Fprintf(os.Stderr, "Error shutting down: %v\n", err)
+		}
+		// The shutdown functions of Lua plugins must run even when ctx
+		// aborted the script
+		if ctx.Done() != nil {
+			L.RemoveContext()
+		}
+		if err := ShutdownPlugins(shutdownCtx, L); err != nil {
+			fmt.Fprintf(os.Stderr, "Error shutting down plugins: %v\n", err)
+		}
+	}()
+
+	if ctx.Done() != nil {
+		L.SetContext(ctx)
+		stop := context.AfterFunc(ctx, func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+			defer cancel()
+			if err := Shutdown(shutdownCtx, L); err != nil {
+				fmt.Fprintf(os.Stderr, "Error shutting down: %v\n", err)
+			}
+		})
+		defer stop()
+	}
+
+	if err := run(); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package hyperuntime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestShutdownStopsServers(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	L := NewState("test.lua", nil)
+	defer L.Close()
+
+	script := fmt.Sprintf(`
+local http = require("http")
+local server = http.newServer()
+server:handle("/", function(req, res) res:write("up") end)
+server:listen(%d)
+`, port)
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %v", err)
+	}
+
+	url := fmt.Sprintf("http://127.0.0.1:%d/", port)
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		if resp, err = http.Get(url); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Server did not start: %v", err)
+	}
+	resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := Shutdown(ctx, L); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	if _, err := http.Get(url); err == nil {
+		t.Fatalf("Server still accepting requests after Shutdown")
+	}
+
+	shutdownMu.Lock()
+	remaining := len(shutdownHooks[L.G])
+	shutdownMu.Unlock()
+	if remaining != 0 {
+		t.Fatalf("%d shutdown hooks left after Shutdown", remaining)
+	}
+}
+
+// lifecyclePlugin records its Init and Shutdown calls in events
+type lifecyclePlugin struct {
+	name   string
+	events *[]string
+}
+
+func (p *lifecyclePlugin) Init(config map[string]interface{}) error {
+	*p.events = append(*p.events, fmt.Sprintf("init %s %v", p.name, config["level"]))
+	return nil
+}
+
+func (p *lifecyclePlugin) Register(L *lua.LState) error { return nil }
+
+func (p *lifecyclePlugin) Shutdown(ctx context.Context) error {
+	*p.events = append(*p.events, "shutdown "+p.name)
+	if p.name == "b" {
+		return errors.New("flush failed")
+	}
+	return nil
+}
+
+func TestPluginLifecycle(t *testing.T) {
+	var events []string
+	files := fstest.MapFS{"plugin.lua": {Data: []byte(`
+local M = {}
+function M.init(config) M.level = config.level end
+function M.shutdown() events = (events or "") .. "shutdown lua " .. M.level end
+return M`)}}
+
+	L := NewState("test.lua", nil)
+	defer L.Close()
+	if err := RegisterGoPlugin(L, "a", &lifecyclePlugin{name: "a", events: &events}, map[string]interface{}{"level": 1.0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterGoPlugin(L, "b", &lifecyclePlugin{name: "b", events: &events}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterLuaPlugin(L, "c", "plugin.lua", files, nil, map[string]interface{}{"level": "debug"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := Run(context.Background(), L, func() error {
+		return L.DoString(`level = require("c").level`)
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if got := L.GetGlobal("level").String(); got != "debug" {
+		t.Errorf("init got level %q, want debug", got)
+	}
+	want := "init a 1,init b <nil>,shutdown b,shutdown a"
+	if got := strings.Join(events, ","); got != want {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+	if got := L.GetGlobal("events").String(); got != "shutdown lua debug" {
+		t.Errorf("Lua shutdown hook did not run: events = %q", got)
+	}
+
+	// A second shutdown has nothing left to run
+	if err := ShutdownPlugins(context.Background(), L); err != nil {
+		t.Errorf("Second ShutdownPlugins failed: %v", err)
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	files := fstest.MapFS{"plugin.lua": {Data: []byte(`
+return {shutdown = function() stopped = true end}`)}}
+
+	L := NewState("test.lua", nil)
+	defer L.Close()
+	if err := RegisterLuaPlugin(L, "p", "plugin.lua", files, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	err := Run(ctx, L, func() error {
+		return L.DoString(`require("p") while true do end`)
+	})
+	if err != nil {
+		t.Fatalf("Cancelled Run returned %v, want nil", err)
+	}
+	if L.GetGlobal("stopped") != lua.LTrue {
+		t.Errorf("Shutdown hook did not run after cancellation")
+	}
+}
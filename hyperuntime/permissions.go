@@ -0,0 +1,283 @@
+// permissions.go - Capabilities granted to Lua plugins and their enforcement
+package hyperuntime
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// Permissions a plugin can request in its manifest
+const (
+	PermissionFSRead    = "fs:read"    // Read files: io.open for reading, io.lines, dofile, loadfile
+	PermissionFSWrite   = "fs:write"   // Create, write, rename and remove files
+	PermissionNetDial   = "net:dial"   // HTTP requests and WebSocket clients
+	PermissionNetListen = "net:listen" // HTTP and WebSocket servers
+	PermissionExec      = "exec"       // os.execute and io.popen
+	PermissionKV        = "kv"         // kv.open
+)
+
+// Permissions lists every permission in the order they are shown
+var Permissions = []string{
+	PermissionFSRead,
+	PermissionFSWrite,
+	PermissionNetDial,
+	PermissionNetListen,
+	PermissionExec,
+	PermissionKV,
+}
+
+// ValidatePermissions returns an error for a permission hype does not know
+func ValidatePermissions(permissions []string) error {
+	for _, permission := range permissions {
+		known := false
+		for _, p := range Permissions {
+			known = known || p == permission
+		}
+		if !known {
+			return fmt.Errorf("unknown permission %q (available: %s)", permission, strings.Join(Permissions, ", "))
+		}
+	}
+	return nil
+}
+
+// sandboxesKey is the registry field that maps the environment of each Lua
+// plugin to its sandbox. Lua code cannot reach the registry without the
+// debug library, which plugins do not get.
+const sandboxesKey = "hype.sandboxes"
+
+// sandbox is what a Lua plugin is allowed to do
+type sandbox struct {
+	name        string
+	permissions map[string]bool
+}
+
+// check raises a Lua error unless the plugin has permission
+func (s *sandbox) check(L *lua.LState, permission string) {
+	if !s.permissions[permission] {
+		L.RaiseError("plugin %s does not have the %s permission", s.name, permission)
+	}
+}
+
+// CheckPermission raises a Lua error when the Lua code calling the running
+// Go function belongs to a plugin without permission. Calls from the script
+// itself, and from code it passed its own functions to, are always allowed.
+func CheckPermission(L *lua.LState, permission string) {
+	if s := callerSandbox(L); s != nil {
+		s.check(L, permission)
+	}
+}
+
+// requirePermission wraps a module function so that plugins without
+// permission cannot call it
+func requirePermission(permission string, fn lua.LGFunction) lua.LGFunction {
+	return func(L *lua.LState) int {
+		CheckPermission(L, permission)
+		return fn(L)
+	}
+}
+
+// callerSandbox returns the sandbox of the innermost Lua function on the
+// call stack, following coroutines to the code that resumed them. It
+// returns nil for the script's own code.
+func callerSandbox(L *lua.LState) *sandbox {
+	sandboxes, ok := L.G.Registry.RawGetString(sandboxesKey).(*lua.LTable)
+	if !ok {
+		return nil
+	}
+	for state := L; state != nil; state = state.Parent {
+		for level := 0; ; level++ {
+			dbg, ok := state.GetStack(level)
+			if !ok {
+				break
+			}
+			value, err := state.GetInfo("f", dbg, lua.LNil)
+			fn, ok := value.(*lua.LFunction)
+			if err != nil || !ok || fn.IsG {
+				continue
+			}
+			if ud, ok := sandboxes.RawGet(fn.Env).(*lua.LUserData); ok {
+				return ud.Value.(*sandbox)
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// newSandboxEnv creates the environment a Lua plugin's files run in. Globals
+// are read from and written to _G, except that the plugin sees io and os
+// without the functions its permissions do not cover, and neither the debug
+// library, package nor the real global table. Chunks the plugin loads run
+// in the same environment.
+func newSandboxEnv(L *lua.LState, name string, permissions []string) *lua.LTable {
+	s := &sandbox{name: name, permissions: make(map[string]bool)}
+	for _, permission := range permissions {
+		s.permissions[permission] = true
+	}
+
+	hidden := map[lua.LValue]bool{lua.LString("debug"): true, lua.LString("package"): true}
+	if !s.permissions[PermissionFSRead] {
+		hidden[lua.LString("dofile")] = true
+		hidden[lua.LString("loadfile")] = true
+	}
+
+	globals := L.G.Global
+	env := L.NewTable()
+	meta := L.NewTable()
+	L.SetField(meta, "__index", L.NewFunction(func(L *lua.LState) int {
+		key := L.Get(2)
+		if hidden[key] {
+			L.Push(lua.LNil)
+		} else {
+			L.Push(L.GetTable(globals, key))
+		}
+		return 1
+	}))
+	L.SetField(meta, "__newindex", globals)
+	L.SetField(meta, "__metatable", lua.LFalse)
+	L.SetMetatable(env, meta)
+
+	sandboxes, ok := L.G.Registry.RawGetString(sandboxesKey).(*lua.LTable)
+	if !ok {
+		sandboxes = L.NewTable()
+		L.G.Registry.RawSetString(sandboxesKey, sandboxes)
+	}
+	ud := L.NewUserData()
+	ud.Value = s
+	sandboxes.RawSet(env, ud)
+
+	env.RawSetString("_G", env)
+	env.RawSetString("io", sandboxIO(L, s))
+	env.RawSetString("os", sandboxOS(L, s))
+
+	// Functions returned by load and friends would otherwise run with the
+	// real globals
+	loader := func(name string) *lua.LFunction {
+		load := L.GetField(globals, name)
+		return L.NewFunction(func(L *lua.LState) int {
+			top := L.GetTop()
+			L.Push(load)
+			for i := 1; i <= top; i++ {
+				L.Push(L.Get(i))
+			}
+			L.Call(top, lua.MultRet)
+			if fn, ok := L.Get(top + 1).(*lua.LFunction); ok {
+				L.SetFEnv(fn, env)
+			}
+			return L.GetTop() - top
+		})
+	}
+	env.RawSetString("load", loader("load"))
+	env.RawSetString("loadstring", loader("loadstring"))
+	if s.permissions[PermissionFSRead] {
+		loadfile := loader("loadfile")
+		env.RawSetString("loadfile", loadfile)
+		env.RawSetString("dofile", L.NewFunction(func(L *lua.LState) int {
+			top := L.GetTop()
+			L.Push(loadfile)
+			L.Push(lua.LString(L.CheckString(1)))
+			L.Call(1, 2)
+			if L.Get(-2) == lua.LNil {
+				L.RaiseError("%s", L.Get(-1).String())
+			}
+			L.Pop(1)
+			L.Call(0, lua.MultRet)
+			return L.GetTop() - top
+		}))
+	}
+
+	getfenv := L.GetField(globals, "getfenv")
+	env.RawSetString("getfenv", L.NewFunction(func(L *lua.LState) int {
+		top := L.GetTop()
+		L.Push(getfenv)
+		for i := 1; i <= top; i++ {
+			L.Push(L.Get(i))
+		}
+		L.Call(top, 1)
+		if fenv, ok := L.Get(-1).(*lua.LTable); ok && (fenv == globals || sandboxes.RawGet(fenv) != lua.LNil) {
+			L.Pop(1)
+			L.Push(env)
+		}
+		return 1
+	}))
+	return env
+}
+
+// sandboxIO returns the io library as a plugin sees it. Standard input and
+// output are always available; opening files needs fs:read or fs:write
+// depending on the mode, and io.popen needs exec.
+func sandboxIO(L *lua.LState, s *sandbox) *lua.LTable {
+	lib, _ := L.GetField(L.G.Global, "io").(*lua.LTable)
+	io := L.NewTable()
+	if lib == nil {
+		return io
+	}
+	for _, name := range []string{"close", "flush", "read", "write", "type", "stdin", "stdout", "stderr"} {
+		io.RawSetString(name, lib.RawGetString(name))
+	}
+
+	// gated wraps an io function whose permission depends on its arguments
+	gated := func(name string, permission func(L *lua.LState) string) {
+		fn := lib.RawGetString(name)
+		io.RawSetString(name, L.NewFunction(func(L *lua.LState) int {
+			if p := permission(L); p != "" {
+				s.check(L, p)
+			}
+			top := L.GetTop()
+			L.Push(fn)
+			for i := 1; i <= top; i++ {
+				L.Push(L.Get(i))
+			}
+			L.Call(top, lua.MultRet)
+			return L.GetTop() - top
+		}))
+	}
+	named := func(permission string) func(L *lua.LState) string {
+		return func(L *lua.LState) string {
+			if _, ok := L.Get(1).(lua.LString); ok {
+				return permission
+			}
+			return ""
+		}
+	}
+	gated("open", func(L *lua.LState) string {
+		if strings.ContainsAny(L.OptString(2, "r"), "wa+") {
+			return PermissionFSWrite
+		}
+		return PermissionFSRead
+	})
+	gated("lines", named(PermissionFSRead))
+	gated("input", named(PermissionFSRead))
+	gated("output", named(PermissionFSWrite))
+	if s.permissions[PermissionFSWrite] {
+		io.RawSetString("tmpfile", lib.RawGetString("tmpfile"))
+	}
+	if s.permissions[PermissionExec] {
+		io.RawSetString("popen", lib.RawGetString("popen"))
+	}
+	return io
+}
+
+// sandboxOS returns the os library as a plugin sees it: clocks, dates,
+// getenv and exit, plus the file functions with fs:write and the process
+// functions with exec
+func sandboxOS(L *lua.LState, s *sandbox) *lua.LTable {
+	lib, _ := L.GetField(L.G.Global, "os").(*lua.LTable)
+	os := L.NewTable()
+	if lib == nil {
+		return os
+	}
+	names := []string{"clock", "date", "difftime", "exit", "getenv", "setlocale", "time"}
+	if s.permissions[PermissionFSWrite] {
+		names = append(names, "remove", "rename", "tmpname")
+	}
+	if s.permissions[PermissionExec] {
+		names = append(names, "execute", "setenv")
+	}
+	for _, name := range names {
+		os.RawSetString(name, lib.RawGetString(name))
+	}
+	return os
+}
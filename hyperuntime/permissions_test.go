@@ -0,0 +1,101 @@
+package hyperuntime
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPluginPermissions(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "data.txt")
+	if err := os.WriteFile(file, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each function runs a capability from inside the plugin and returns
+	// what it got, or the error it raised
+	plugin := `
+local M = {}
+local function try(fn, ...)
+    local ok, result = pcall(fn, ...)
+    if ok then return tostring(result) end
+    return "error: " .. tostring(result)
+end
+function M.read(path) return try(function() local f = io.open(path) local s = f:read("*a") f:close() return s end) end
+function M.write(path) return try(function() return io.open(path, "w") ~= nil end) end
+function M.kv(path) return try(function() return require("kv").open(path) ~= nil end) end
+function M.dial() return try(function() return require("http").get("http://127.0.0.1:1/") end) end
+function M.listen() return try(function() return require("http").newServer() end) end
+function M.wrapped(path) return try(function() coroutine.wrap(require("kv").open)(path) return "ok" end) end
+function M.loaded() return try(loadstring("return io.popen == nil and os.execute == nil")) end
+function M.hidden()
+    return tostring(debug) .. " " .. tostring(package) .. " " .. tostring(getmetatable(_G)) .. " " ..
+        tostring(getfenv(print) == _G) .. " " .. tostring(_G.io == io) .. " " .. tostring(require("os") == os) ..
+        " " .. try(require, "debug")
+end
+return M
+`
+	files := fstest.MapFS{"plugin.lua": {Data: []byte(plugin)}}
+
+	L := NewState("test.lua", nil)
+	defer L.Close()
+	if err := RegisterLuaPlugin(L, "none", "plugin.lua", files, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterLuaPlugin(L, "granted", "plugin.lua", files, []string{PermissionFSRead, PermissionKV}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterLuaPlugin(L, "bad", "plugin.lua", files, []string{"fs:delete"}, nil); err == nil {
+		t.Errorf("Expected an unknown permission to be rejected")
+	}
+
+	results := map[string]string{}
+	run := func(name, code string) {
+		t.Helper()
+		if err := L.DoString("result = " + code); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		results[name] = L.GetGlobal("result").String()
+	}
+	path := filepath.ToSlash(file)
+	kvPath := filepath.ToSlash(filepath.Join(dir, "data.db"))
+	for _, name := range []string{"none", "granted"} {
+		run(name+".read", `require("`+name+`").read("`+path+`")`)
+		run(name+".write", `require("`+name+`").write("`+path+`")`)
+		run(name+".kv", `require("`+name+`").kv("`+kvPath+`.`+name+`")`)
+		run(name+".dial", `require("`+name+`").dial()`)
+		run(name+".listen", `require("`+name+`").listen()`)
+		run(name+".wrapped", `require("`+name+`").wrapped("`+kvPath+`.wrapped.`+name+`")`)
+		run(name+".loaded", `require("`+name+`").loaded()`)
+		run(name+".hidden", `require("`+name+`").hidden()`)
+	}
+	// The script itself is not restricted
+	run("script.kv", `tostring(require("kv").open("`+kvPath+`.script") ~= nil) .. " " .. tostring(io.popen ~= nil)`)
+
+	want := map[string]string{
+		"none.read":       "plugin none does not have the fs:read permission",
+		"none.write":      "plugin none does not have the fs:write permission",
+		"none.kv":         "plugin none does not have the kv permission",
+		"none.dial":       "plugin none does not have the net:dial permission",
+		"none.listen":     "plugin none does not have the net:listen permission",
+		"none.wrapped":    "plugin none does not have the kv permission",
+		"none.loaded":     "true",
+		"none.hidden":     "nil nil false true true true error: none/plugin.lua:4: plugin none cannot require debug",
+		"granted.read":    "hello",
+		"granted.write":   "plugin granted does not have the fs:write permission",
+		"granted.kv":      "true",
+		"granted.dial":    "plugin granted does not have the net:dial permission",
+		"granted.wrapped": "ok",
+		"granted.loaded":  "true",
+		"script.kv":       "true true",
+	}
+	for name, want := range want {
+		got := results[name]
+		if !strings.Contains(got, want) {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// plugins.go - Registration of Lua plugins and of Go plugins compiled into
+// built executables
+package hyperuntime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// Plugin API versions the runtime loads Go plugins of; see hype/pluginsdk.
+// The runtime does not import the SDK, since a Go plugin built with
+// -buildmode=plugin cannot share a package with the hype binary loading
+// it, so plugins are matched by their method sets below.
+const (
+	PluginAPIVersion    = 1 // pluginsdk.APIVersion
+	MinPluginAPIVersion = 1
+)
+
+// luaRegistrar is the part of the plugin interface the runtime needs
+type luaRegistrar interface {
+	Register(L *lua.LState) error
+}
+
+// apiVersioner is implemented by plugins written against hype/pluginsdk.
+// Plugins written before it copied an interface of their own and do not
+// report an API version.
+type apiVersioner interface {
+	APIVersion() int
+}
+
+// pluginInitializer is implemented by Go plugins that take the config block
+// of their entry in hype.yaml. Init is called before Register.
+type pluginInitializer interface {
+	Init(config map[string]interface{}) error
+}
+
+// pluginShutdowner is implemented by Go plugins that need to release
+// resources or flush state when the script finishes or is interrupted
+type pluginShutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// CheckPluginAPI checks that the runtime supports the plugin API version a
+// Go plugin instance reports. Plugins without an APIVersion method predate
+// the SDK and are accepted; LegacyGoPlugin tells them apart.
+func CheckPluginAPI(name string, plugin interface{}) error {
+	versioner, ok := plugin.(apiVersioner)
+	if !ok {
+		return nil
+	}
+	version := versioner.APIVersion()
+	if version < MinPluginAPIVersion || version > PluginAPIVersion {
+		return fmt.Errorf("plugin %s uses plugin API version %d, but this hype supports versions %d to %d", name, version, MinPluginAPIVersion, PluginAPIVersion)
+	}
+	return nil
+}
+
+// LegacyGoPlugin reports whether a Go plugin instance was written without
+// hype/pluginsdk
+func LegacyGoPlugin(plugin interface{}) bool {
+	_, ok := plugin.(apiVersioner)
+	return !ok
+}
+
+// RegisterGoPlugin initializes a Go plugin instance, as returned by the
+// plugin's NewPlugin function, with its config and registers its modules
+// with L. Its Shutdown method, if it has one, runs on ShutdownPlugins.
+func RegisterGoPlugin(L *lua.LState, name string, plugin interface{}, config map[string]interface{}) error {
+	registrar, ok := plugin.(luaRegistrar)
+	if !ok {
+		return fmt.Errorf("plugin %s does not implement Register(*lua.LState) error", name)
+	}
+	if err := CheckPluginAPI(name, plugin); err != nil {
+		return err
+	}
+	if initializer, ok := plugin.(pluginInitializer); ok {
+		if err := initializer.Init(configOrEmpty(config)); err != nil {
+			return fmt.Errorf("plugin %s: init: %w", name, err)
+		}
+	}
+	if err := registrar.Register(L); err != nil {
+		return err
+	}
+	if shutdowner, ok := plugin.(pluginShutdowner); ok {
+		OnPluginShutdown(L, name, shutdowner.Shutdown)
+	}
+	return nil
+}
+
+// ParsePluginConfig decodes a plugin's config block, which built
+// executables embed as JSON. It panics on invalid JSON, which hype build
+// does not generate.
+func ParsePluginConfig(data string) map[string]interface{} {
+	if data == "" {
+		return nil
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		panic(fmt.Sprintf("invalid plugin config: %v", err))
+	}
+	return config
+}
+
+// RegisterLuaPlugin makes the Lua plugin whose directory is files available
+// to require in L. The main file is the module name; every other Lua file is
+// a module in the plugin's namespace, so lib/style.lua is name.lib.style and
+// lib/init.lua is name.lib.
+//
+// Plugin files run in L itself with an environment of their own that reads
+// and writes globals through to _G, sandboxed to the plugin's permissions;
+// see newSandboxEnv. Inside the plugin, require looks in the plugin's own
+// files first, so require("lib.style") works whatever name the plugin was
+// registered under.
+//
+// When the main file returns a table with an init function, init is called
+// with config as a table the first time the plugin is required. A shutdown
+// function in the same table runs on ShutdownPlugins.
+func RegisterLuaPlugin(L *lua.LState, name, main string, files fs.FS, permissions []string, config map[string]interface{}) error {
+	if err := ValidatePermissions(permissions); err != nil {
+		return fmt.Errorf("plugin %s: %w", name, err)
+	}
+	if _, err := fs.Stat(files, main); err != nil {
+		return fmt.Errorf("plugin %s: main file %s not found", name, main)
+	}
+
+	// modules maps module names inside the plugin to files
+	modules := map[string]string{}
+	err := fs.WalkDir(files, ".", func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(file) != ".lua" || file == main {
+			return err
+		}
+		module := strings.ReplaceAll(strings.TrimSuffix(file, ".lua"), "/", ".")
+		if module == "init" {
+			return nil
+		}
+		module = strings.TrimSuffix(module, ".init")
+		if _, taken := modules[module]; !taken || path.Base(file) != "init.lua" {
+			modules[module] = file
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("plugin %s: %w", name, err)
+	}
+
+	globals := L.G.Global
+	env := newSandboxEnv(L, name, permissions)
+	env.RawSetString("require", L.NewFunction(func(L *lua.LState) int {
+		module := L.CheckString(1)
+		switch module {
+		case "_G", "io", "os":
+			L.Push(env.RawGetString(module))
+			return 1
+		case "debug", "package":
+			L.RaiseError("plugin %s cannot require %s", name, module)
+		}
+		if _, ok := modules[module]; ok {
+			module = name + "." + module
+		}
+		L.Push(L.GetField(globals, "require"))
+		L.Push(lua.LString(module))
+		L.Call(1, 1)
+		return 1
+	}))
+
+	load := func(file string) lua.LGFunction {
+		return func(L *lua.LState) int {
+			data, err := fs.ReadFile(files, file)
+			if err != nil {
+				L.RaiseError("plugin %s: %v", name, err)
+			}
+			fn, err := L.Load(strings.NewReader(string(data)), name+"/"+file)
+			if err != nil {
+				L.RaiseError("plugin %s: %v", name, err)
+			}
+			L.SetFEnv(fn, env)
+			L.Push(fn)
+			L.Push(L.Get(1))
+			L.Call(1, 1)
+			return 1
+		}
+	}
+
+	// The plugin may first be required from a coroutine, but shuts down
+	// in the state it was registered with
+	host := L
+	loadMain := load(main)
+	L.PreloadModule(name, func(L *lua.LState) int {
+		loadMain(L)
+		module, ok := L.Get(-1).(*lua.LTable)
+		if !ok {
+			return 1
+		}
+		if init, ok := module.RawGetString("init").(*lua.LFunction); ok {
+			L.Push(init)
+			L.Push(goToLua(L, configOrEmpty(config)))
+			L.Call(1, 0)
+		}
+		if shutdown, ok := module.RawGetString("shutdown").(*lua.LFunction); ok {
+			OnPluginShutdown(L, name, func(ctx context.Context) error {
+				return host.CallByParam(lua.P{Fn: shutdown, NRet: 0, Protect: true})
+			})
+		}
+		return 1
+	})
+	for module, file := range modules {
+		L.PreloadModule(name+"."+module, load(file))
+	}
+	return nil
+}
+
+// LuaToGo converts a Lua value to the JSON-compatible Go value used for
+// plugin arguments: nil, bool, float64, string, []interface{} for sequences
+// and map[string]interface{} for other tables
+func LuaToGo(L *lua.LState, value lua.LValue) interface{} {
+	return luaValueToGo(L, value)
+}
+
+// GoToLua converts a JSON-compatible Go value, as returned by a plugin, to a
+// Lua value
+func GoToLua(L *lua.LState, value interface{}) lua.LValue {
+	return goToLua(L, value)
+}
+
+// configOrEmpty returns config, or an empty config for plugins without one
+func configOrEmpty(config map[string]interface{}) map[string]interface{} {
+	if config == nil {
+		return map[string]interface{}{}
+	}
+	return config
+}
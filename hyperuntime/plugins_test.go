@@ -0,0 +1,104 @@
+package hyperuntime
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestRegisterLuaPlugin(t *testing.T) {
+	files := fstest.MapFS{
+		"plugin.lua": {Data: []byte(`
+local name = ...
+local util = require("lib.util")
+local count = 0
+loaded_as = name
+return {
+    next = function() count = count + 1 return util.label(count) end,
+    util = util,
+}`)},
+		"lib/util.lua": {Data: []byte(`
+local fmt = require("lib.fmt")
+return {label = function(n) return fmt.prefix .. n end}`)},
+		"lib/fmt/init.lua": {Data: []byte(`return {prefix = "#"}`)},
+		"lib/broken.lua":   {Data: []byte(`error("broken")`)},
+	}
+
+	L := lua.NewState()
+	defer L.Close()
+	if err := RegisterLuaPlugin(L, "counter", "plugin.lua", files, nil, nil); err != nil {
+		t.Fatalf("RegisterLuaPlugin failed: %v", err)
+	}
+
+	script := `
+local counter = require("counter")
+first = counter.next()
+second = counter.next()
+same = tostring(require("counter.lib.util") == counter.util)
+fmt = require("counter.lib.fmt").prefix
+local ok, err = pcall(require, "counter.lib.broken")
+broken = err
+`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %v", err)
+	}
+
+	checks := map[string]string{
+		"first":     "#1",
+		"second":    "#2",
+		"same":      "true",
+		"fmt":       "#",
+		"loaded_as": "counter",
+	}
+	for name, want := range checks {
+		if got := L.GetGlobal(name).String(); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if broken := L.GetGlobal("broken").String(); !strings.Contains(broken, "counter/lib/broken.lua:1") {
+		t.Errorf("Expected the error to name the plugin file, got %q", broken)
+	}
+
+	// Plugin-relative names are private to the plugin
+	if err := L.DoString(`require("lib.util")`); err == nil {
+		t.Errorf("Expected lib.util to be unknown outside the plugin")
+	}
+
+	if err := RegisterLuaPlugin(L, "missing", "main.lua", files, nil, nil); err == nil {
+		t.Errorf("Expected a missing main file to be rejected")
+	}
+}
+
+// versionedPlugin reports a plugin API version
+type versionedPlugin struct{ version int }
+
+func (p versionedPlugin) APIVersion() int              { return p.version }
+func (p versionedPlugin) Register(L *lua.LState) error { return nil }
+
+// legacyPlugin predates the SDK and reports no version
+type legacyPlugin struct{}
+
+func (legacyPlugin) Register(L *lua.LState) error { return nil }
+
+func TestRegisterGoPluginAPIVersion(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	for _, plugin := range []interface{}{versionedPlugin{PluginAPIVersion}, versionedPlugin{MinPluginAPIVersion}, legacyPlugin{}} {
+		if err := RegisterGoPlugin(L, "ok", plugin, nil); err != nil {
+			t.Errorf("RegisterGoPlugin(%#v) failed: %v", plugin, err)
+		}
+	}
+	if !LegacyGoPlugin(legacyPlugin{}) || LegacyGoPlugin(versionedPlugin{}) {
+		t.Errorf("LegacyGoPlugin does not tell plugins without APIVersion apart")
+	}
+
+	for _, version := range []int{MinPluginAPIVersion - 1, PluginAPIVersion + 1} {
+		err := RegisterGoPlugin(L, "odd", versionedPlugin{version}, nil)
+		if err == nil || !strings.Contains(err.Error(), "plugin odd uses plugin API version") {
+			t.Errorf("version %d: error = %v", version, err)
+		}
+	}
+}
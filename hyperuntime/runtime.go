@@ -0,0 +1,63 @@
+// Package hyperuntime is the Lua runtime shared by `hype run`, the REPL and
+// every executable produced by `hype build`. The builder embeds this package's
+// source and compiles it into the generated program, so scripts behave the same
+// in both modes.
+package hyperuntime
+
+import (
+	"github.com/yuin/gopher-lua"
+)
+
+// NewState creates a Lua state with the standard libraries, the arg table
+// and all built-in hype modules registered
+func NewState(scriptPath string, scriptArgs []string) *lua.LState {
+	L := lua.NewState()
+
+	OpenStandardLibs(L)
+	SetupCommandLineArgs(L, scriptPath, scriptArgs)
+	RegisterModules(L)
+
+	return L
+}
+
+// OpenStandardLibs preloads the standard Lua libraries
+func OpenStandardLibs(L *lua.LState) {
+	L.PreloadModule("_G", lua.OpenBase)
+	L.PreloadModule("package", lua.OpenPackage)
+	L.PreloadModule("coroutine", lua.OpenCoroutine)
+	L.PreloadModule("table", lua.OpenTable)
+	L.PreloadModule("io", lua.OpenIo)
+	L.PreloadModule("os", lua.OpenOs)
+	L.PreloadModule("string", lua.OpenString)
+	L.PreloadModule("math", lua.OpenMath)
+	L.PreloadModule("debug", lua.OpenDebug)
+}
+
+// RegisterModules registers all built-in hype modules
+func RegisterModules(L *lua.LState) {
+	RegisterHTTPModule(L)
+	registerKVModule(L)
+	registerTUIFunctions(L)
+	registerCryptoModule(L)
+	registerHTTPSigModule(L)
+	registerWebSocketModule(L)
+	RegisterAssetsModule(L, nil)
+	RegisterHypeModule(L, BuildInfo{Mode: ModeRun})
+}
+
+// SetupCommandLineArgs sets the global arg table
+func SetupCommandLineArgs(L *lua.LState, scriptPath string, scriptArgs []string) {
+	// Create arg table (following Lua convention)
+	argTable := L.NewTable()
+
+	// arg[0] is the script name (standard Lua convention)
+	argTable.RawSetInt(0, lua.LString(scriptPath))
+
+	// arg[1], arg[2], etc. are the script arguments
+	for i, arg := range scriptArgs {
+		argTable.RawSetInt(i+1, lua.LString(arg))
+	}
+
+	// Set global arg table
+	L.SetGlobal("arg", argTable)
+}
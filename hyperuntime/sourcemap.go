@@ -0,0 +1,83 @@
+// sourcemap.go - Mapping bundled script lines back to their source files
+package hyperuntime
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// SourceMap maps the lines of a bundled chunk to the files and lines they
+// were bundled from, so errors can point at the original sources
+type SourceMap struct {
+	Chunk    string          `json:"chunk"`    // Chunk name errors and tracebacks use
+	Sections []SourceSection `json:"sections"` // Sorted by Start, not overlapping
+}
+
+// SourceSection is a run of chunk lines copied from one file
+type SourceSection struct {
+	Start int    `json:"start"` // First chunk line
+	End   int    `json:"end"`   // Last chunk line
+	File  string `json:"file"`  // Source file, relative to the entry script
+	Line  int    `json:"line"`  // Line in File that Start came from
+}
+
+// Lookup returns the file and line a chunk line came from. Lines the
+// bundler generated are not found.
+func (m *SourceMap) Lookup(line int) (string, int, bool) {
+	if m == nil {
+		return "", 0, false
+	}
+	i := sort.Search(len(m.Sections), func(i int) bool { return m.Sections[i].End >= line })
+	if i == len(m.Sections) || m.Sections[i].Start > line {
+		return "", 0, false
+	}
+	section := m.Sections[i]
+	return section.File, section.Line + line - section.Start, true
+}
+
+// Rewrite replaces every chunk:line reference in text, as found in Lua
+// error messages and tracebacks, with the original file:line. References
+// only count at the start of text or after whitespace, a quote or a
+// bracket, so a chunk whose name merely ends in m.Chunk is left alone.
+func (m *SourceMap) Rewrite(text string) string {
+	if m == nil || m.Chunk == "" {
+		return text
+	}
+	pattern := regexp.MustCompile(`(^|[\s"'(\[<])` + regexp.QuoteMeta(m.Chunk) + `:(\d+)`)
+	return pattern.ReplaceAllStringFunc(text, func(ref string) string {
+		match := pattern.FindStringSubmatch(ref)
+		line, err := strconv.Atoi(match[2])
+		if err != nil {
+			return ref
+		}
+		if file, original, ok := m.Lookup(line); ok {
+			return match[1] + file + ":" + strconv.Itoa(original)
+		}
+		return ref
+	})
+}
+
+// RewriteError returns err with its message rewritten to the original
+// sources, or nil when err is nil
+func (m *SourceMap) RewriteError(err error) error {
+	if err == nil || m == nil {
+		return err
+	}
+	return errors.New(m.Rewrite(err.Error()))
+}
+
+// DoSource loads and runs a script under the given chunk name, like
+// L.DoString does under "<string>"
+func DoSource(L *lua.LState, source, chunkName string) error {
+	fn, err := L.Load(strings.NewReader(source), chunkName)
+	if err != nil {
+		return err
+	}
+	L.Push(fn)
+	return L.PCall(0, lua.MultRet, nil)
+}
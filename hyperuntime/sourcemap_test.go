@@ -0,0 +1,62 @@
+package hyperuntime
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestSourceMapRewrite(t *testing.T) {
+	m := &SourceMap{
+		Chunk: "main.lua",
+		Sections: []SourceSection{
+			{Start: 3, End: 10, File: "lib/util.lua", Line: 1},
+			{Start: 13, End: 20, File: "main.lua", Line: 1},
+		},
+	}
+
+	tests := map[string]string{
+		"main.lua:5: boom":                   "lib/util.lua:3: boom",
+		"main.lua:13: in main chunk":         "main.lua:1: in main chunk",
+		"in function <main.lua:4>":           "in function <lib/util.lua:2>",
+		"main.lua:1: generated":              "main.lua:1: generated",
+		"main.lua:11: after util":            "main.lua:11: after util",
+		"other.lua:5: untouched":             "other.lua:5: untouched",
+		"main.lua:20: a\n\tmain.lua:6: in f": "main.lua:8: a\n\tlib/util.lua:4: in f",
+		"lib/main.lua:3: elsewhere":          "lib/main.lua:3: elsewhere",
+		"in function <lib/main.lua:4>":       "in function <lib/main.lua:4>",
+		`error loading "main.lua:5"`:         `error loading "lib/util.lua:3"`,
+	}
+	for in, want := range tests {
+		if got := m.Rewrite(in); got != want {
+			t.Errorf("Rewrite(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	var nilMap *SourceMap
+	if got := nilMap.Rewrite("main.lua:5: x"); got != "main.lua:5: x" {
+		t.Errorf("nil map rewrote %q", got)
+	}
+	if nilMap.RewriteError(nil) != nil || m.RewriteError(nil) != nil {
+		t.Errorf("RewriteError(nil) should be nil")
+	}
+	if err := m.RewriteError(errors.New("main.lua:5: boom")); err.Error() != "lib/util.lua:3: boom" {
+		t.Errorf("RewriteError = %v", err)
+	}
+}
+
+func TestDoSourceChunkName(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	err := DoSource(L, "local x = 1\nerror('boom')", "app.lua")
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+	m := &SourceMap{Chunk: "app.lua", Sections: []SourceSection{{Start: 1, End: 2, File: "src/app.lua", Line: 1}}}
+	if got := m.RewriteError(err).Error(); !strings.HasPrefix(got, "src/app.lua:2: boom") {
+		t.Errorf("Unexpected error: %s", got)
+	}
+}
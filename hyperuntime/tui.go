@@ -0,0 +1,488 @@
+package hyperuntime
+
+import (
+	"context"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/yuin/gopher-lua"
+)
+
+// TUI Module
+func registerTUIFunctions(L *lua.LState) {
+	// Create TUI module
+	tuiModule := L.NewTable()
+	
+	// Basic TUI functions
+	L.SetField(tuiModule, "newApp", L.NewFunction(luaNewApp))
+	L.SetField(tuiModule, "newTextView", L.NewFunction(luaNewTextView))
+	L.SetField(tuiModule, "newInputField", L.NewFunction(luaNewInputField))
+	L.SetField(tuiModule, "newButton", L.NewFunction(luaNewButton))
+	L.SetField(tuiModule, "newFlex", L.NewFunction(luaNewFlex))
+	
+	L.SetGlobal("tui", tuiModule)
+	
+	// Set up metatables for TUI objects
+	setupTUIMetatables(L)
+}
+
+func setupTUIMetatables(L *lua.LState) {
+	// App metatable
+	appMT := L.NewTypeMetatable("App")
+	L.SetField(appMT, "__index", L.NewFunction(appIndex))
+	
+	// TextView metatable  
+	textViewMT := L.NewTypeMetatable("TextView")
+	L.SetField(textViewMT, "__index", L.NewFunction(textViewIndex))
+	
+	// InputField metatable
+	inputFieldMT := L.NewTypeMetatable("InputField")
+	L.SetField(inputFieldMT, "__index", L.NewFunction(inputFieldIndex))
+	
+	// Button metatable
+	buttonMT := L.NewTypeMetatable("Button")
+	L.SetField(buttonMT, "__index", L.NewFunction(buttonIndex))
+	
+	// Flex metatable
+	flexMT := L.NewTypeMetatable("Flex")
+	L.SetField(flexMT, "__index", L.NewFunction(flexIndex))
+	
+	// Event metatable
+	eventMT := L.NewTypeMetatable("Event")
+	L.SetField(eventMT, "__index", L.NewFunction(eventIndex))
+}
+
+// TUI Constructor Functions
+func luaNewApp(L *lua.LState) int {
+	app := tview.NewApplication()
+	ud := L.NewUserData()
+	ud.Value = app
+	L.SetMetatable(ud, L.GetTypeMetatable("App"))
+	L.Push(ud)
+	return 1
+}
+
+func luaNewTextView(L *lua.LState) int {
+	text := L.OptString(1, "")
+	textView := tview.NewTextView().SetText(text)
+	ud := L.NewUserData()
+	ud.Value = textView
+	L.SetMetatable(ud, L.GetTypeMetatable("TextView"))
+	L.Push(ud)
+	return 1
+}
+
+func luaNewInputField(L *lua.LState) int {
+	inputField := tview.NewInputField()
+	ud := L.NewUserData()
+	ud.Value = inputField
+	L.SetMetatable(ud, L.GetTypeMetatable("InputField"))
+	L.Push(ud)
+	return 1
+}
+
+func luaNewButton(L *lua.LState) int {
+	label := L.OptString(1, "")
+	button := tview.NewButton(label)
+	ud := L.NewUserData()
+	ud.Value = button
+	L.SetMetatable(ud, L.GetTypeMetatable("Button"))
+	L.Push(ud)
+	return 1
+}
+
+func luaNewFlex(L *lua.LState) int {
+	flex := tview.NewFlex()
+	ud := L.NewUserData()
+	ud.Value = flex
+	L.SetMetatable(ud, L.GetTypeMetatable("Flex"))
+	L.Push(ud)
+	return 1
+}
+
+// TUI Method Handlers
+func appIndex(L *lua.LState) int {
+	ud := L.CheckUserData(1)
+	app := ud.Value.(*tview.Application)
+	method := L.CheckString(2)
+	
+	switch method {
+	case "SetRoot":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			rootUD := L.CheckUserData(2)
+			fullscreen := L.OptBool(3, false)
+			
+			var root tview.Primitive
+			switch v := rootUD.Value.(type) {
+			case *tview.TextView:
+				root = v
+			case *tview.InputField:
+				root = v
+			case *tview.Button:
+				root = v
+			case *tview.Flex:
+				root = v
+			default:
+				L.ArgError(2, "expected tview primitive")
+				return 0
+			}
+			
+			app.SetRoot(root, fullscreen)
+			return 0
+		}))
+	case "Run":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			unregister := onShutdown(L, func(ctx context.Context) error {
+				app.Stop()
+				return nil
+			})
+			defer unregister()
+
+			if err := app.Run(); err != nil {
+				L.Push(lua.LString(err.Error()))
+				return 1
+			}
+			return 0
+		}))
+	case "Stop":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			app.Stop()
+			return 0
+		}))
+	case "Draw":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			app.QueueUpdateDraw(func() {})
+			return 0
+		}))
+	case "SetFocus":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			primitiveUD := L.CheckUserData(2)
+			app.SetFocus(primitiveUD.Value.(tview.Primitive))
+			return 0
+		}))
+	case "SetInputCapture":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			fn := L.CheckFunction(2)
+			app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+				L.Push(fn)
+				ud := L.NewUserData()
+				ud.Value = event
+				L.SetMetatable(ud, L.GetTypeMetatable("Event"))
+				L.Push(ud)
+				L.Call(1, 1)
+				result := L.Get(-1)
+				L.Pop(1)
+				if result == lua.LNil {
+					return nil
+				}
+				return event
+			})
+			return 0
+		}))
+	}
+	
+	return 1
+}
+
+func textViewIndex(L *lua.LState) int {
+	ud := L.CheckUserData(1)
+	textView := ud.Value.(*tview.TextView)
+	method := L.CheckString(2)
+	
+	switch method {
+	case "SetText":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			text := L.CheckString(2)
+			textView.SetText(text)
+			return 0
+		}))
+	case "GetText":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			text := textView.GetText(false)
+			L.Push(lua.LString(text))
+			return 1
+		}))
+	case "SetWrap":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			wrap := L.CheckBool(2)
+			textView.SetWrap(wrap)
+			return 0
+		}))
+	case "SetWordWrap":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			wordWrap := L.CheckBool(2)
+			textView.SetWordWrap(wordWrap)
+			return 0
+		}))
+	case "SetTitle":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			title := L.CheckString(2)
+			textView.SetTitle(title)
+			return 0
+		}))
+	case "SetTextColor":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			color := L.CheckInt(2)
+			textView.SetTextColor(tcell.Color(color))
+			return 0
+		}))
+	case "SetDynamicColors":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			enable := L.CheckBool(2)
+			textView.SetDynamicColors(enable)
+			return 0
+		}))
+	case "SetBorder":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			enable := L.CheckBool(2)
+			textView.SetBorder(enable)
+			return 0
+		}))
+	case "SetBorderColor":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			color := L.CheckInt(2)
+			textView.SetBorderColor(tcell.Color(color))
+			return 0
+		}))
+	case "SetBackgroundColor":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			color := L.CheckInt(2)
+			textView.SetBackgroundColor(tcell.Color(color))
+			return 0
+		}))
+	case "SetRegions":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			enable := L.CheckBool(2)
+			textView.SetRegions(enable)
+			return 0
+		}))
+	case "SetScrollable":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			enable := L.CheckBool(2)
+			textView.SetScrollable(enable)
+			return 0
+		}))
+	}
+	
+	return 1
+}
+
+func inputFieldIndex(L *lua.LState) int {
+	ud := L.CheckUserData(1)
+	inputField := ud.Value.(*tview.InputField)
+	method := L.CheckString(2)
+	
+	switch method {
+	case "SetLabel":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			label := L.CheckString(2)
+			inputField.SetLabel(label)
+			return 0
+		}))
+	case "SetPlaceholder":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			placeholder := L.CheckString(2)
+			inputField.SetPlaceholder(placeholder)
+			return 0
+		}))
+	case "GetText":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			text := inputField.GetText()
+			L.Push(lua.LString(text))
+			return 1
+		}))
+	case "SetText":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			text := L.CheckString(2)
+			inputField.SetText(text)
+			return 0
+		}))
+	case "SetDoneFunc":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			fn := L.CheckFunction(2)
+			inputField.SetDoneFunc(func(key tcell.Key) {
+				L.Push(fn)
+				L.Push(lua.LNumber(int(key)))
+				L.Call(1, 0)
+			})
+			return 0
+		}))
+	case "SetBorder":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			enable := L.CheckBool(2)
+			inputField.SetBorder(enable)
+			return 0
+		}))
+	case "SetBorderColor":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			color := L.CheckInt(2)
+			inputField.SetBorderColor(tcell.Color(color))
+			return 0
+		}))
+	case "SetFieldBackgroundColor":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			color := L.CheckInt(2)
+			inputField.SetFieldBackgroundColor(tcell.Color(color))
+			return 0
+		}))
+	case "SetFieldTextColor":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			color := L.CheckInt(2)
+			inputField.SetFieldTextColor(tcell.Color(color))
+			return 0
+		}))
+	case "SetTitle":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			title := L.CheckString(2)
+			inputField.SetTitle(title)
+			return 0
+		}))
+	}
+	
+	return 1
+}
+
+func buttonIndex(L *lua.LState) int {
+	ud := L.CheckUserData(1)
+	button := ud.Value.(*tview.Button)
+	method := L.CheckString(2)
+	
+	switch method {
+	case "SetLabel":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			label := L.CheckString(2)
+			button.SetLabel(label)
+			return 0
+		}))
+	case "SetSelectedFunc":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			fn := L.CheckFunction(2)
+			button.SetSelectedFunc(func() {
+				L.Push(fn)
+				L.Call(0, 0)
+			})
+			return 0
+		}))
+	case "SetBorder":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			enable := L.CheckBool(2)
+			button.SetBorder(enable)
+			return 0
+		}))
+	case "SetBorderColor":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			color := L.CheckInt(2)
+			button.SetBorderColor(tcell.Color(color))
+			return 0
+		}))
+	case "SetBackgroundColor":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			color := L.CheckInt(2)
+			button.SetBackgroundColor(tcell.Color(color))
+			return 0
+		}))
+	case "SetLabelColor":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			color := L.CheckInt(2)
+			button.SetLabelColor(tcell.Color(color))
+			return 0
+		}))
+	case "SetTitle":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			title := L.CheckString(2)
+			button.SetTitle(title)
+			return 0
+		}))
+	}
+	
+	return 1
+}
+
+func flexIndex(L *lua.LState) int {
+	ud := L.CheckUserData(1)
+	flex := ud.Value.(*tview.Flex)
+	method := L.CheckString(2)
+	
+	switch method {
+	case "SetDirection":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			direction := L.CheckInt(2)
+			flex.SetDirection(direction)
+			return 0
+		}))
+	case "AddItem":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			itemUD := L.CheckUserData(2)
+			fixedSize := L.CheckInt(3)
+			proportion := L.CheckInt(4)
+			focus := L.CheckBool(5)
+			
+			var item tview.Primitive
+			switch v := itemUD.Value.(type) {
+			case *tview.TextView:
+				item = v
+			case *tview.InputField:
+				item = v
+			case *tview.Button:
+				item = v
+			case *tview.Flex:
+				item = v
+			default:
+				L.ArgError(2, "expected tview primitive")
+				return 0
+			}
+			
+			flex.AddItem(item, fixedSize, proportion, focus)
+			return 0
+		}))
+	case "SetBorder":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			enable := L.CheckBool(2)
+			flex.SetBorder(enable)
+			return 0
+		}))
+	case "SetBorderColor":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			color := L.CheckInt(2)
+			flex.SetBorderColor(tcell.Color(color))
+			return 0
+		}))
+	case "SetTitle":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			title := L.CheckString(2)
+			flex.SetTitle(title)
+			return 0
+		}))
+	case "SetBackgroundColor":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			color := L.CheckInt(2)
+			flex.SetBackgroundColor(tcell.Color(color))
+			return 0
+		}))
+	}
+	
+	return 1
+}
+
+func eventIndex(L *lua.LState) int {
+	ud := L.CheckUserData(1)
+	event := ud.Value.(*tcell.EventKey)
+	method := L.CheckString(2)
+	
+	switch method {
+	case "Key":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			key := event.Key()
+			L.Push(lua.LNumber(key))
+			return 1
+		}))
+	case "Rune":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			r := event.Rune()
+			L.Push(lua.LNumber(r))
+			return 1
+		}))
+	}
+	
+	return 1
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"hype/hyperuntime"
+)
+
+// projectTemplates holds the skeletons `hype init` writes. Every file is a
+// text/template ending in .tmpl; _common is shared by all templates and a
+// template's own file wins when both have one.
+//
+//go:embed all:templates
+var projectTemplates embed.FS
+
+const (
+	templatesDir       = "templates"
+	commonTemplateName = "_common"
+	templateSuffix     = ".tmpl"
+)
+
+// projectNamePattern restricts project names to ones that are valid as a
+// directory, executable, Lua module and Go module name
+var projectNamePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]*$`)
+
+// TemplateData is the data project templates are rendered with
+type TemplateData struct {
+	Name       string // Project name, e.g. "my-plugin"
+	GoName     string // Exported Go identifier, e.g. "MyPlugin"
+	GoIdent    string // Unexported Go identifier, e.g. "myPlugin"
+	APIVersion int    // Plugin API version Go plugins are written for
+	GoVersion  string // Go version of hype's go.mod, which Go plugins need at least
+	LuaVersion string // gopher-lua version hype is built with
+}
+
+// listProjectTemplates returns the names of the available templates
+func listProjectTemplates() []string {
+	entries, err := projectTemplates.ReadDir(templatesDir)
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name() != commonTemplateName {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// initProject writes the named template into dir. The project is named
+// after the directory.
+func initProject(dir, templateName string) error {
+	if templateName == "" || templateName == commonTemplateName {
+		return fmt.Errorf("unknown template %q (available: %s)", templateName, strings.Join(listProjectTemplates(), ", "))
+	}
+	if _, err := fs.Stat(projectTemplates, path.Join(templatesDir, templateName)); err != nil {
+		return fmt.Errorf("unknown template %q (available: %s)", templateName, strings.Join(listProjectTemplates(), ", "))
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(absDir)
+	if !projectNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid project name %q: use letters, digits, '-' and '_', starting with a letter", name)
+	}
+
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return fmt.Errorf("directory %s already exists and is not empty", dir)
+	}
+
+	files := make(map[string]string)
+	for _, source := range []string{commonTemplateName, templateName} {
+		root := path.Join(templatesDir, source)
+		err := fs.WalkDir(projectTemplates, root, func(name string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel := strings.TrimSuffix(strings.TrimPrefix(name, root+"/"), templateSuffix)
+			files[rel] = name
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read template %s: %w", source, err)
+		}
+	}
+
+	hypeMod, err := runtimeSources.ReadFile("go.mod")
+	if err != nil {
+		return err
+	}
+	data := TemplateData{
+		Name:       name,
+		GoName:     goIdentifier(name, true),
+		GoIdent:    goIdentifier(name, false),
+		APIVersion: hyperuntime.PluginAPIVersion,
+		GoVersion:  goModDirective(hypeMod, "go"),
+		LuaVersion: goModRequirement(hypeMod, "github.com/yuin/gopher-lua"),
+	}
+
+	rels := make([]string, 0, len(files))
+	for rel := range files {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+
+	for _, rel := range rels {
+		content, err := renderProjectTemplate(files[rel], data)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		if err := os.WriteFile(target, content, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", target, err)
+		}
+		fmt.Printf("  created %s\n", filepath.Join(dir, filepath.FromSlash(rel)))
+	}
+
+	return nil
+}
+
+// renderProjectTemplate renders one embedded template file
+func renderProjectTemplate(name string, data TemplateData) ([]byte, error) {
+	source, err := projectTemplates.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template %s: %w", name, err)
+	}
+
+	tmpl, err := template.New(path.Base(name)).Parse(string(source))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render template %s: %w", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// goIdentifier turns a project name such as "my-plugin" into a Go
+// identifier: "MyPlugin" when exported, "myPlugin" otherwise
+func goIdentifier(name string, exported bool) string {
+	var b strings.Builder
+	upper := exported
+	for i, r := range name {
+		switch {
+		case r == '-' || r == '_':
+			upper = i > 0 || exported
+		case upper:
+			b.WriteString(strings.ToUpper(string(r)))
+			upper = false
+		case i == 0 && !exported:
+			b.WriteString(strings.ToLower(string(r)))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
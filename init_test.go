@@ -0,0 +1,117 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInitProjectTemplates(t *testing.T) {
+	templates := listProjectTemplates()
+	if len(templates) == 0 {
+		t.Fatalf("No project templates embedded")
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, templateName := range templates {
+		t.Run(templateName, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "my-"+templateName)
+			if err := initProject(dir, templateName); err != nil {
+				t.Fatalf("initProject failed: %v", err)
+			}
+
+			if _, err := os.Stat(filepath.Join(dir, ".gitignore")); err != nil {
+				t.Errorf("Missing .gitignore: %v", err)
+			}
+
+			project, err := LoadProject(filepath.Join(dir, projectFileName))
+			if err != nil {
+				t.Fatalf("Generated %s is invalid: %v", projectFileName, err)
+			}
+			entry, err := project.EntryPath()
+			if err != nil {
+				t.Fatalf("Generated %s has no entry: %v", projectFileName, err)
+			}
+			if _, err := os.Stat(entry); err != nil {
+				t.Fatalf("Entry script missing: %v", err)
+			}
+
+			testScript := filepath.Join("test", "app_test.lua")
+			if manifest, err := NewPluginRegistry().loadManifest(dir); err == nil {
+				testScript = filepath.Join("test", "plugin_test.lua")
+				if manifest.Name != "my-"+templateName {
+					t.Errorf("Plugin manifest name = %q", manifest.Name)
+				}
+				if _, err := os.Stat(filepath.Join(dir, manifest.Main)); err != nil {
+					t.Fatalf("Plugin main file missing: %v", err)
+				}
+				if manifest.Type == "go" {
+					if _, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, manifest.Main), nil, 0); err != nil {
+						t.Fatalf("Generated plugin.go does not parse: %v", err)
+					}
+					// Running the sample test needs a cgo plugin build
+					return
+				}
+			}
+
+			// Sample tests resolve modules relative to the project directory
+			if err := os.Chdir(dir); err != nil {
+				t.Fatal(err)
+			}
+			defer os.Chdir(wd)
+
+			options := RunOptions{EmbedDirs: project.EmbedDirs(), Defines: project.DefineValues()}
+			if err := runScriptWithOptions(testScript, nil, project.PluginSpecs(), options); err != nil {
+				t.Fatalf("Sample test failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestInitProjectErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := initProject(filepath.Join(dir, "app"), "nope"); err == nil {
+		t.Errorf("Expected an error for an unknown template")
+	}
+	if err := initProject(filepath.Join(dir, "9lives"), "tui"); err == nil {
+		t.Errorf("Expected an error for an invalid project name")
+	}
+
+	existing := filepath.Join(dir, "existing")
+	if err := os.MkdirAll(existing, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(existing, "main.lua"), []byte("print(1)"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := initProject(existing, "tui"); err == nil {
+		t.Errorf("Expected an error for a non-empty directory")
+	}
+}
+
+func TestGoIdentifier(t *testing.T) {
+	tests := []struct {
+		name     string
+		exported bool
+		want     string
+	}{
+		{"lmdb", true, "Lmdb"},
+		{"lmdb", false, "lmdb"},
+		{"my-plugin", true, "MyPlugin"},
+		{"my-plugin", false, "myPlugin"},
+		{"Fast_kv", false, "fastKv"},
+	}
+
+	for _, tt := range tests {
+		if got := goIdentifier(tt.name, tt.exported); got != tt.want {
+			t.Errorf("goIdentifier(%q, %v) = %q, want %q", tt.name, tt.exported, got, tt.want)
+		}
+	}
+}
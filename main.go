@@ -1,8 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"hype/hyperuntime"
 
 	"github.com/spf13/cobra"
 )
@@ -26,14 +32,56 @@ cross-platform executable applications with TUI support.`, version),
 var buildCmd = &cobra.Command{
 	Use:   "build [lua-script]",
 	Short: "Build a Lua script into an executable (auto-bundles dependencies)",
-	Args:  cobra.ExactArgs(1),
+	Long: `Build a Lua script into an executable, bundling its dependencies.
+
+With no script argument the entry, output, targets, plugins, embedded
+directories and defines come from hype.yaml in the current directory.
+Flags override the manifest.`,
+	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		scriptPath := args[0]
+		project, scriptPath, err := loadProjectScript(cmd, args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 		outputName, _ := cmd.Flags().GetString("output")
 		target, _ := cmd.Flags().GetString("target")
 		pluginsFlag, _ := cmd.Flags().GetStringSlice("plugins")
 		pluginConfig, _ := cmd.Flags().GetString("plugins-config")
+		mode, _ := cmd.Flags().GetString("mode")
+		stubDir, _ := cmd.Flags().GetString("stub-dir")
+		bytecode, _ := cmd.Flags().GetBool("bytecode")
+		embedDirs, _ := cmd.Flags().GetStringArray("embed")
+		noCache, _ := cmd.Flags().GetBool("no-cache")
+		defineFlags, _ := cmd.Flags().GetStringArray("define")
+		locked, _ := cmd.Flags().GetBool("locked")
 		
+		var defines map[string]string
+		var trustedKeys string
+		var requireSigned bool
+		luaPaths := luaSearchPaths(".", nil)
+		lockDir := pluginLockDir(project, locked)
+		if project != nil {
+			luaPaths = project.LuaPaths()
+			if outputName == "" {
+				outputName = project.OutputName()
+			}
+			if !cmd.Flags().Changed("target") && len(project.Targets) > 0 {
+				target = project.TargetSpec()
+			}
+			if !cmd.Flags().Changed("embed") {
+				embedDirs = project.EmbedDirs()
+			}
+			defines = project.DefineValues()
+			trustedKeys, requireSigned = project.TrustedKeysPath(), project.RequireSignedPlugins()
+			fmt.Printf("Using project %s %s\n", project.Name, project.Version)
+		}
+		defines, err = mergeDefines(defines, defineFlags)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
 		fmt.Printf("Building %s into executable %s for %s\n", scriptPath, outputName, target)
 		
 		// Load plugins
@@ -42,8 +90,12 @@ var buildCmd = &cobra.Command{
 			fmt.Fprintf(os.Stderr, "Error loading plugin specs: %v\n", err)
 			os.Exit(1)
 		}
+		if project != nil {
+			pluginSpecs = mergePluginSpecs(project.PluginSpecs(), pluginSpecs)
+		}
 		
-		if err := buildExecutableWithPlugins(scriptPath, outputName, target, pluginSpecs); err != nil {
+		options := BuildOptions{Mode: mode, StubDir: stubDir, Bytecode: bytecode, EmbedDirs: embedDirs, Defines: defines, NoCache: noCache, LuaPaths: luaPaths, LockDir: lockDir, Locked: locked, TrustedKeys: trustedKeys, RequireSigned: requireSigned}
+		if err := buildExecutableWithOptions(scriptPath, outputName, target, pluginSpecs, options); err != nil {
 			fmt.Fprintf(os.Stderr, "Error building executable: %v\n", err)
 			os.Exit(1)
 		}
@@ -56,19 +108,40 @@ var runCmd = &cobra.Command{
 	Long:  `Run a Lua script directly without building an executable. Useful for development and testing.
 
 Any arguments after '--' are passed to the Lua script as command line arguments.
+With no script argument the entry script, plugins, embedded directories and
+defines come from hype.yaml in the current directory.
 
 Examples:
   hype run server.lua
   hype run server.lua -- --port 8080 --dir ./public
   hype run server.lua --plugins fs@1.0.0
   hype run server.lua --plugins fs,http-utils@2.1.0
-  hype run server.lua --plugins myfs=./path/to/plugin@1.2.0`,
-	Args:  cobra.MinimumNArgs(1),
+  hype run server.lua --plugins myfs=./path/to/plugin@1.2.0
+  hype run server.lua --embed ./public
+  hype run server.lua --watch
+  hype run server.lua --define API_URL=http://localhost:8080
+  hype run -- --port 8080`,
+	Args: cobra.ArbitraryArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		scriptPath := args[0]
-		scriptArgs := args[1:] // Pass remaining args to script
+		// Without a script before '--' every argument belongs to the script
+		var scriptArgs []string
+		if cmd.ArgsLenAtDash() == 0 {
+			args, scriptArgs = nil, args
+		} else if len(args) > 0 {
+			args, scriptArgs = args[:1], args[1:]
+		}
+
+		project, scriptPath, err := loadProjectScript(cmd, args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 		pluginsFlag, _ := cmd.Flags().GetStringSlice("plugins")
 		pluginConfig, _ := cmd.Flags().GetString("plugins-config")
+		embedDirs, _ := cmd.Flags().GetStringArray("embed")
+		watch, _ := cmd.Flags().GetBool("watch")
+		defineFlags, _ := cmd.Flags().GetStringArray("define")
+		locked, _ := cmd.Flags().GetBool("locked")
 		
 		// Load plugins
 		pluginSpecs, err := loadPluginSpecs(pluginsFlag, pluginConfig)
@@ -77,7 +150,34 @@ Examples:
 			os.Exit(1)
 		}
 		
-		if err := runScriptWithPlugins(scriptPath, scriptArgs, pluginSpecs); err != nil {
+		options := RunOptions{EmbedDirs: embedDirs, LuaPaths: luaSearchPaths(".", nil), LockDir: pluginLockDir(project, locked), Locked: locked}
+		if project != nil {
+			pluginSpecs = mergePluginSpecs(project.PluginSpecs(), pluginSpecs)
+			options.LuaPaths = project.LuaPaths()
+			if !cmd.Flags().Changed("embed") {
+				options.EmbedDirs = project.EmbedDirs()
+			}
+			options.Defines = project.DefineValues()
+			options.TrustedKeys, options.RequireSigned = project.TrustedKeysPath(), project.RequireSignedPlugins()
+		}
+		options.Defines, err = mergeDefines(options.Defines, defineFlags)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if watch {
+			if err := watchScript(scriptPath, scriptArgs, pluginSpecs, options); err != nil {
+				fmt.Fprintf(os.Stderr, "Error watching script: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		// SIGINT and SIGTERM stop the script and run the shutdown hooks
+		ctx, stop := hyperuntime.SignalContext()
+		defer stop()
+		if err := runScriptContext(ctx, scriptPath, scriptArgs, pluginSpecs, options); err != nil {
 			fmt.Fprintf(os.Stderr, "Error running script: %v\n", err)
 			os.Exit(1)
 		}
@@ -87,14 +187,28 @@ Examples:
 var bundleCmd = &cobra.Command{
 	Use:   "bundle [lua-script]",
 	Short: "Bundle a Lua script with its dependencies into a single file",
-	Args:  cobra.ExactArgs(1),
+	Args:  cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		scriptPath := args[0]
+		project, scriptPath, err := loadProjectScript(cmd, args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 		outputFile, _ := cmd.Flags().GetString("output")
 		
+		// Plugin modules are provided at runtime, not bundled
+		availableModules := make(map[string]bool)
+		luaPaths := luaSearchPaths(".", nil)
+		if project != nil {
+			for _, spec := range project.Plugins {
+				availableModules[spec.Name] = true
+			}
+			luaPaths = project.LuaPaths()
+		}
+
 		fmt.Printf("Bundling %s with dependencies...\n", scriptPath)
 		
-		if err := bundleScript(scriptPath, outputFile); err != nil {
+		if err := bundleScriptWithModules(scriptPath, outputFile, availableModules, luaPaths); err != nil {
 			fmt.Fprintf(os.Stderr, "Error bundling script: %v\n", err)
 			os.Exit(1)
 		}
@@ -102,6 +216,486 @@ var bundleCmd = &cobra.Command{
 }
 
 
+var initCmd = &cobra.Command{
+	Use:   "init <name>",
+	Short: "Create a new project from a template",
+	Long: fmt.Sprintf(`Create a new project directory with an entry script, hype.yaml, a sample
+test and a .gitignore. Plugin templates also get a plugin manifest and a
+plugin.lua or plugin.go implementation.
+
+Templates: %s
+
+Examples:
+  hype init myapp
+  hype init api --template http
+  hype init my-plugin --template lua-plugin`, strings.Join(listProjectTemplates(), ", ")),
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := args[0]
+		templateName, _ := cmd.Flags().GetString("template")
+
+		fmt.Printf("Creating %s from the %s template\n", dir, templateName)
+
+		if err := initProject(dir, templateName); err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating project: %v\n", err)
+			os.Exit(1)
+		}
+
+		testScript := "test/app_test.lua"
+		if strings.HasSuffix(templateName, "-plugin") {
+			testScript = "test/plugin_test.lua"
+		}
+		fmt.Printf("\nNext steps:\n  cd %s\n  hype run\n  hype run %s\n  hype build\n", dir, testScript)
+	},
+}
+
+var addCmd = &cobra.Command{
+	Use:   "add [<git-url|path>[@<version>]...]",
+	Short: "Vendor Lua libraries into lua_modules",
+	Long: `Vendor pure-Lua libraries into lua_modules/ and record their exact
+revisions and content hashes in hype.lock.
+
+Sources are git repositories (https://, ssh://, file:// URLs or local
+repositories) or plain local directories. The version is a tag, branch or
+commit; without one the default branch is used. Modules in lua_modules/ are
+found by require in hype run, hype build and hype bundle.
+
+With no arguments every library in hype.lock is vendored again at its locked
+revision and checked against its locked hash.
+
+Examples:
+  hype add https://github.com/kikito/inspect.lua.git@v3.1.3
+  hype add file:///srv/git/shared-lua.git@v1.2.0 --name shared
+  hype add ../libs/strings
+  hype add`,
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		manifestPath, _ := cmd.Flags().GetString("manifest")
+		project, err := findProject(manifestPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		dir := "."
+		if project != nil {
+			dir = project.Dir
+		}
+		if name != "" && len(args) != 1 {
+			fmt.Fprintln(os.Stderr, "Error: --name needs exactly one source")
+			os.Exit(1)
+		}
+
+		if len(args) == 0 {
+			modules, err := restoreLuaModules(dir)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error restoring %s: %v\n", lockFileName, err)
+				os.Exit(1)
+			}
+			fmt.Printf("Restored %d module(s) from %s\n", len(modules), lockFileName)
+			return
+		}
+
+		for _, arg := range args {
+			source, version := splitSourceVersion(arg)
+			module, err := addLuaModule(dir, name, source, version)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error adding %s: %v\n", arg, err)
+				os.Exit(1)
+			}
+			revision := module.Revision
+			if len(revision) > 12 {
+				revision = revision[:12]
+			}
+			if revision == "" {
+				revision = "local"
+			}
+			fmt.Printf("Added %s (%s) to %s\n", module.Name, revision, filepath.Join(luaModulesDir, module.Name))
+		}
+	},
+}
+
+var pluginCmd = &cobra.Command{
+	Use:   "plugin",
+	Short: "Manage plugins",
+}
+
+var pluginFetchCmd = &cobra.Command{
+	Use:   "fetch [plugin-spec...]",
+	Short: "Fetch plugins into the plugin cache for offline builds",
+	Long: `Resolve plugin versions and download git and Go module plugins into the
+plugin cache, so later runs and builds need no network access. Git plugins
+already in the cache are updated to see new tags.
+
+Plugins are given in --plugins format; with none, the plugins from hype.yaml
+and --plugins-config are fetched. In a project the versions picked are
+recorded in hype.lock.
+
+Examples:
+  hype plugin fetch
+  hype plugin fetch git+https://github.com/user/hype-fs.git@^1.2.0
+  hype plugin fetch git+file:///srv/git/kv-extra.git@v0.3.1
+  hype plugin fetch github.com/user/hype-json@v1.0.0`,
+	Run: func(cmd *cobra.Command, args []string) {
+		pluginConfig, _ := cmd.Flags().GetString("plugins-config")
+		manifestPath, _ := cmd.Flags().GetString("manifest")
+		project, err := findProject(manifestPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		pluginSpecs, err := loadPluginSpecs(args, pluginConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading plugin specs: %v\n", err)
+			os.Exit(1)
+		}
+		if len(args) == 0 && project != nil {
+			pluginSpecs = mergePluginSpecs(project.PluginSpecs(), pluginSpecs)
+		}
+		if len(pluginSpecs) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: no plugins to fetch")
+			os.Exit(1)
+		}
+
+		registry := NewPluginRegistry()
+		if lockDir := pluginLockDir(project, false); lockDir != "" {
+			if err := registry.UseLockFile(lockDir, false); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+
+		resolved, err := registry.FetchPlugins(ctx, pluginSpecs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		for i, spec := range resolved {
+			// Plugins added because others require them are always local
+			requested := spec
+			if i < len(pluginSpecs) {
+				requested = pluginSpecs[i]
+			}
+			version := spec.Version
+			if version == "" {
+				version = requested.Version
+			}
+			if isLocalPluginSource(requested.Source) {
+				fmt.Printf("%s %s (local %s)\n", spec.Name, version, spec.Source)
+			} else {
+				fmt.Printf("%s %s (cached %s)\n", spec.Name, version, spec.Source)
+			}
+		}
+	},
+}
+
+var pluginListCmd = &cobra.Command{
+	Use:   "list [plugin-spec...]",
+	Short: "List plugins with their resolved versions and sources",
+	Long: `Resolve plugin versions and show each plugin's name, version, type and
+source, without building or loading the plugins. Git and Go module plugins
+that are not cached yet are fetched.
+
+Plugins are given in --plugins format; with none, the plugins from hype.yaml
+and --plugins-config are listed. Outside a project, the plugins found under
+plugins/, examples/plugins/ and $HYPE_PLUGIN_PATH are listed.
+
+Examples:
+  hype plugin list
+  hype plugin list ./plugins/fs git+https://github.com/user/hype-fs.git@^1.2.0`,
+	Run: func(cmd *cobra.Command, args []string) {
+		pluginConfig, _ := cmd.Flags().GetString("plugins-config")
+		manifestPath, _ := cmd.Flags().GetString("manifest")
+		project, err := findProject(manifestPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		pluginSpecs, err := loadPluginSpecs(args, pluginConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading plugin specs: %v\n", err)
+			os.Exit(1)
+		}
+		if len(args) == 0 && project != nil {
+			pluginSpecs = mergePluginSpecs(project.PluginSpecs(), pluginSpecs)
+		}
+		if len(args) == 0 && project == nil && pluginConfig == "" {
+			pluginSpecs = discoverPlugins(".")
+		}
+		if len(pluginSpecs) == 0 {
+			fmt.Println("No plugins found")
+			return
+		}
+
+		registry := NewPluginRegistry()
+		if lockDir := pluginLockDir(project, false); lockDir != "" {
+			if err := registry.UseLockFile(lockDir, false); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+
+		listings := registry.listPlugins(ctx, pluginSpecs)
+		if err := printPluginList(os.Stdout, listings); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		for _, listing := range listings {
+			if listing.Err != nil {
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+var pluginInfoCmd = &cobra.Command{
+	Use:   "info <plugin-spec>",
+	Short: "Print a plugin's manifest",
+	Long: `Print the manifest of a plugin given in --plugins format, or as a plugin
+directory, along with where the plugin was found.
+
+Examples:
+  hype plugin info .
+  hype plugin info bubbletea
+  hype plugin info github.com/user/hype-json@v1.0.0`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		source := args[0]
+		if info, err := os.Stat(source); err == nil && info.IsDir() && !isLocalPluginSource(source) {
+			source = localPluginPath(".", source)
+		}
+		pluginSpecs, err := ParsePluginSpecs([]string{source})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+
+		listing := NewPluginRegistry().listPlugins(ctx, pluginSpecs)[0]
+		if listing.Err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", listing.Err)
+			os.Exit(1)
+		}
+		if err := printPluginManifest(os.Stdout, listing); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var pluginValidateCmd = &cobra.Command{
+	Use:   "validate [dir]",
+	Short: "Check a plugin's manifest and that the plugin loads",
+	Long: `Check that a plugin directory (default: the working directory) has a
+complete hype-plugin.yaml with a valid name, semantic version, type and
+transport, and that its main file exists. When the manifest is valid, the
+plugin is loaded as hype run would load it and its module is required.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := "."
+		if len(args) > 0 {
+			dir = args[0]
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+
+		problems := validatePlugin(ctx, dir)
+		if len(problems) > 0 {
+			for _, problem := range problems {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", dir, problem)
+			}
+			os.Exit(1)
+		}
+		fmt.Printf("%s: plugin is valid\n", dir)
+	},
+}
+
+var pluginNewCmd = &cobra.Command{
+	Use:   "new <dir>",
+	Short: "Create a new Lua or Go plugin",
+	Long: `Create a plugin in a new directory. The plugin is named after the
+directory and comes with its manifest, an example script, a hype.yaml that
+loads it and tests for hype plugin test.
+
+Examples:
+  hype plugin new greeter
+  hype plugin new --type go fastjson`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		pluginType, _ := cmd.Flags().GetString("type")
+		if pluginType != "lua" && pluginType != "go" {
+			fmt.Fprintf(os.Stderr, "Error: unknown plugin type %q (available: lua, go)\n", pluginType)
+			os.Exit(1)
+		}
+
+		dir := args[0]
+		fmt.Printf("Creating %s plugin in %s\n", pluginType, dir)
+		if err := initProject(dir, pluginType+"-plugin"); err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating plugin: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("\nNext steps:\n  cd %s\n  hype plugin validate\n  hype plugin test\n  hype run\n", dir)
+	},
+}
+
+var pluginSDKCmd = &cobra.Command{
+	Use:   "sdk <dir>",
+	Short: "Write the Go plugin SDK module",
+	Long: `Write the hype module holding hype/pluginsdk, as this hype builds Go
+plugins against it, into a directory. A Go plugin builds and tests on its
+own by pointing its hype requirement at it:
+
+  replace hype => ../hype-sdk
+
+hype run and hype build replace it with their own copy, so the directory is
+only needed for go build, go vet and go test.
+
+Examples:
+  hype plugin sdk ../hype-sdk`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := writePluginSDK(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Wrote the plugin SDK (API version %d) to %s\n", hyperuntime.PluginAPIVersion, args[0])
+	},
+}
+
+var pluginTestCmd = &cobra.Command{
+	Use:   "test [dir]",
+	Short: "Run a plugin's Lua tests",
+	Long: `Run the Lua tests bundled with a plugin (default: the one in the working
+directory): the *_test.lua files in the plugin directory and in its test/
+and tests/ directories. Each test runs as its own script with hype run in
+the plugin directory, with the plugin loaded, and fails by raising an error
+or exiting with a non-zero status.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := "."
+		if len(args) > 0 {
+			dir = args[0]
+		}
+
+		hype, err := os.Executable()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		failed, err := runPluginTests(hype, dir, os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(failed) > 0 {
+			fmt.Printf("FAIL: %d test file(s) failed\n", len(failed))
+			os.Exit(1)
+		}
+		fmt.Println("PASS")
+	},
+}
+
+var pluginSignCmd = &cobra.Command{
+	Use:   "sign [dir]",
+	Short: "Sign a plugin with a private JWK",
+	Long: `Sign the plugin in a directory (default: the working directory) with a
+private JWK, such as one made with crypto.generate_jwk. The signature covers
+a hash of every file in the plugin and is written to hype-plugin.sig, so
+sign the plugin after its last change.
+
+Projects that list the public key in their trusted_keys JWKS file verify
+the signature whenever the plugin is loaded.
+
+Examples:
+  hype plugin sign --key team.jwk
+  hype plugin sign ./plugins/fs --key team.jwk`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := "."
+		if len(args) > 0 {
+			dir = args[0]
+		}
+		keyPath, _ := cmd.Flags().GetString("key")
+		if keyPath == "" {
+			fmt.Fprintln(os.Stderr, "Error: --key is required")
+			os.Exit(1)
+		}
+
+		key, err := loadJWK(keyPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		sig, err := signPlugin(dir, key)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Signed %s (%s) with key %s\n", dir, sig.Hash, sig.Kid)
+	},
+}
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the build cache",
+	Long: `Go builds keep prepared runtime modules and compiled packages in a cache,
+keyed by hype version, target, plugin set and Go version, so repeated builds
+skip most of the compile. The cache lives in $HYPE_CACHE_DIR, or hype under
+the user cache directory.`,
+}
+
+var cacheInfoCmd = &cobra.Command{
+	Use:   "info",
+	Short: "Show the build cache location, size and entries",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cacheDir, err := buildCacheDir()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := printBuildCacheInfo(os.Stdout, cacheDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var cacheCleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Remove the build cache",
+	Long: `Remove the prepared runtime modules and compiled packages of the build
+cache. Fetched plugins are kept unless --plugins is given.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		plugins, _ := cmd.Flags().GetBool("plugins")
+		cacheDir, err := buildCacheDir()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		freed, err := cleanBuildCache(cacheDir, plugins)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		what := "build cache"
+		if plugins {
+			what = "build and plugin cache"
+		}
+		fmt.Printf("Removed %s in %s (%s)\n", what, cacheDir, formatSize(freed))
+	},
+}
+
 var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Print the version number",
@@ -118,18 +712,51 @@ var versionCmd = &cobra.Command{
 
 func init() {
 	buildCmd.Flags().StringP("output", "o", "", "Output executable name")
-	buildCmd.Flags().StringP("target", "t", "current", "Target platform (current, linux, windows, darwin)")
+	buildCmd.Flags().StringP("target", "t", "current", "Target platforms as os or os/arch, comma-separated (e.g. linux/arm64,darwin/arm64,windows/amd64)")
 	buildCmd.Flags().StringSliceP("plugins", "p", []string{}, "Plugin specifications (e.g., fs@1.0.0, myalias=./path/to/plugin@2.0.0)")
 	buildCmd.Flags().String("plugins-config", "", "Path to plugin configuration file")
+	buildCmd.Flags().String("mode", "go", "Build mode: go (compile with the Go toolchain) or stub (append to a prebuilt hype runtime)")
+	buildCmd.Flags().Bool("bytecode", false, "Precompile the script to Lua bytecode instead of embedding its source")
+	buildCmd.Flags().StringArray("embed", []string{}, "Directory to embed and serve through the assets module (repeatable)")
+	buildCmd.Flags().StringArray("define", []string{}, "Define KEY=VALUE, exposed to the script as hype.defines.KEY (repeatable)")
+	buildCmd.Flags().String("manifest", "", "Project manifest (default: ./"+projectFileName+" when present)")
+	buildCmd.Flags().Bool("no-cache", false, "Build without the build cache (see hype cache)")
+	buildCmd.Flags().Bool("locked", false, "Use the plugin versions in "+lockFileName+" and fail instead of updating it")
+	buildCmd.Flags().String("stub-dir", "", "Directory of prebuilt hype binaries laid out as <os>-<arch>/hype (default $HYPE_STUB_DIR)")
 	
 	runCmd.Flags().StringSliceP("plugins", "p", []string{}, "Plugin specifications (e.g., fs@1.0.0, myalias=./path/to/plugin@2.0.0)")
 	runCmd.Flags().String("plugins-config", "", "Path to plugin configuration file")
+	runCmd.Flags().StringArray("embed", []string{}, "Directory to serve through the assets module, as a build would embed it (repeatable)")
+	runCmd.Flags().BoolP("watch", "w", false, "Restart the script when it, a module it requires or a local plugin changes")
+	runCmd.Flags().StringArray("define", []string{}, "Define KEY=VALUE, exposed to the script as hype.defines.KEY (repeatable)")
+	runCmd.Flags().String("manifest", "", "Project manifest (default: ./"+projectFileName+" when present)")
+	runCmd.Flags().Bool("locked", false, "Use the plugin versions in "+lockFileName+" and fail instead of updating it")
 	
 	bundleCmd.Flags().StringP("output", "o", "", "Output bundled script file (default: [script]-bundled.lua)")
+	initCmd.Flags().StringP("template", "t", "tui", "Project template ("+strings.Join(listProjectTemplates(), ", ")+")")
+
+	bundleCmd.Flags().String("manifest", "", "Project manifest (default: ./"+projectFileName+" when present)")
 	
+	pluginFetchCmd.Flags().String("plugins-config", "", "Path to plugin configuration file")
+	pluginFetchCmd.Flags().String("manifest", "", "Project manifest (default: ./"+projectFileName+" when present)")
+	pluginListCmd.Flags().String("plugins-config", "", "Path to plugin configuration file")
+	pluginListCmd.Flags().String("manifest", "", "Project manifest (default: ./"+projectFileName+" when present)")
+	pluginNewCmd.Flags().String("type", "lua", "Plugin type: lua or go")
+	pluginSignCmd.Flags().String("key", "", "Private JWK file to sign with")
+	cacheCleanCmd.Flags().Bool("plugins", false, "Also remove fetched plugins from the plugin cache")
+
+	addCmd.Flags().String("name", "", "Module name (default: derived from the source)")
+	addCmd.Flags().String("manifest", "", "Project manifest whose directory gets lua_modules and "+lockFileName+" (default: ./"+projectFileName+" when present)")
+
 	rootCmd.AddCommand(buildCmd)
 	rootCmd.AddCommand(runCmd)
 	rootCmd.AddCommand(bundleCmd)
+	rootCmd.AddCommand(initCmd)
+	rootCmd.AddCommand(addCmd)
+	pluginCmd.AddCommand(pluginFetchCmd, pluginListCmd, pluginInfoCmd, pluginValidateCmd, pluginNewCmd, pluginTestCmd, pluginSignCmd, pluginSDKCmd)
+	rootCmd.AddCommand(pluginCmd)
+	cacheCmd.AddCommand(cacheInfoCmd, cacheCleanCmd)
+	rootCmd.AddCommand(cacheCmd)
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(replCmd)
 	rootCmd.AddCommand(replSimpleCmd)
@@ -160,7 +787,53 @@ func loadPluginSpecs(pluginsFlag []string, pluginConfig string) ([]PluginSpec, e
 	return allSpecs, nil
 }
 
+// loadProjectScript loads the project manifest named by --manifest, or
+// hype.yaml in the working directory, and picks the script to use: the
+// script argument when given, otherwise the manifest's entry
+func loadProjectScript(cmd *cobra.Command, args []string) (*Project, string, error) {
+	manifestPath, _ := cmd.Flags().GetString("manifest")
+	project, err := findProject(manifestPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(args) > 0 {
+		return project, args[0], nil
+	}
+	if project == nil {
+		return nil, "", fmt.Errorf("no script specified and no %s found", projectFileName)
+	}
+
+	scriptPath, err := project.EntryPath()
+	if err != nil {
+		return nil, "", err
+	}
+	return project, scriptPath, nil
+}
+
+// pluginLockDir returns the directory whose hype.lock pins plugin versions:
+// the project's, or the working directory when --locked is given without a
+// project. Without either, plugin versions are not locked.
+func pluginLockDir(project *Project, locked bool) string {
+	switch {
+	case project != nil:
+		return project.Dir
+	case locked:
+		return "."
+	}
+	return ""
+}
+
 func main() {
+	// Executables produced with --mode stub carry their script as a payload
+	if ran, err := runEmbeddedPayload(); ran {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error running Lua script: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
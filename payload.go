@@ -0,0 +1,351 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"hype/hyperuntime"
+)
+
+// A payload is a zip archive appended to a prebuilt hype binary, followed by
+// a fixed-size trailer:
+//
+//	[hype binary][zip archive][archive length: uint64 LE][payloadMagic]
+//
+// At startup hype checks its own executable for the trailer and, when found,
+// runs the bundled script instead of the CLI.
+const payloadMagic = "HYPEPAYL"
+
+const payloadTrailerSize = 8 + len(payloadMagic)
+
+// Well-known entries inside the payload archive
+const (
+	payloadManifestFile = "hype-payload.json"
+	payloadScriptFile   = "main.lua"
+	payloadBytecodeFile = "main.luac"
+	payloadPluginDir    = "plugins/"
+)
+
+// PayloadManifest describes the contents of an appended payload
+type PayloadManifest struct {
+	Script  string            `json:"script"`            // Original entry script name
+	Plugins []PayloadPlugin   `json:"plugins"`           // Lua plugins stored under plugins/
+	Defines map[string]string `json:"defines,omitempty"` // Values exposed as hype.defines
+	Date    string            `json:"date,omitempty"`    // Build time, exposed as hype.date
+
+	// SourceMap points errors in the bundled script at the original files
+	SourceMap *hyperuntime.SourceMap `json:"source_map,omitempty"`
+}
+
+// PayloadPlugin describes a Lua plugin stored in the payload
+type PayloadPlugin struct {
+	Name        string                 `json:"name"`
+	Version     string                 `json:"version"`
+	Description string                 `json:"description"`
+	File        string                 `json:"file"`          // Main file
+	Dir         string                 `json:"dir,omitempty"` // Plugin directory; empty for single-file plugins
+	Permissions []string               `json:"permissions,omitempty"`
+	Config      map[string]interface{} `json:"config,omitempty"` // Passed to the plugin's init function
+}
+
+// Payload is an opened payload archive
+type Payload struct {
+	Manifest PayloadManifest
+	archive  *zip.Reader
+	files    map[string]*zip.File
+}
+
+// Assets returns the embedded asset tree
+func (p *Payload) Assets() fs.FS {
+	assets, err := fs.Sub(p.archive, assetsDirName)
+	if err != nil {
+		return nil
+	}
+	return assets
+}
+
+// ReadFile returns the contents of a file stored in the payload
+func (p *Payload) ReadFile(name string) ([]byte, error) {
+	f, ok := p.files[name]
+	if !ok {
+		return nil, fmt.Errorf("payload file not found: %s", name)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return io.ReadAll(rc)
+}
+
+// encodePayload serializes files into a payload archive with its trailer
+func encodePayload(manifest PayloadManifest, files map[string][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode payload manifest: %w", err)
+	}
+
+	entries := map[string][]byte{payloadManifestFile: manifestData}
+	for name, data := range files {
+		entries[name] = data
+	}
+
+	for name, data := range entries {
+		w, err := zw.Create(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s to payload: %w", name, err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, fmt.Errorf("failed to add %s to payload: %w", name, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finalize payload: %w", err)
+	}
+
+	archiveLen := uint64(buf.Len())
+	if err := binary.Write(&buf, binary.LittleEndian, archiveLen); err != nil {
+		return nil, err
+	}
+	buf.WriteString(payloadMagic)
+
+	return buf.Bytes(), nil
+}
+
+// payloadOffset returns where an appended payload starts in the file, or the
+// file size when the file has no payload
+func payloadOffset(f *os.File) (offset, archiveLen int64, err error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	size := info.Size()
+
+	if size < int64(payloadTrailerSize) {
+		return size, 0, nil
+	}
+
+	trailer := make([]byte, payloadTrailerSize)
+	if _, err := f.ReadAt(trailer, size-int64(payloadTrailerSize)); err != nil {
+		return 0, 0, err
+	}
+	if string(trailer[8:]) != payloadMagic {
+		return size, 0, nil
+	}
+
+	archiveLen = int64(binary.LittleEndian.Uint64(trailer[:8]))
+	offset = size - int64(payloadTrailerSize) - archiveLen
+	if archiveLen <= 0 || offset < 0 {
+		return 0, 0, fmt.Errorf("corrupt payload trailer")
+	}
+
+	return offset, archiveLen, nil
+}
+
+// openPayload opens the payload appended to an executable. It returns nil
+// without an error when the executable has no payload.
+func openPayload(exePath string) (*Payload, error) {
+	f, err := os.Open(exePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	offset, archiveLen, err := payloadOffset(f)
+	if err != nil {
+		return nil, err
+	}
+	if archiveLen == 0 {
+		return nil, nil
+	}
+
+	// Read the whole archive so the payload outlives the file handle
+	data := make([]byte, archiveLen)
+	if _, err := f.ReadAt(data, offset); err != nil {
+		return nil, fmt.Errorf("failed to read payload: %w", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), archiveLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open payload: %w", err)
+	}
+
+	payload := &Payload{archive: zr, files: make(map[string]*zip.File)}
+	for _, f := range zr.File {
+		payload.files[f.Name] = f
+	}
+
+	manifestData, err := payload.ReadFile(payloadManifestFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(manifestData, &payload.Manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse payload manifest: %w", err)
+	}
+
+	return payload, nil
+}
+
+// writeStubExecutable copies the stub binary, without any payload it may
+// already carry, to outputPath and appends the payload
+func writeStubExecutable(stubPath, outputPath string, payload []byte) error {
+	stub, err := os.Open(stubPath)
+	if err != nil {
+		return fmt.Errorf("failed to open runtime stub: %w", err)
+	}
+	defer stub.Close()
+
+	stubLen, _, err := payloadOffset(stub)
+	if err != nil {
+		return fmt.Errorf("failed to inspect runtime stub: %w", err)
+	}
+
+	if dir := filepath.Dir(outputPath); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+
+	out, err := os.OpenFile(outputPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create executable: %w", err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, io.NewSectionReader(stub, 0, stubLen)); err != nil {
+		return fmt.Errorf("failed to copy runtime stub: %w", err)
+	}
+	if _, err := out.Write(payload); err != nil {
+		return fmt.Errorf("failed to append payload: %w", err)
+	}
+
+	return out.Close()
+}
+
+// findRuntimeStub locates a prebuilt hype binary for the target platform.
+// Stub directories use the same <os>-<arch>/hype layout as dist/. The running
+// hype binary is used for the current platform when no stub directory has one.
+func findRuntimeStub(stubDir, goos, goarch string) (string, error) {
+	binaryName := "hype"
+	if goos == "windows" {
+		binaryName += ".exe"
+	}
+
+	var searchDirs []string
+	if stubDir != "" {
+		searchDirs = append(searchDirs, stubDir)
+	}
+	if envDir := os.Getenv("HYPE_STUB_DIR"); envDir != "" {
+		searchDirs = append(searchDirs, envDir)
+	}
+
+	platform := goos + "-" + goarch
+	for _, dir := range searchDirs {
+		path := filepath.Join(dir, platform, binaryName)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	if goos == runtime.GOOS && goarch == runtime.GOARCH {
+		return os.Executable()
+	}
+
+	if len(searchDirs) == 0 {
+		return "", fmt.Errorf("no runtime stub for %s: pass --stub-dir or set HYPE_STUB_DIR", platform)
+	}
+	return "", fmt.Errorf("no runtime stub for %s (searched %s)", platform, strings.Join(searchDirs, ", "))
+}
+
+// runEmbeddedPayload runs the script appended to the current executable.
+// It reports false when the executable carries no payload.
+func runEmbeddedPayload() (bool, error) {
+	exePath, err := os.Executable()
+	if err != nil {
+		return false, nil
+	}
+
+	payload, err := openPayload(exePath)
+	if err != nil {
+		return true, err
+	}
+	if payload == nil {
+		return false, nil
+	}
+
+	L := hyperuntime.NewState(os.Args[0], os.Args[1:])
+	defer L.Close()
+
+	hyperuntime.RegisterAssetsModule(L, payload.Assets())
+
+	// The stub is the runtime, so it reports its own version
+	info := hyperuntime.BuildInfo{
+		Version: version,
+		Commit:  commit,
+		Date:    payload.Manifest.Date,
+		Mode:    hyperuntime.ModeBuilt,
+		Defines: payload.Manifest.Defines,
+	}
+	for _, p := range payload.Manifest.Plugins {
+		info.Plugins = append(info.Plugins, hyperuntime.PluginInfo{Name: p.Name, Version: p.Version})
+	}
+	hyperuntime.RegisterHypeModule(L, info)
+
+	for _, p := range payload.Manifest.Plugins {
+		dir, main := p.Dir, strings.TrimPrefix(p.File, p.Dir+"/")
+		if dir == "" {
+			dir, main = path.Dir(p.File), path.Base(p.File)
+		}
+		files, err := fs.Sub(payload.archive, dir)
+		if err != nil {
+			return true, err
+		}
+		if err := hyperuntime.RegisterLuaPlugin(L, p.Name, main, files, p.Permissions, p.Config); err != nil {
+			return true, fmt.Errorf("failed to register plugin %s: %w", p.Name, err)
+		}
+	}
+
+	sourceMap := payload.Manifest.SourceMap
+	run := func() error {
+		script, err := payload.ReadFile(payloadScriptFile)
+		if err != nil {
+			return err
+		}
+		chunkName := payload.Manifest.Script
+		if sourceMap != nil {
+			chunkName = sourceMap.Chunk
+		}
+		return hyperuntime.DoSource(L, string(script), chunkName)
+	}
+	if _, ok := payload.files[payloadBytecodeFile]; ok {
+		run = func() error {
+			bytecode, err := payload.ReadFile(payloadBytecodeFile)
+			if err != nil {
+				return err
+			}
+			return hyperuntime.DoBytecode(L, bytecode)
+		}
+	}
+
+	// Like Go builds, stop on SIGINT and SIGTERM after shutting down the
+	// script's servers, apps and plugins
+	ctx, stop := hyperuntime.SignalContext()
+	defer stop()
+	return true, sourceMap.RewriteError(hyperuntime.Run(ctx, L, run))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPayloadRoundTrip(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "luax-payload-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	stubPath := filepath.Join(tempDir, "stub")
+	if err := os.WriteFile(stubPath, []byte("fake runtime binary"), 0755); err != nil {
+		t.Fatalf("Failed to write stub: %v", err)
+	}
+
+	manifest := PayloadManifest{Script: "app.lua"}
+	payload, err := encodePayload(manifest, map[string][]byte{payloadScriptFile: []byte(`print("one")`)})
+	if err != nil {
+		t.Fatalf("encodePayload failed: %v", err)
+	}
+
+	first := filepath.Join(tempDir, "first")
+	if err := writeStubExecutable(stubPath, first, payload); err != nil {
+		t.Fatalf("writeStubExecutable failed: %v", err)
+	}
+
+	// Using a built executable as the stub must replace its payload, not stack a second one
+	payload, err = encodePayload(manifest, map[string][]byte{payloadScriptFile: []byte(`print("two")`)})
+	if err != nil {
+		t.Fatalf("encodePayload failed: %v", err)
+	}
+	second := filepath.Join(tempDir, "second")
+	if err := writeStubExecutable(first, second, payload); err != nil {
+		t.Fatalf("writeStubExecutable failed: %v", err)
+	}
+
+	opened, err := openPayload(second)
+	if err != nil {
+		t.Fatalf("openPayload failed: %v", err)
+	}
+	if opened == nil {
+		t.Fatalf("Expected a payload in %s", second)
+	}
+	if opened.Manifest.Script != "app.lua" {
+		t.Fatalf("Expected script app.lua, got %q", opened.Manifest.Script)
+	}
+
+	script, err := opened.ReadFile(payloadScriptFile)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if string(script) != `print("two")` {
+		t.Fatalf("Unexpected script content: %q", script)
+	}
+
+	f, err := os.Open(second)
+	if err != nil {
+		t.Fatalf("Failed to open executable: %v", err)
+	}
+	defer f.Close()
+	offset, _, err := payloadOffset(f)
+	if err != nil {
+		t.Fatalf("payloadOffset failed: %v", err)
+	}
+	if offset != int64(len("fake runtime binary")) {
+		t.Fatalf("Expected payload right after the stub, got offset %d", offset)
+	}
+}
+
+func TestOpenPayloadWithoutPayload(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "luax-payload-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	path := filepath.Join(tempDir, "plain")
+	if err := os.WriteFile(path, []byte("no payload here"), 0755); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	payload, err := openPayload(path)
+	if err != nil {
+		t.Fatalf("openPayload failed: %v", err)
+	}
+	if payload != nil {
+		t.Fatalf("Expected no payload")
+	}
+}
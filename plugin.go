@@ -2,15 +2,22 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"go/build"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"plugin"
 	"reflect"
+	"sort"
 	"strings"
+	"sync/atomic"
+	"testing/fstest"
+
+	"hype/hyperuntime"
 
 	"github.com/yuin/gopher-lua"
 	"gopkg.in/yaml.v2"
@@ -23,12 +30,17 @@ type HypePlugin interface {
 	Version() string
 	Description() string
 
-	// Module registration - registers the plugin as a Lua module
+	// Module registration - registers the plugin as a Lua module. The
+	// plugin is initialized with its config first, and its shutdown hook
+	// is registered with hyperuntime.OnPluginShutdown.
 	Register(L *lua.LState) error
 
 	// Go dependencies needed for building
 	Dependencies() []string
 
+	// Permissions the plugin requests in its manifest
+	Permissions() []string
+
 	// Cleanup resources if needed
 	Close() error
 }
@@ -37,8 +49,19 @@ type HypePlugin interface {
 type PluginSpec struct {
 	Name    string `yaml:"name"`
 	Source  string `yaml:"source"`  // URL, file path, or module path
-	Version string `yaml:"version"` // Git tag, commit, or version
+	Version string `yaml:"version"` // Git tag, commit, version or semver constraint (^1.2.0, >=1.0.0 <2.0.0)
 	Alias   string `yaml:"alias"`   // Optional alias for the module name
+
+	// Permissions the plugin may request; hype build fails for plugins
+	// that request more
+	Permissions []string `yaml:"permissions"`
+
+	// Config is passed to the plugin's init hook; see plugin_config.go
+	Config map[string]interface{} `yaml:"config"`
+
+	// RequiredBy names the plugin this one was added for when it was not
+	// given but required by another plugin; see plugin_requires.go
+	RequiredBy string `yaml:"-"`
 }
 
 // PluginManifest represents the plugin's manifest file
@@ -47,17 +70,35 @@ type PluginManifest struct {
 	Version      string   `yaml:"version"`
 	Type         string   `yaml:"type"` // "go" or "lua"
 	Main         string   `yaml:"main"`
-	Module       string   `yaml:"module"`       // Go module path
+	Module       string   `yaml:"module"` // Go module path
 	Description  string   `yaml:"description"`
 	Author       string   `yaml:"author"`
 	License      string   `yaml:"license"`
 	Dependencies []string `yaml:"dependencies"` // Go dependencies
+	Transport    string   `yaml:"transport"`    // How Go plugins are loaded: "plugin" (default) or "rpc"
+	Command      []string `yaml:"command"`      // Executable of an rpc plugin, relative to the plugin directory
+	Permissions  []string `yaml:"permissions"`  // Capabilities the plugin needs, e.g. fs:read or net:dial
+
+	// Requires maps the names of other hype plugins this one uses to
+	// version ranges; see plugin_requires.go
+	Requires map[string]string `yaml:"requires"`
 }
 
 // PluginRegistry manages loaded plugins
 type PluginRegistry struct {
 	plugins []HypePlugin
-	specs   []PluginSpec
+	specs   []PluginSpec // Specs as loaded, with versions resolved
+
+	lock        *LockFile // Plugin versions pinned in hype.lock; nil when not used
+	lockDir     string
+	frozen      bool // Fail instead of changing the lock
+	lockChanged bool
+
+	cacheDir string // Where remote plugins are cached; see plugin_cache.go
+	update   bool   // Fetch new tags and commits of git plugins already cached
+
+	trustedKeys   []hyperuntime.JWK // Keys plugin signatures are verified against; nil skips verification
+	requireSigned bool              // Refuse unsigned and untrusted plugins; see plugin_signing.go
 }
 
 // NewPluginRegistry creates a new plugin registry
@@ -68,18 +109,72 @@ func NewPluginRegistry() *PluginRegistry {
 	}
 }
 
-// LoadPlugins loads plugins from specifications
+// UseLockFile makes LoadPlugins load the plugin versions pinned in
+// dir/hype.lock and record the versions it picks there. With frozen set,
+// a plugin that is not pinned, or whose pinned version is gone, is an error.
+func (r *PluginRegistry) UseLockFile(dir string, frozen bool) error {
+	lock, err := loadLockFile(dir)
+	if err != nil {
+		return err
+	}
+	r.lock, r.lockDir, r.frozen = lock, dir, frozen
+	return nil
+}
+
+// LoadPlugins loads plugins from specifications, along with the plugins
+// they require. Every plugin is loaded, and later registered, after the
+// plugins it requires.
 func (r *PluginRegistry) LoadPlugins(ctx context.Context, specs []PluginSpec) error {
-	r.specs = specs
-	
-	for _, spec := range specs {
-		plugin, err := r.loadPlugin(ctx, spec)
+	listings, err := r.resolvePluginGraph(ctx, specs)
+	if err != nil {
+		return err
+	}
+	if listings, err = sortPluginGraph(listings); err != nil {
+		return err
+	}
+	for _, listing := range listings {
+		plugin, err := r.loadPlugin(ctx, listing.Resolved)
 		if err != nil {
-			return fmt.Errorf("failed to load plugin %s: %w", spec.Name, err)
+			return fmt.Errorf("failed to load plugin %s: %w", listing.Spec.Name, err)
 		}
+		printPluginPermissions(plugin)
 		r.plugins = append(r.plugins, plugin)
+		r.specs = append(r.specs, listing.Resolved)
 	}
 	
+	return r.saveLock()
+}
+
+// FetchPlugins resolves plugin versions and fetches git and Go module
+// plugins into the plugin cache without loading them, so later runs and
+// builds work offline. Git plugins already cached are updated first. It
+// returns the resolved specs of the plugins given, in order, followed by
+// those of the plugins they require.
+func (r *PluginRegistry) FetchPlugins(ctx context.Context, specs []PluginSpec) ([]PluginSpec, error) {
+	r.update = true
+	listings, err := r.resolvePluginGraph(ctx, specs)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := sortPluginGraph(listings); err != nil {
+		return nil, err
+	}
+	var resolved []PluginSpec
+	for _, listing := range listings {
+		resolved = append(resolved, listing.Resolved)
+	}
+	return resolved, r.saveLock()
+}
+
+// saveLock writes the lock file if loading changed it
+func (r *PluginRegistry) saveLock() error {
+	if !r.lockChanged {
+		return nil
+	}
+	if err := r.lock.save(r.lockDir); err != nil {
+		return fmt.Errorf("failed to write %s: %w", lockFileName, err)
+	}
+	r.lockChanged = false
 	return nil
 }
 
@@ -102,6 +197,15 @@ func (r *PluginRegistry) GetAllDependencies() []string {
 	return deps
 }
 
+// PluginInfos returns the name and version of each loaded plugin
+func (r *PluginRegistry) PluginInfos() []hyperuntime.PluginInfo {
+	var infos []hyperuntime.PluginInfo
+	for _, plugin := range r.plugins {
+		infos = append(infos, hyperuntime.PluginInfo{Name: plugin.Name(), Version: plugin.Version()})
+	}
+	return infos
+}
+
 // Close closes all plugins
 func (r *PluginRegistry) Close() error {
 	for _, plugin := range r.plugins {
@@ -126,6 +230,9 @@ func (r *PluginRegistry) loadPlugin(ctx context.Context, spec PluginSpec) (HypeP
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch plugin: %w", err)
 	}
+	if err := r.verifyPluginSignature(spec, pluginDir); err != nil {
+		return nil, err
+	}
 
 	// Load plugin manifest
 	manifest, err := r.loadManifest(pluginDir)
@@ -137,8 +244,18 @@ func (r *PluginRegistry) loadPlugin(ctx context.Context, spec PluginSpec) (HypeP
 	if err := r.validatePluginVersion(spec, manifest); err != nil {
 		return nil, fmt.Errorf("version validation failed: %w", err)
 	}
+	if err := hyperuntime.ValidatePermissions(manifest.Permissions); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
 
 	// Build and load the plugin
+	switch manifest.Transport {
+	case transportRPC:
+		return r.loadRPCPlugin(ctx, spec, manifest, pluginDir)
+	case "", transportPlugin:
+	default:
+		return nil, fmt.Errorf("unsupported plugin transport: %s", manifest.Transport)
+	}
 	switch manifest.Type {
 	case "go":
 		return r.loadGoPlugin(ctx, spec, manifest, pluginDir)
@@ -149,64 +266,23 @@ func (r *PluginRegistry) loadPlugin(ctx context.Context, spec PluginSpec) (HypeP
 	}
 }
 
-// fetchPlugin downloads or copies plugin source to target directory
+// fetchPlugin copies plugin source to target directory. Git and Go module
+// sources have been fetched into the plugin cache by resolvePluginVersion,
+// so every source is a directory by now.
 func (r *PluginRegistry) fetchPlugin(ctx context.Context, spec PluginSpec, tempDir string) (string, error) {
 	pluginDir := filepath.Join(tempDir, "plugin")
 
 	if strings.HasPrefix(spec.Source, "http://") || strings.HasPrefix(spec.Source, "https://") {
 		// Handle HTTP(S) URLs
-		return "", fmt.Errorf("HTTP plugin loading not yet implemented")
-	} else if filepath.IsAbs(spec.Source) || strings.HasPrefix(spec.Source, "./") || strings.HasPrefix(spec.Source, "../") {
+		return "", fmt.Errorf("HTTP plugin sources are not supported; use %s%s for a git repository", gitPluginPrefix, spec.Source)
+	} else if isLocalPluginSource(spec.Source) {
 		// Handle local file paths
 		return r.copyLocalPlugin(spec.Source, pluginDir)
-	} else if strings.Contains(spec.Source, "/") {
-		// Handle Go module paths (e.g., github.com/user/plugin)
-		return r.fetchGoModule(ctx, spec, pluginDir)
 	}
 
 	return "", fmt.Errorf("unsupported plugin source: %s", spec.Source)
 }
 
-// fetchGoModule fetches a Go module using go mod download
-func (r *PluginRegistry) fetchGoModule(ctx context.Context, spec PluginSpec, targetDir string) (string, error) {
-	// Create a temporary go.mod to download the module
-	tempGoMod := filepath.Join(filepath.Dir(targetDir), "go.mod")
-	goModContent := "module temp\n\ngo 1.21\n"
-	if err := ioutil.WriteFile(tempGoMod, []byte(goModContent), 0644); err != nil {
-		return "", fmt.Errorf("failed to create temp go.mod: %w", err)
-	}
-
-	// Construct module path with version
-	modulePath := spec.Source
-	if spec.Version != "" && spec.Version != "latest" {
-		modulePath += "@" + spec.Version
-	}
-
-	// Download the module
-	cmd := exec.CommandContext(ctx, "go", "mod", "download", "-x", modulePath)
-	cmd.Dir = filepath.Dir(tempGoMod)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return "", fmt.Errorf("failed to download module %s: %w\nOutput: %s", modulePath, err, output)
-	}
-
-	// Find the downloaded module in GOPATH/pkg/mod
-	gopath := build.Default.GOPATH
-	if gopath == "" {
-		gopath = filepath.Join(os.Getenv("HOME"), "go")
-	}
-	
-	// Convert module path to filesystem path
-	modPath := strings.ReplaceAll(spec.Source, "/", string(filepath.Separator))
-	if spec.Version != "" && spec.Version != "latest" {
-		modPath += "@" + spec.Version
-	}
-	
-	sourceDir := filepath.Join(gopath, "pkg", "mod", modPath)
-	
-	// Copy from GOPATH to our target directory
-	return r.copyLocalPlugin(sourceDir, targetDir)
-}
-
 // copyLocalPlugin copies a local plugin to target directory
 func (r *PluginRegistry) copyLocalPlugin(sourcePath, targetDir string) (string, error) {
 	if err := os.MkdirAll(targetDir, 0755); err != nil {
@@ -249,16 +325,25 @@ func (r *PluginRegistry) copyLocalPlugin(sourcePath, targetDir string) (string,
 	return targetDir, err
 }
 
-// loadManifest loads the plugin manifest
-func (r *PluginRegistry) loadManifest(pluginDir string) (*PluginManifest, error) {
+// findManifest returns the path of the plugin manifest in pluginDir
+func findManifest(pluginDir string) (string, error) {
 	manifestPath := filepath.Join(pluginDir, "hype-plugin.yaml")
 	if _, err := os.Stat(manifestPath); os.IsNotExist(err) {
 		// Try alternative names
 		manifestPath = filepath.Join(pluginDir, "hype-plugin.yml")
 		if _, err := os.Stat(manifestPath); os.IsNotExist(err) {
-			return nil, fmt.Errorf("plugin manifest not found (hype-plugin.yaml)")
+			return "", fmt.Errorf("plugin manifest not found (hype-plugin.yaml)")
 		}
 	}
+	return manifestPath, nil
+}
+
+// loadManifest loads the plugin manifest
+func (r *PluginRegistry) loadManifest(pluginDir string) (*PluginManifest, error) {
+	manifestPath, err := findManifest(pluginDir)
+	if err != nil {
+		return nil, err
+	}
 
 	data, err := ioutil.ReadFile(manifestPath)
 	if err != nil {
@@ -273,18 +358,29 @@ func (r *PluginRegistry) loadManifest(pluginDir string) (*PluginManifest, error)
 	return &manifest, nil
 }
 
+// goPluginsOpened is set once the process has opened a Go plugin. The Go
+// runtime cannot open a plugin again, rebuilt or not, so watch mode restarts
+// the whole process instead of loading it a second time.
+var goPluginsOpened atomic.Bool
+
 // loadGoPlugin builds and loads a Go plugin
 func (r *PluginRegistry) loadGoPlugin(ctx context.Context, spec PluginSpec, manifest *PluginManifest, pluginDir string) (HypePlugin, error) {
 	// Build the plugin as a Go plugin (.so file)
 	pluginPath := filepath.Join(pluginDir, "plugin.so")
 	
-	mainFile := filepath.Join(pluginDir, manifest.Main)
-	if manifest.Main == "" {
-		mainFile = filepath.Join(pluginDir, "plugin.go")
+	// pluginDir is a private copy, so a plugin without its own go.mod gets
+	// hype's, which pins the gopher-lua version the host was built with
+	if _, err := os.Stat(filepath.Join(pluginDir, "go.mod")); os.IsNotExist(err) {
+		if err := writePluginModule(pluginDir, manifest.Name); err != nil {
+			return nil, err
+		}
+	}
+	if err := usePluginSDK(ctx, pluginDir); err != nil {
+		return nil, err
 	}
 
 	// Build the plugin
-	cmd := exec.CommandContext(ctx, "go", "build", "-buildmode=plugin", "-o", pluginPath, mainFile)
+	cmd := exec.CommandContext(ctx, "go", "build", "-buildmode=plugin", "-o", pluginPath, ".")
 	cmd.Dir = pluginDir
 	cmd.Env = append(os.Environ(), "CGO_ENABLED=1") // Required for plugins
 	
@@ -297,6 +393,7 @@ func (r *PluginRegistry) loadGoPlugin(ctx context.Context, spec PluginSpec, mani
 	if err != nil {
 		return nil, fmt.Errorf("failed to load plugin: %w", err)
 	}
+	goPluginsOpened.Store(true)
 
 	// Look for NewPlugin function
 	newPluginSym, err := p.Lookup("NewPlugin")
@@ -304,7 +401,10 @@ func (r *PluginRegistry) loadGoPlugin(ctx context.Context, spec PluginSpec, mani
 		return nil, fmt.Errorf("plugin missing NewPlugin function: %w", err)
 	}
 
-	// Use reflection to call NewPlugin function
+	// NewPlugin returns a pluginsdk.Plugin, or an interface{} in plugins
+	// written before the SDK. hype does not link the SDK (see
+	// hyperuntime.PluginAPIVersion), so the function is called by
+	// reflection and the instance checked by its methods.
 	newPluginValue := reflect.ValueOf(newPluginSym)
 	if newPluginValue.Kind() != reflect.Func {
 		return nil, fmt.Errorf("NewPlugin is not a function")
@@ -313,16 +413,16 @@ func (r *PluginRegistry) loadGoPlugin(ctx context.Context, spec PluginSpec, mani
 	// Check function signature: should have no parameters and return one value
 	funcType := newPluginValue.Type()
 	if funcType.NumIn() != 0 || funcType.NumOut() != 1 {
-		return nil, fmt.Errorf("NewPlugin function has wrong signature: expected func() interface{}, got %s", funcType)
+		return nil, fmt.Errorf("NewPlugin function has wrong signature: expected func() pluginsdk.Plugin, got %s", funcType)
 	}
 	
-	// Call the function
-	results := newPluginValue.Call(nil)
-	if len(results) != 1 {
-		return nil, fmt.Errorf("NewPlugin function returned wrong number of values")
+	pluginInstance := newPluginValue.Call(nil)[0].Interface()
+	if err := hyperuntime.CheckPluginAPI(manifest.Name, pluginInstance); err != nil {
+		return nil, err
+	}
+	if hyperuntime.LegacyGoPlugin(pluginInstance) {
+		fmt.Fprintf(os.Stderr, "Warning: plugin %s does not implement APIVersion; Go plugins should implement hype/pluginsdk.Plugin\n", manifest.Name)
 	}
-	
-	pluginInstance := results[0].Interface()
 	
 	return &GoPluginWrapper{
 		plugin:   pluginInstance,
@@ -331,103 +431,145 @@ func (r *PluginRegistry) loadGoPlugin(ctx context.Context, spec PluginSpec, mani
 	}, nil
 }
 
-// loadLuaPlugin loads a Lua plugin
+// writePluginModule writes a go.mod and go.sum for a Go plugin that has
+// none, based on the ones hype itself is built from. The module is named
+// after the plugin, since a process cannot open two plugins of the same
+// module path.
+func writePluginModule(dir, name string) error {
+	goMod, err := runtimeSources.ReadFile("go.mod")
+	if err != nil {
+		return err
+	}
+	goSum, err := runtimeSources.ReadFile("go.sum")
+	if err != nil {
+		return err
+	}
+	goMod = []byte(strings.Replace(string(goMod), "module hype\n", "module "+pluginModulePath(name)+"\n", 1))
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), goMod, 0644); err != nil {
+		return fmt.Errorf("failed to write plugin go.mod: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.sum"), goSum, 0644); err != nil {
+		return fmt.Errorf("failed to write plugin go.sum: %w", err)
+	}
+	return nil
+}
+
+// pluginModulePath returns the module path of a Go plugin without a go.mod,
+// which its packages import each other by
+func pluginModulePath(name string) string {
+	return "hypeplugin/" + goIdentifier(name, false)
+}
+
+// loadLuaPlugin loads a Lua plugin. pluginDir is the copy whose signature
+// was checked and is removed once the plugin is loaded, so the plugin's
+// files are read into memory from it rather than served from its source.
 func (r *PluginRegistry) loadLuaPlugin(spec PluginSpec, manifest *PluginManifest, pluginDir string) (HypePlugin, error) {
-	mainFile := filepath.Join(pluginDir, manifest.Main)
-	if manifest.Main == "" {
-		mainFile = filepath.Join(pluginDir, "plugin.lua")
+	main := manifest.Main
+	if main == "" {
+		main = "plugin.lua"
 	}
+	main = path.Clean(filepath.ToSlash(main))
 
-	content, err := ioutil.ReadFile(mainFile)
+	files, err := readPluginFiles(pluginDir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read Lua plugin: %w", err)
 	}
+	if _, ok := files[main]; !ok {
+		return nil, fmt.Errorf("failed to read Lua plugin: %s not found", main)
+	}
 
 	return &LuaPluginWrapper{
-		content:  string(content),
+		main:     main,
+		files:    files,
 		manifest: manifest,
 		spec:     spec,
 	}, nil
 }
 
-// GoPluginWrapper wraps a Go plugin
+// readPluginFiles reads the files of a plugin directory by slash-separated
+// path. Version control directories are left out.
+func readPluginFiles(dir string) (fstest.MapFS, error) {
+	files := make(fstest.MapFS)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if (d.Name() == ".git" || d.Name() == ".hg") && path != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = &fstest.MapFile{Data: data, Mode: 0644}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// GoPluginWrapper wraps a Go plugin. Its metadata comes from the plugin
+// manifest; the plugin instance only registers its modules.
 type GoPluginWrapper struct {
-	plugin   interface{} // Use interface{} instead of HypePlugin to avoid type assertion issues
+	plugin   interface{} // As returned by NewPlugin, usually a pluginsdk.Plugin
 	manifest *PluginManifest
 	spec     PluginSpec
 }
 
+// Methods of plugins written before hype/pluginsdk that are still honored
+type (
+	legacyPluginDependencies interface{ Dependencies() []string }
+	legacyPluginCloser       interface{ Close() error }
+)
+
 func (w *GoPluginWrapper) Name() string {
 	if w.spec.Alias != "" {
 		return w.spec.Alias
 	}
-	return w.callPluginMethod("Name").(string)
-}
-
-func (w *GoPluginWrapper) Version() string { 
-	return w.callPluginMethod("Version").(string)
-}
-
-func (w *GoPluginWrapper) Description() string { 
-	return w.callPluginMethod("Description").(string)
+	return w.manifest.Name
 }
 
+func (w *GoPluginWrapper) Version() string     { return w.manifest.Version }
+func (w *GoPluginWrapper) Description() string { return w.manifest.Description }
 func (w *GoPluginWrapper) Dependencies() []string {
-	deps := w.callPluginMethod("Dependencies").([]string)
-	deps = append(deps, w.manifest.Dependencies...)
-	return deps
-}
-
-func (w *GoPluginWrapper) Register(L *lua.LState) error { 
-	result := w.callPluginMethodWithArgs("Register", L)
-	if result == nil {
-		return nil
+	var deps []string
+	if legacy, ok := w.plugin.(legacyPluginDependencies); ok {
+		deps = append(deps, legacy.Dependencies()...)
 	}
-	return result.(error)
+	return append(deps, w.manifest.Dependencies...)
 }
 
-func (w *GoPluginWrapper) Close() error {
-	result := w.callPluginMethod("Close")
-	if result == nil {
-		return nil
-	}
-	return result.(error)
-}
+func (w *GoPluginWrapper) Permissions() []string { return w.manifest.Permissions }
 
-// callPluginMethod calls a method on the plugin using reflection
-func (w *GoPluginWrapper) callPluginMethod(methodName string) interface{} {
-	return w.callPluginMethodWithArgs(methodName)
+// Register initializes the plugin with its config and registers its
+// modules; see hyperuntime.RegisterGoPlugin
+func (w *GoPluginWrapper) Register(L *lua.LState) error {
+	return hyperuntime.RegisterGoPlugin(L, w.Name(), w.plugin, w.spec.Config)
 }
 
-// callPluginMethodWithArgs calls a method on the plugin with arguments using reflection
-func (w *GoPluginWrapper) callPluginMethodWithArgs(methodName string, args ...interface{}) interface{} {
-	pluginValue := reflect.ValueOf(w.plugin)
-	method := pluginValue.MethodByName(methodName)
-	
-	if !method.IsValid() {
-		panic(fmt.Sprintf("plugin method %s not found", methodName))
-	}
-	
-	// Convert arguments to reflect.Value
-	argValues := make([]reflect.Value, len(args))
-	for i, arg := range args {
-		argValues[i] = reflect.ValueOf(arg)
-	}
-	
-	// Call the method
-	results := method.Call(argValues)
-	
-	// Return the first result (or nil if no results)
-	if len(results) == 0 {
-		return nil
+func (w *GoPluginWrapper) Close() error {
+	if closer, ok := w.plugin.(legacyPluginCloser); ok {
+		return closer.Close()
 	}
-	
-	return results[0].Interface()
+	return nil
 }
 
 // LuaPluginWrapper wraps a Lua plugin
 type LuaPluginWrapper struct {
-	content  string
+	main     string       // Main file's path in files
+	files    fstest.MapFS // Plugin directory, as read when it was loaded
 	manifest *PluginManifest
 	spec     PluginSpec
 }
@@ -445,40 +587,26 @@ func (w *LuaPluginWrapper) Dependencies() []string {
 	return w.manifest.Dependencies
 }
 
+func (w *LuaPluginWrapper) Permissions() []string { return w.manifest.Permissions }
+
+// Register makes the plugin's main file and its other Lua files available
+// to require in L
 func (w *LuaPluginWrapper) Register(L *lua.LState) error {
-	// Create a temporary Lua state to load the plugin
-	tempL := lua.NewState()
-	defer tempL.Close()
+	return hyperuntime.RegisterLuaPlugin(L, w.Name(), w.main, w.files, w.manifest.Permissions, w.spec.Config)
+}
 
-	// Execute the plugin code
-	if err := tempL.DoString(w.content); err != nil {
-		return fmt.Errorf("failed to execute Lua plugin: %w", err)
-	}
+func (w *LuaPluginWrapper) Close() error { return nil }
 
-	// Get the plugin table from the Lua state
-	pluginTable := tempL.Get(-1)
-	if pluginTable.Type() != lua.LTTable {
-		return fmt.Errorf("Lua plugin must return a table")
+// Files returns the contents of the plugin directory by slash-separated
+// path, for embedding into builds
+func (w *LuaPluginWrapper) Files() (map[string][]byte, error) {
+	files := make(map[string][]byte, len(w.files))
+	for name, file := range w.files {
+		files[name] = file.Data
 	}
-
-	// Register the plugin as a module
-	L.PreloadModule(w.Name(), func(L *lua.LState) int {
-		// Copy the plugin table to the main Lua state
-		newTable := L.NewTable()
-		
-		pluginTable.(*lua.LTable).ForEach(func(key, value lua.LValue) {
-			L.SetField(newTable, key.String(), value)
-		})
-		
-		L.Push(newTable)
-		return 1
-	})
-
-	return nil
+	return files, nil
 }
 
-func (w *LuaPluginWrapper) Close() error { return nil }
-
 // ParsePluginSpecs parses plugin specifications from CLI arguments
 func ParsePluginSpecs(plugins []string) ([]PluginSpec, error) {
 	var specs []PluginSpec
@@ -500,13 +628,9 @@ func ParsePluginSpecs(plugins []string) ([]PluginSpec, error) {
 			pluginStr = parts[1]
 		}
 		
-		// Check for @version suffix
-		if strings.Contains(pluginStr, "@") {
-			parts := strings.SplitN(pluginStr, "@", 2)
-			spec.Source = parts[0]
-			spec.Version = parts[1]
-		} else {
-			spec.Source = pluginStr
+		// Check for @version suffix; git URLs may contain @ themselves
+		spec.Source, spec.Version = splitSourceVersion(pluginStr)
+		if spec.Version == "" {
 			spec.Version = "latest"
 		}
 		
@@ -514,33 +638,17 @@ func ParsePluginSpecs(plugins []string) ([]PluginSpec, error) {
 		if spec.Alias == "" {
 			// If source contains "/", it's a path/URL - use basename as name
 			if strings.Contains(spec.Source, "/") {
-				spec.Name = filepath.Base(spec.Source)
+				spec.Name = moduleNameFromSource(spec.Source)
 			} else {
 				// Simple name format (e.g., "fs@1.0" or "fs")
 				// Use the source as both name and try to resolve it
 				spec.Name = spec.Source
 				
-				// For simple names, we need to try different resolution strategies:
-				// 1. Look for local plugin in conventional locations
-				// 2. Look for it as a Go module (future)
-				// 3. Look in plugin registry (future)
-				
-				// For now, try conventional local plugin directory structure
+				// Look for a local plugin in the conventional locations and the
+				// directories in $HYPE_PLUGIN_PATH
 				if !strings.HasPrefix(spec.Source, "./") && !strings.HasPrefix(spec.Source, "../") && !filepath.IsAbs(spec.Source) {
-					// Check common plugin locations
-					possiblePaths := []string{
-						fmt.Sprintf("./plugins/%s", spec.Source),
-						fmt.Sprintf("./examples/plugins/%s", spec.Source),
-						fmt.Sprintf("./%s-plugin", spec.Source),
-						fmt.Sprintf("./examples/plugins/%s-plugin", spec.Source),
-					}
-					
-					// Try to find the plugin in conventional locations
-					for _, path := range possiblePaths {
-						if _, err := os.Stat(path); err == nil {
-							spec.Source = path
-							break
-						}
+					if path, ok := findConventionalPlugin(".", spec.Source); ok {
+						spec.Source = path
 					}
 				}
 			}
@@ -554,6 +662,60 @@ func ParsePluginSpecs(plugins []string) ([]PluginSpec, error) {
 	return specs, nil
 }
 
+// pluginPathEnv lists extra directories, separated like PATH, that hold
+// plugins referenced by bare name
+const pluginPathEnv = "HYPE_PLUGIN_PATH"
+
+// findConventionalPlugin looks for a plugin referenced by bare name in the
+// conventional local plugin directories under baseDir, then in the
+// directories listed in $HYPE_PLUGIN_PATH
+func findConventionalPlugin(baseDir, name string) (string, bool) {
+	possiblePaths := []string{
+		"plugins/" + name,
+		"examples/plugins/" + name,
+		name + "-plugin",
+		"examples/plugins/" + name + "-plugin",
+	}
+
+	for _, rel := range possiblePaths {
+		path := localPluginPath(baseDir, rel)
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	for _, dir := range filepath.SplitList(os.Getenv(pluginPathEnv)) {
+		if dir == "" {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if !filepath.IsAbs(path) {
+			path = localPluginPath(".", path)
+		}
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// isLocalPluginSource reports whether a plugin source is a path on disk
+func isLocalPluginSource(source string) bool {
+	return filepath.IsAbs(source) || strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../")
+}
+
+// localPluginPath joins a relative plugin path onto baseDir, keeping the ./
+// prefix that fetchPlugin uses to recognize local sources
+func localPluginPath(baseDir, rel string) string {
+	path := filepath.ToSlash(filepath.Join(baseDir, rel))
+	if filepath.IsAbs(path) || path == ".." || strings.HasPrefix(path, "../") {
+		return path
+	}
+	if path == "." {
+		return "./"
+	}
+	return "./" + path
+}
+
 // validatePluginVersion validates that the plugin version matches the requested version
 func (r *PluginRegistry) validatePluginVersion(spec PluginSpec, manifest *PluginManifest) error {
 	// If no specific version requested, accept any version
@@ -566,14 +728,237 @@ func (r *PluginRegistry) validatePluginVersion(spec PluginSpec, manifest *Plugin
 		return nil
 	}
 	
-	// For now, we'll do exact matching. In the future, we could add:
-	// - Semantic version matching (^1.0.0, ~1.2.0, etc.)
-	// - Version range support (>=1.0.0 <2.0.0)
-	// - Pre-release handling (1.0.0-alpha.1)
+	// Semantic version constraints (^1.0.0, ~1.2.0, >=1.0.0 <2.0.0)
+	if _, ok := highestMatchingVersion(spec.Version, []string{manifest.Version}); ok {
+		return nil
+	}
 	
 	return fmt.Errorf("plugin version mismatch: requested %s, found %s", spec.Version, manifest.Version)
 }
 
+// resolvePluginVersion picks the version of a plugin to load and, for git
+// and Go module sources, fetches it into the plugin cache. The returned spec
+// names the exact version and the directory holding it.
+func (r *PluginRegistry) resolvePluginVersion(ctx context.Context, spec PluginSpec) (PluginSpec, error) {
+	resolved, err := r.pickPluginVersion(ctx, spec)
+	if err != nil {
+		return spec, err
+	}
+	return r.cacheRemotePlugin(ctx, resolved, r.lockedPlugin(spec))
+}
+
+// pickPluginVersion picks the version of a plugin to load: the version
+// pinned in the lock file when it still satisfies the spec, otherwise the
+// highest available version that does. The returned spec names that exact
+// version, and for local plugins with one directory per version, that
+// directory. Sources whose versions cannot be listed keep the locked
+// version, or are returned as is.
+func (r *PluginRegistry) pickPluginVersion(ctx context.Context, spec PluginSpec) (PluginSpec, error) {
+	available, err := r.availablePluginVersions(ctx, spec)
+	if err != nil {
+		return spec, err
+	}
+	if len(available) == 0 {
+		if locked := r.lockedPlugin(spec); locked != nil {
+			spec.Version = locked.Version
+		}
+		return spec, nil
+	}
+	// Commits and branch names are left to fetchPlugin
+	if _, err := parseVersionConstraint(spec.Version); err != nil && available[spec.Version] == "" {
+		return spec, nil
+	}
+
+	var versions []string
+	for version := range available {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+
+	constraint := spec.Version
+	if constraint == "" {
+		constraint = "latest"
+	}
+
+	var version string
+	locked := r.lockedPlugin(spec)
+	if locked != nil && available[locked.Version] != "" {
+		if _, ok := highestMatchingVersion(constraint, []string{locked.Version}); ok {
+			version = locked.Version
+		}
+	}
+	if version == "" {
+		if r.frozen {
+			return spec, fmt.Errorf("%s has no usable version of %s %s for %s; run without --locked to update it", lockFileName, spec.Name, constraint, spec.Source)
+		}
+		var ok bool
+		version, ok = highestMatchingVersion(constraint, versions)
+		if !ok {
+			return spec, fmt.Errorf("no version matches %s (available: %s)", constraint, strings.Join(versions, ", "))
+		}
+		if r.lock != nil {
+			r.lock.setPlugin(LockedPlugin{Name: spec.Name, Source: spec.Source, Constraint: constraint, Version: version})
+			r.lockChanged = true
+		}
+	}
+
+	spec.Version = version
+	if isLocalPluginSource(spec.Source) {
+		spec.Source = available[version]
+	}
+	return spec, nil
+}
+
+// cacheRemotePlugin fetches a git or Go module plugin into the plugin cache
+// and points spec at the cached files. Git plugins are fetched at the commit
+// in locked when it pins this version, so a moved tag is not picked up, and
+// the commit fetched is recorded there. Other sources are returned as is.
+func (r *PluginRegistry) cacheRemotePlugin(ctx context.Context, spec PluginSpec, locked *LockedPlugin) (PluginSpec, error) {
+	if !isGitPluginSource(spec.Source) && !isGoModulePluginSource(spec.Source) {
+		return spec, nil
+	}
+	cacheDir, err := r.pluginCacheDir()
+	if err != nil {
+		return spec, err
+	}
+
+	if isGoModulePluginSource(spec.Source) {
+		dir, version, err := fetchGoModulePlugin(ctx, cacheDir, spec.Source, spec.Version)
+		if err != nil {
+			return spec, err
+		}
+		spec.Source, spec.Version = dir, version
+		return spec, nil
+	}
+
+	ref := spec.Version
+	if locked != nil && locked.Version == spec.Version && locked.Revision != "" {
+		ref = locked.Revision
+	}
+	dir, revision, err := fetchGitPlugin(cacheDir, spec.Source, ref, r.update)
+	if err != nil {
+		return spec, fmt.Errorf("failed to fetch %s: %w", spec.Source, err)
+	}
+	if locked != nil && locked.Version == spec.Version && locked.Revision != revision && !r.frozen {
+		locked.Revision = revision
+		r.lockChanged = true
+	}
+
+	// Branches and commits say nothing about the manifest version
+	if _, err := parseSemVersion(spec.Version); err != nil {
+		spec.Version = ""
+	}
+	spec.Source = dir
+	return spec, nil
+}
+
+// pluginCacheDir returns the cache remote plugins are kept in, the build
+// cache directory unless set
+func (r *PluginRegistry) pluginCacheDir() (string, error) {
+	if r.cacheDir == "" {
+		cacheDir, err := buildCacheDir()
+		if err != nil {
+			return "", err
+		}
+		r.cacheDir = cacheDir
+	}
+	return r.cacheDir, nil
+}
+
+// lockedPlugin returns the lock entry for spec, if the lock has one for the
+// same name, source and constraint
+func (r *PluginRegistry) lockedPlugin(spec PluginSpec) *LockedPlugin {
+	if r.lock == nil {
+		return nil
+	}
+	constraint := spec.Version
+	if constraint == "" {
+		constraint = "latest"
+	}
+	for i := range r.lock.Plugins {
+		locked := &r.lock.Plugins[i]
+		if locked.Name == spec.Name && locked.Source == spec.Source && locked.Constraint == constraint {
+			return locked
+		}
+	}
+	return nil
+}
+
+// availablePluginVersions lists the versions a plugin source offers. A
+// local plugin directory offers the version in its manifest, or holds one
+// subdirectory per version (plugins/fs/1.0.0, plugins/fs/1.1.0); the
+// values are the directories. Go modules offer their published versions.
+func (r *PluginRegistry) availablePluginVersions(ctx context.Context, spec PluginSpec) (map[string]string, error) {
+	available := make(map[string]string)
+
+	if isLocalPluginSource(spec.Source) {
+		if manifest, err := r.loadManifest(spec.Source); err == nil {
+			available[manifest.Version] = spec.Source
+			return available, nil
+		}
+		entries, err := os.ReadDir(spec.Source)
+		if err != nil {
+			return nil, nil // Reported when the plugin is fetched
+		}
+		for _, entry := range entries {
+			dir := localPluginPath(spec.Source, entry.Name())
+			if !entry.IsDir() {
+				continue
+			}
+			if manifest, err := r.loadManifest(dir); err == nil && manifest.Version != "" {
+				available[manifest.Version] = dir
+			}
+		}
+		return available, nil
+	}
+
+	if isGitPluginSource(spec.Source) {
+		cacheDir, err := r.pluginCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		mirror, err := gitPluginMirror(cacheDir, spec.Source, r.update)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch %s: %w", spec.Source, err)
+		}
+		tags, err := gitPluginTags(mirror)
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range tags {
+			available[tag] = spec.Source
+		}
+		return available, nil
+	}
+
+	if isGoModulePluginSource(spec.Source) {
+		cmd := exec.CommandContext(ctx, "go", "list", "-m", "-versions", spec.Source)
+		cmd.Dir = os.TempDir()
+		output, err := cmd.Output()
+		if err != nil {
+			// Listing needs the module proxy. go mod download resolves
+			// latest, exact versions and commits without it, and reports its
+			// own errors; ranges cannot be resolved without the list.
+			if _, semErr := parseSemVersion(spec.Version); semErr == nil || spec.Version == "" || spec.Version == "latest" {
+				return nil, nil
+			}
+			if _, constraintErr := parseVersionConstraint(spec.Version); constraintErr != nil {
+				return nil, nil
+			}
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+				err = fmt.Errorf("%w\n%s", err, strings.TrimSpace(string(exitErr.Stderr)))
+			}
+			return nil, fmt.Errorf("failed to list versions of %s for %s: %w", spec.Source, spec.Version, err)
+		}
+		fields := strings.Fields(string(output))
+		for _, version := range fields[min(1, len(fields)):] {
+			available[version] = spec.Source
+		}
+	}
+	return available, nil
+}
+
 // LoadPluginConfig loads plugin configuration from file
 func LoadPluginConfig(configPath string) ([]PluginSpec, error) {
 	data, err := ioutil.ReadFile(configPath)
@@ -588,6 +973,12 @@ func LoadPluginConfig(configPath string) ([]PluginSpec, error) {
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse plugin config: %w", err)
 	}
+	for i := range config.Plugins {
+		spec := &config.Plugins[i]
+		if spec.Config, err = normalizePluginConfig(spec.Config); err != nil {
+			return nil, fmt.Errorf("%s: plugin %s: %w", configPath, spec.Name, err)
+		}
+	}
 
 	return config.Plugins, nil
 }
\ No newline at end of file
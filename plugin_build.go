@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// goPluginsDir holds the Go plugin packages inside a build directory, one
+// subdirectory per plugin
+const goPluginsDir = "hypeplugins"
+
+// GoPluginPackage is a Go plugin compiled into a built executable as its own
+// package. Plugins are written as package main so they also build with
+// -buildmode=plugin; the copy in the build directory is renamed to Package.
+type GoPluginPackage struct {
+	Name       string // Module name the plugin registers
+	Dir        string // Plugin source directory
+	Package    string // Go package name in the build
+	ModulePath string // Module path from the plugin's go.mod; empty without one
+	RunPath    string // Module path hype run gives a plugin without a go.mod
+}
+
+// BuildDir returns the plugin's directory relative to the build directory
+func (p GoPluginPackage) BuildDir() string {
+	return goPluginsDir + "/" + p.Package
+}
+
+// ImportPath returns the path the generated main package imports the plugin
+// by. Plugins without a go.mod become packages of the build module.
+func (p GoPluginPackage) ImportPath() string {
+	if p.ModulePath != "" {
+		return p.ModulePath
+	}
+	return "hype/" + p.BuildDir()
+}
+
+// Alias returns the name the generated main package imports the plugin as
+func (p GoPluginPackage) Alias() string {
+	return p.Package + "Plugin"
+}
+
+// newGoPluginPackage describes the Go plugin in dir. Package names are
+// derived from the plugin name and made unique against taken.
+func newGoPluginPackage(name, dir string, taken map[string]bool) (GoPluginPackage, error) {
+	pkg := GoPluginPackage{Name: name, Dir: dir}
+
+	base := goIdentifier(name, false)
+	if !token.IsIdentifier(base) || token.IsKeyword(base) {
+		base = "plugin" + goIdentifier(name, true)
+	}
+	if !token.IsIdentifier(base) {
+		base = "plugin"
+	}
+	pkg.Package = base
+	for i := 2; taken[pkg.Package]; i++ {
+		pkg.Package = fmt.Sprintf("%s%d", base, i)
+	}
+	taken[pkg.Package] = true
+
+	data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if os.IsNotExist(err) {
+		return pkg, nil
+	}
+	if err != nil {
+		return pkg, fmt.Errorf("failed to read go.mod of plugin %s: %w", name, err)
+	}
+	pkg.ModulePath = goModulePath(data)
+	if pkg.ModulePath == "" {
+		return pkg, fmt.Errorf("go.mod of plugin %s has no module path", name)
+	}
+	return pkg, nil
+}
+
+// goModulePath returns the module path declared in a go.mod file
+func goModulePath(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "module" {
+			continue
+		}
+		if path, err := strconv.Unquote(fields[1]); err == nil {
+			return path
+		}
+		return fields[1]
+	}
+	return ""
+}
+
+// writeGoPlugins copies each Go plugin into the build directory as its own
+// package. Plugins with a go.mod are added to the build module as replaced
+// requirements, so their own dependencies are honored when the module is
+// tidied.
+func writeGoPlugins(buildDir string, plugins []GoPluginPackage) error {
+	modules := make(map[string]string)
+	for _, plugin := range plugins {
+		if plugin.ModulePath != "" {
+			if other, ok := modules[plugin.ModulePath]; ok {
+				return fmt.Errorf("plugins %s and %s share the module path %s", other, plugin.Name, plugin.ModulePath)
+			}
+			if plugin.ModulePath == "hype" || strings.HasPrefix(plugin.ModulePath, "hype/") {
+				return fmt.Errorf("plugin %s uses the module path %s, which is reserved for the build", plugin.Name, plugin.ModulePath)
+			}
+			modules[plugin.ModulePath] = plugin.Name
+		}
+
+		dest := filepath.Join(buildDir, filepath.FromSlash(plugin.BuildDir()))
+		if err := copyModuleTree(plugin.Dir, dest); err != nil {
+			return fmt.Errorf("failed to copy plugin %s: %w", plugin.Name, err)
+		}
+		if err := renameGoPluginPackage(dest, plugin); err != nil {
+			return fmt.Errorf("failed to prepare plugin %s: %w", plugin.Name, err)
+		}
+
+		if plugin.ModulePath != "" {
+			cmd := exec.Command("go", "mod", "edit",
+				"-require="+plugin.ModulePath+"@v0.0.0",
+				"-replace="+plugin.ModulePath+"=./"+plugin.BuildDir())
+			cmd.Dir = buildDir
+			if output, err := cmd.CombinedOutput(); err != nil {
+				return fmt.Errorf("failed to add plugin %s to go.mod: %w\nOutput: %s", plugin.Name, err, output)
+			}
+		}
+	}
+	return nil
+}
+
+// renameGoPluginPackage rewrites the package clause of the plugin's own Go
+// files from main to the plugin's package name. A plugin without a go.mod
+// imports its subpackages under RunPath, which become packages of the build
+// module, so those imports are rewritten throughout the tree. Tests and
+// build artifacts are removed, since they belong to the plugin rather than
+// the build.
+func renameGoPluginPackage(dir string, plugin GoPluginPackage) error {
+	found := false
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		switch {
+		case strings.HasSuffix(entry.Name(), "_test.go") || strings.HasSuffix(entry.Name(), ".so"):
+			return os.Remove(path)
+		case !strings.HasSuffix(entry.Name(), ".go"):
+			return nil
+		}
+		topLevel := filepath.Dir(path) == dir
+		found = found || topLevel
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), path, content, parser.ImportsOnly)
+		if err != nil {
+			return err
+		}
+
+		// Edits are made back to front, so earlier offsets stay valid
+		type edit struct {
+			offset, end int
+			text        string
+		}
+		var edits []edit
+		if topLevel && file.Name.Name == "main" {
+			offset := int(file.Name.Pos()) - 1
+			edits = append(edits, edit{offset, offset + len("main"), plugin.Package})
+		}
+		for _, spec := range file.Imports {
+			importPath, err := strconv.Unquote(spec.Path.Value)
+			if err != nil || plugin.RunPath == "" || !strings.HasPrefix(importPath, plugin.RunPath+"/") {
+				continue
+			}
+			offset := int(spec.Path.Pos()) - 1
+			rewritten := plugin.ImportPath() + strings.TrimPrefix(importPath, plugin.RunPath)
+			edits = append(edits, edit{offset, offset + len(spec.Path.Value), strconv.Quote(rewritten)})
+		}
+		if len(edits) == 0 {
+			return nil
+		}
+		sort.Slice(edits, func(i, j int) bool { return edits[i].offset > edits[j].offset })
+		text := string(content)
+		for _, e := range edits {
+			text = text[:e.offset] + e.text + text[e.end:]
+		}
+		return os.WriteFile(path, []byte(text), 0644)
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("no Go files in %s", dir)
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// goPluginSource is a Go plugin whose module returns the result of the
+// helper function, which lives in a second file
+const goPluginSource = `package main
+
+import lua "github.com/yuin/gopher-lua"
+
+type plugin struct{}
+
+func NewPlugin() interface{} { return &plugin{} }
+
+func (p *plugin) Name() string           { return "NAME" }
+func (p *plugin) Version() string        { return "1.0.0" }
+func (p *plugin) Description() string    { return "" }
+func (p *plugin) Dependencies() []string { return nil }
+func (p *plugin) Close() error           { return nil }
+
+func (p *plugin) Register(L *lua.LState) error {
+	L.PreloadModule("NAME", func(L *lua.LState) int {
+		L.Push(lua.LString(helper()))
+		return 1
+	})
+	return nil
+}
+`
+
+// writeGoPlugin writes a two-file Go plugin. Both plugins of a build
+// declare the same unexported names, which only compile as separate
+// packages.
+func writeGoPlugin(t *testing.T, dir, name, goMod string) {
+	t.Helper()
+	files := map[string]string{
+		"hype-plugin.yaml": "name: " + name + "\nversion: 1.0.0\ntype: go\nmain: plugin.go\n",
+		"plugin.go":        strings.ReplaceAll(goPluginSource, "NAME", name),
+		"helper.go":        "package main\n\nfunc helper() string { return \"from " + name + "\" }\n",
+		"plugin_test.go":   "package main\n",
+	}
+	if goMod != "" {
+		goSum, err := os.ReadFile("go.sum")
+		if err != nil {
+			t.Fatal(err)
+		}
+		files["go.mod"] = goMod
+		files["go.sum"] = string(goSum)
+	}
+	writeLuaFiles(t, filepath.Join(dir, name), files)
+}
+
+func TestBuildMultipleGoPlugins(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds Go plugins")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("Go plugins are not supported on Windows")
+	}
+	if output, err := exec.Command("go", "env", "CGO_ENABLED").Output(); err != nil || strings.TrimSpace(string(output)) != "1" {
+		t.Skip("Go plugins need cgo")
+	}
+
+	dir := t.TempDir()
+	writeGoPlugin(t, dir, "greet", "module example.com/greet\n\ngo 1.21\n\nrequire github.com/yuin/gopher-lua v1.1.1\n")
+	writeGoPlugin(t, dir, "shout", "")
+
+	// Without a go.mod, the plugin's own packages are imported under the
+	// module path hype run builds it with
+	writeLuaFiles(t, filepath.Join(dir, "shout"), map[string]string{
+		"helper.go":      "package main\n\nimport \"hypeplugin/shout/words\"\n\nfunc helper() string { return words.From }\n",
+		"words/words.go": "package words\n\nconst From = \"from shout\"\n",
+	})
+	scriptPath := filepath.Join(dir, "main.lua")
+	if err := os.WriteFile(scriptPath, []byte(`print(require("greet"), require("shout"))`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	specs := []PluginSpec{
+		{Name: "greet", Source: filepath.Join(dir, "greet")},
+		{Name: "shout", Source: filepath.Join(dir, "shout")},
+	}
+	outputPath := filepath.Join(dir, "app")
+	if err := buildExecutableWithOptions(scriptPath, outputPath, "current", specs, BuildOptions{NoCache: true}); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	output, err := exec.Command(outputPath).CombinedOutput()
+	if err != nil {
+		t.Fatalf("Built executable failed: %v\n%s", err, output)
+	}
+	if got := strings.TrimSpace(string(output)); got != "from greet\tfrom shout" {
+		t.Errorf("Output = %q", got)
+	}
+}
+
+func TestNewGoPluginPackage(t *testing.T) {
+	dir := t.TempDir()
+	writeLuaFiles(t, dir, map[string]string{"go.mod": "module \"example.com/kv\" // plugin\n\ngo 1.21\n"})
+
+	taken := make(map[string]bool)
+	tests := []struct {
+		name, dir, pkg, importPath string
+	}{
+		{"my-kv", dir, "myKv", "example.com/kv"},
+		{"my_kv", t.TempDir(), "myKv2", "hype/hypeplugins/myKv2"},
+		{"type", t.TempDir(), "pluginType", "hype/hypeplugins/pluginType"},
+	}
+	for _, tt := range tests {
+		pkg, err := newGoPluginPackage(tt.name, tt.dir, taken)
+		if err != nil {
+			t.Fatalf("newGoPluginPackage(%q) failed: %v", tt.name, err)
+		}
+		if pkg.Package != tt.pkg || pkg.ImportPath() != tt.importPath {
+			t.Errorf("newGoPluginPackage(%q) = %s %s, want %s %s", tt.name, pkg.Package, pkg.ImportPath(), tt.pkg, tt.importPath)
+		}
+	}
+}
+
+func TestBuildMultiFileLuaPlugin(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds an executable")
+	}
+
+	dir := t.TempDir()
+	writeLuaFiles(t, filepath.Join(dir, "tea"), map[string]string{
+		"hype-plugin.yaml": "name: tea\nversion: 1.0.0\ntype: lua\nmain: plugin.lua\n",
+		"plugin.lua":       "local style = require(\"lib.style\")\nlocal n = 0\nreturn {next = function() n = n + 1 return style.bold(n) end}\n",
+		"lib/style.lua":    "return {bold = function(s) return \"*\" .. s .. \"*\" end}\n",
+	})
+	scriptPath := filepath.Join(dir, "main.lua")
+	script := `local tea = require("tea")
+print(tea.next(), tea.next(), require("tea.lib.style").bold("x"))`
+	if err := os.WriteFile(scriptPath, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	specs := []PluginSpec{{Name: "tea", Source: filepath.Join(dir, "tea")}}
+	outputPath := filepath.Join(dir, "app")
+	if err := buildExecutableWithOptions(scriptPath, outputPath, "current", specs, BuildOptions{NoCache: true}); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	output, err := exec.Command(outputPath).CombinedOutput()
+	if err != nil {
+		t.Fatalf("Built executable failed: %v\n%s", err, output)
+	}
+	if got := strings.TrimSpace(string(output)); got != "*1*\t*2*\t*x*" {
+		t.Errorf("Output = %q", got)
+	}
+}
+
+func TestBuildPluginLifecycle(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds an executable")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("sends SIGTERM")
+	}
+
+	dir := t.TempDir()
+	writeLuaFiles(t, filepath.Join(dir, "greeter"), map[string]string{
+		"hype-plugin.yaml": "name: greeter\nversion: 1.0.0\ntype: lua\n",
+		"plugin.lua": `local M = {}
+function M.init(config) M.greeting = config.greeting end
+function M.shutdown() print("bye from " .. M.greeting) end
+return M`,
+	})
+	scriptPath := filepath.Join(dir, "main.lua")
+	script := `print(require("greeter").greeting)
+io.stdout:flush()
+if arg[1] == "wait" then while true do end end`
+	if err := os.WriteFile(scriptPath, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	specs := []PluginSpec{{Name: "greeter", Source: filepath.Join(dir, "greeter"), Config: map[string]interface{}{"greeting": "Hi"}}}
+	outputPath := filepath.Join(dir, "app")
+	if err := buildExecutableWithOptions(scriptPath, outputPath, "current", specs, BuildOptions{NoCache: true}); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	output, err := exec.Command(outputPath).CombinedOutput()
+	if err != nil {
+		t.Fatalf("Built executable failed: %v\n%s", err, output)
+	}
+	if got := string(output); got != "Hi\nbye from Hi\n" {
+		t.Errorf("Output = %q", got)
+	}
+
+	// An interrupted script shuts its plugins down too
+	cmd := exec.Command(outputPath, "wait")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(stdout)
+	if line, err := reader.ReadString('\n'); err != nil || line != "Hi\n" {
+		t.Fatalf("First line = %q, %v", line, err)
+	}
+	cmd.Process.Signal(syscall.SIGTERM)
+	rest, _ := io.ReadAll(reader)
+	if err := cmd.Wait(); err != nil {
+		t.Errorf("Interrupted executable failed: %v", err)
+	}
+	if got := string(rest); got != "bye from Hi\n" {
+		t.Errorf("Output after SIGTERM = %q", got)
+	}
+}
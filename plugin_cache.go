@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Remote plugins are kept in the cache next to the build cache, keyed by
+// source and revision, so they are fetched once and then load offline:
+//
+//	<cache>/plugins/git/<hash>.git   bare mirror of a git source
+//	<cache>/plugins/src/<hash>/      plugin files at one revision
+//
+// A revision's files never change, so entries are reused without checking.
+const (
+	pluginCacheDir    = "plugins"
+	pluginCacheGit    = "git"
+	pluginCacheSource = "src"
+)
+
+// gitPluginPrefix marks git plugin sources, e.g. git+https://host/fs.git
+const gitPluginPrefix = "git+"
+
+// isGitPluginSource reports whether a plugin source is a git repository
+func isGitPluginSource(source string) bool {
+	return strings.HasPrefix(source, gitPluginPrefix)
+}
+
+// isGoModulePluginSource reports whether a plugin source is a Go module
+// path such as github.com/user/hype-fs
+func isGoModulePluginSource(source string) bool {
+	return strings.Contains(source, "/") && !strings.Contains(source, "://") &&
+		!isLocalPluginSource(source) && !isGitPluginSource(source)
+}
+
+// cacheHash names a cache entry after what it holds
+func cacheHash(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// cachedPluginSourceDir returns where the files of source at revision are
+// cached
+func cachedPluginSourceDir(cacheDir, source, revision string) string {
+	return filepath.Join(cacheDir, pluginCacheDir, pluginCacheSource, cacheHash(source, revision))
+}
+
+// gitPluginMirror returns a bare mirror of a git plugin source, cloning it
+// on first use and fetching new commits and tags when update is set
+func gitPluginMirror(cacheDir, source string, update bool) (string, error) {
+	url := strings.TrimPrefix(source, gitPluginPrefix)
+	mirror := filepath.Join(cacheDir, pluginCacheDir, pluginCacheGit, cacheHash(url)+".git")
+
+	if _, err := os.Stat(mirror); err == nil {
+		if update {
+			if err := runGit(mirror, "fetch", "--quiet", "--prune", "--tags", "origin"); err != nil {
+				return "", err
+			}
+		}
+		return mirror, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(mirror), 0755); err != nil {
+		return "", fmt.Errorf("failed to create plugin cache: %w", err)
+	}
+	staging, err := os.MkdirTemp(filepath.Dir(mirror), ".tmp-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(staging)
+
+	clone := filepath.Join(staging, "mirror.git")
+	if err := runGit("", "clone", "--quiet", "--mirror", "--", url, clone); err != nil {
+		return "", err
+	}
+	if err := os.Rename(clone, mirror); err != nil {
+		// Another hype process cloned it first
+		if _, statErr := os.Stat(mirror); statErr != nil {
+			return "", err
+		}
+	}
+	return mirror, nil
+}
+
+// gitPluginTags lists the tags of a git plugin source
+func gitPluginTags(mirror string) ([]string, error) {
+	output, err := exec.Command("git", "-C", mirror, "tag", "--list").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+	return strings.Fields(string(output)), nil
+}
+
+// gitRevision returns the commit a tag, branch or commit names in mirror.
+// A ref that git would read as an option names nothing.
+func gitRevision(mirror, ref string) (string, bool) {
+	if ref == "" || ref == "latest" {
+		ref = "HEAD"
+	}
+	if strings.HasPrefix(ref, "-") {
+		return "", false
+	}
+	output, err := exec.Command("git", "-C", mirror, "rev-parse", "--verify", "--quiet", ref+"^{commit}").Output()
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(output)), true
+}
+
+// fetchGitPlugin returns the cached files of a git plugin source at ref,
+// and the commit they are from. The mirror is only updated when ref is not
+// in it yet, or when update is set.
+func fetchGitPlugin(cacheDir, source, ref string, update bool) (string, string, error) {
+	mirror, err := gitPluginMirror(cacheDir, source, update)
+	if err != nil {
+		return "", "", err
+	}
+	revision, ok := gitRevision(mirror, ref)
+	if !ok && !update {
+		if mirror, err = gitPluginMirror(cacheDir, source, true); err != nil {
+			return "", "", err
+		}
+		revision, ok = gitRevision(mirror, ref)
+	}
+	if !ok {
+		return "", "", fmt.Errorf("version %s not found in %s", ref, source)
+	}
+
+	dir := cachedPluginSourceDir(cacheDir, source, revision)
+	if _, err := os.Stat(dir); err == nil {
+		return dir, revision, nil
+	}
+
+	staging, err := os.MkdirTemp(filepath.Dir(mirror), ".tmp-")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.RemoveAll(staging)
+
+	checkout := filepath.Join(staging, "src")
+	if _, err := cloneGitRevision(mirror, revision, checkout); err != nil {
+		return "", "", err
+	}
+	if err := renameIntoCache(checkout, dir); err != nil {
+		return "", "", err
+	}
+	return dir, revision, nil
+}
+
+// fetchGoModulePlugin returns the cached files of a Go module plugin at
+// version ("latest" when empty) and the exact version downloaded. Exact
+// versions already in the cache are used without running go.
+func fetchGoModulePlugin(ctx context.Context, cacheDir, source, version string) (string, string, error) {
+	if version == "" {
+		version = "latest"
+	}
+	if _, err := parseSemVersion(version); err == nil {
+		dir := cachedPluginSourceDir(cacheDir, source, version)
+		if _, err := os.Stat(dir); err == nil {
+			return dir, version, nil
+		}
+	}
+
+	// go mod download needs a module to run in
+	workDir, err := os.MkdirTemp("", "hype-plugin-*")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+	if err := os.WriteFile(filepath.Join(workDir, "go.mod"), []byte("module temp\n\ngo 1.21\n"), 0644); err != nil {
+		return "", "", fmt.Errorf("failed to create temp go.mod: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, "go", "mod", "download", "-json", source+"@"+version)
+	cmd.Dir = workDir
+	output, err := cmd.Output()
+	var download struct {
+		Version string
+		Dir     string
+		Error   string
+	}
+	if jsonErr := json.Unmarshal(output, &download); jsonErr != nil || download.Error != "" || err != nil {
+		message := download.Error
+		if message == "" && err != nil {
+			message = err.Error()
+		}
+		return "", "", fmt.Errorf("failed to download module %s@%s: %s", source, version, message)
+	}
+
+	dir := cachedPluginSourceDir(cacheDir, source, download.Version)
+	if _, err := os.Stat(dir); err == nil {
+		return dir, download.Version, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", "", fmt.Errorf("failed to create plugin cache: %w", err)
+	}
+	staging, err := os.MkdirTemp(filepath.Dir(dir), ".tmp-")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.RemoveAll(staging)
+
+	// The module cache is read-only, so the files are copied rather than
+	// linked
+	checkout := filepath.Join(staging, "src")
+	if err := copyModuleTree(download.Dir, checkout); err != nil {
+		return "", "", fmt.Errorf("failed to copy module %s: %w", source, err)
+	}
+	if err := renameIntoCache(checkout, dir); err != nil {
+		return "", "", err
+	}
+	return dir, download.Version, nil
+}
+
+// renameIntoCache moves a finished entry into place, accepting an entry
+// another hype process finished first
+func renameIntoCache(staging, dir string) error {
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return fmt.Errorf("failed to create plugin cache: %w", err)
+	}
+	if err := os.Rename(staging, dir); err != nil {
+		if _, statErr := os.Stat(dir); statErr != nil {
+			return fmt.Errorf("failed to store plugin in cache: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGitPluginCache(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	repo := filepath.Join(t.TempDir(), "greet")
+	if err := os.MkdirAll(repo, 0755); err != nil {
+		t.Fatal(err)
+	}
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+	}
+	release := func(version, content string) {
+		t.Helper()
+		writeLuaFiles(t, repo, map[string]string{
+			"hype-plugin.yaml": fmt.Sprintf("name: greet\nversion: %s\ntype: lua\nmain: plugin.lua\n", version),
+			"plugin.lua":       fmt.Sprintf("return {content = %q}", content),
+		})
+		git("add", "-A")
+		git("commit", "-qm", version)
+	}
+	git("init", "-q")
+	for _, version := range []string{"1.0.0", "1.1.0", "2.0.0"} {
+		release(version, version)
+		git("tag", "v"+version)
+	}
+
+	projectDir := t.TempDir()
+	cacheDir := t.TempDir()
+	spec := PluginSpec{Name: "greet", Source: "git+file://" + filepath.ToSlash(repo), Version: "^1.0.0"}
+	newRegistry := func() *PluginRegistry {
+		registry := NewPluginRegistry()
+		registry.cacheDir = cacheDir
+		if err := registry.UseLockFile(projectDir, false); err != nil {
+			t.Fatal(err)
+		}
+		return registry
+	}
+	loadContent := func() string {
+		t.Helper()
+		registry := newRegistry()
+		if err := registry.LoadPlugins(context.Background(), []PluginSpec{spec}); err != nil {
+			t.Fatalf("LoadPlugins failed: %v", err)
+		}
+		wrapper := registry.plugins[0].(*LuaPluginWrapper)
+		files, err := wrapper.Files()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(files[wrapper.main])
+	}
+
+	resolved, err := newRegistry().FetchPlugins(context.Background(), []PluginSpec{spec})
+	if err != nil {
+		t.Fatalf("FetchPlugins failed: %v", err)
+	}
+	if resolved[0].Version != "v1.1.0" {
+		t.Errorf("Fetched %s, want v1.1.0", resolved[0].Version)
+	}
+	lock, err := loadLockFile(projectDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lock.Plugins) != 1 || lock.Plugins[0].Version != "v1.1.0" || len(lock.Plugins[0].Revision) != 40 {
+		t.Fatalf("Unexpected lock %+v", lock.Plugins)
+	}
+
+	// Moving the tag does not change what the lock pins, even after an update
+	release("1.1.0", "retagged")
+	git("tag", "-f", "v1.1.0")
+	if _, err := newRegistry().FetchPlugins(context.Background(), []PluginSpec{spec}); err != nil {
+		t.Fatalf("FetchPlugins failed: %v", err)
+	}
+	if got := loadContent(); got != `return {content = "1.1.0"}` {
+		t.Errorf("Loaded %s, want the locked commit", got)
+	}
+
+	// Cached plugins load without the repository
+	if err := os.RemoveAll(repo); err != nil {
+		t.Fatal(err)
+	}
+	if got := loadContent(); got != `return {content = "1.1.0"}` {
+		t.Errorf("Loaded %s offline", got)
+	}
+}
+
+func TestParsePluginSpecsRemoteSources(t *testing.T) {
+	specs, err := ParsePluginSpecs([]string{
+		"git+https://github.com/user/hype-fs.git@^1.2.0",
+		"kv=git+ssh://git@example.com/org/kv.git",
+		"github.com/user/hype-json@v1.0.0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PluginSpec{
+		{Name: "hype-fs", Source: "git+https://github.com/user/hype-fs.git", Version: "^1.2.0"},
+		{Name: "kv", Alias: "kv", Source: "git+ssh://git@example.com/org/kv.git", Version: "latest"},
+		{Name: "hype-json", Source: "github.com/user/hype-json", Version: "v1.0.0"},
+	}
+	for i := range want {
+		if !reflect.DeepEqual(specs[i], want[i]) {
+			t.Errorf("spec %d = %+v, want %+v", i, specs[i], want[i])
+		}
+	}
+	if !isGitPluginSource(specs[0].Source) || !isGoModulePluginSource(specs[2].Source) || isGoModulePluginSource(specs[1].Source) {
+		t.Errorf("Source kinds detected wrongly")
+	}
+}
+
+func TestGoModulePluginVersionsUnlisted(t *testing.T) {
+	t.Setenv("GOPROXY", "off")
+	registry := NewPluginRegistry()
+
+	// A range needs the version list, so failing to list it is an error
+	_, err := registry.availablePluginVersions(context.Background(), PluginSpec{Name: "json", Source: "example.com/hype-json", Version: "^1.0.0"})
+	if err == nil || !strings.Contains(err.Error(), "failed to list versions of example.com/hype-json") {
+		t.Fatalf("Expected a listing error, got %v", err)
+	}
+
+	// Exact versions are left to go mod download
+	available, err := registry.availablePluginVersions(context.Background(), PluginSpec{Name: "json", Source: "example.com/hype-json", Version: "v1.0.0"})
+	if err != nil || len(available) != 0 {
+		t.Fatalf("Expected no versions and no error, got %v, %v", available, err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// normalizePluginConfig converts the config block of a plugin entry, as
+// parsed from YAML, to the JSON values plugins receive: nil, bool, float64,
+// string, []interface{} and map[string]interface{}. The config then looks
+// the same to a plugin in hype run, Go builds and stub builds, which embed
+// it as JSON.
+func normalizePluginConfig(config map[string]interface{}) (map[string]interface{}, error) {
+	if config == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(yamlToJSON(config))
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	var normalized map[string]interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return normalized, nil
+}
+
+// yamlToJSON replaces the map[interface{}]interface{} values yaml.v2
+// decodes mappings into with maps encoding/json can encode
+func yamlToJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = yamlToJSON(item)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[key] = yamlToJSON(item)
+		}
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = yamlToJSON(item)
+		}
+		return items
+	}
+	return value
+}
+
+// pluginConfigJSON encodes a plugin's config for the generated main
+// package, which decodes it with hyperuntime.ParsePluginConfig. Plugins
+// without a config get "".
+func pluginConfigJSON(config map[string]interface{}) (string, error) {
+	if config == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode plugin config: %w", err)
+	}
+	return string(data), nil
+}
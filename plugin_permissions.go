@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Plugins declare the capabilities they need with permissions: in
+// hype-plugin.yaml. Lua plugins are sandboxed to them at runtime (see
+// hyperuntime/permissions.go). Go and rpc plugins run native code that
+// cannot be sandboxed, so for them the permissions are declarative: shown
+// at load and checked against hype.yaml like any other, but not enforced.
+
+// printPluginPermissions shows the permissions a plugin requests as it is
+// loaded
+func printPluginPermissions(plugin HypePlugin) {
+	permissions := plugin.Permissions()
+	if len(permissions) == 0 {
+		return
+	}
+	note := ""
+	if _, ok := plugin.(*LuaPluginWrapper); !ok {
+		note = " (not enforced for native plugins)"
+	}
+	fmt.Fprintf(os.Stderr, "Plugin %s %s requests %s%s\n", plugin.Name(), plugin.Version(), strings.Join(permissions, ", "), note)
+}
+
+// checkPluginPermissions returns an error for the first plugin that
+// requests a permission its spec does not allow
+func checkPluginPermissions(plugins []HypePlugin, specs []PluginSpec) error {
+	for i, plugin := range plugins {
+		allowed := make(map[string]bool)
+		for _, permission := range specs[i].Permissions {
+			allowed[permission] = true
+		}
+		var denied []string
+		for _, permission := range plugin.Permissions() {
+			if !allowed[permission] {
+				denied = append(denied, permission)
+			}
+		}
+		if len(denied) == 0 {
+			continue
+		}
+		grant := fmt.Sprintf("permissions: [%s]", strings.Join(plugin.Permissions(), ", "))
+		// A plugin added for another plugin has no entry of its own; listing
+		// it under plugins: gives it one, and the plugin requiring it uses it
+		if specs[i].RequiredBy != "" {
+			return fmt.Errorf("plugin %s, required by %s, requests %s, which is not allowed; grant it by adding an entry with name: %s and %s under plugins: in %s or --plugins-config", plugin.Name(), specs[i].RequiredBy, strings.Join(denied, ", "), specs[i].Name, grant, projectFileName)
+		}
+		return fmt.Errorf("plugin %s requests %s, which is not allowed; grant it with %s in the plugin's entry in %s or --plugins-config", plugin.Name(), strings.Join(denied, ", "), grant, projectFileName)
+	}
+	return nil
+}
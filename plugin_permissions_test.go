@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckPluginPermissions(t *testing.T) {
+	plugin := &LuaPluginWrapper{
+		manifest: &PluginManifest{Name: "store", Version: "1.0.0", Permissions: []string{"fs:read", "kv"}},
+		spec:     PluginSpec{Name: "store"},
+	}
+
+	tests := []struct {
+		allowed []string
+		denied  string
+	}{
+		{[]string{"fs:read", "kv", "net:dial"}, ""},
+		{[]string{"fs:read"}, "plugin store requests kv, which is not allowed; grant it with permissions: [fs:read, kv]"},
+		{nil, "plugin store requests fs:read, kv, which"},
+	}
+	for _, tt := range tests {
+		err := checkPluginPermissions([]HypePlugin{plugin}, []PluginSpec{{Name: "store", Permissions: tt.allowed}})
+		if tt.denied == "" {
+			if err != nil {
+				t.Errorf("allowed %v: unexpected error %v", tt.allowed, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.denied) {
+			t.Errorf("allowed %v: error = %v, want %q", tt.allowed, err, tt.denied)
+		}
+	}
+}
+
+func TestBuildPluginPermissions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds an executable")
+	}
+
+	dir := t.TempDir()
+	writeLuaFiles(t, filepath.Join(dir, "reader"), map[string]string{
+		"hype-plugin.yaml": "name: reader\nversion: 1.0.0\ntype: lua\npermissions: [fs:read]\n",
+		"plugin.lua": `return {
+    read = function(path) local f = assert(io.open(path)) local s = f:read("*a") f:close() return s end,
+    write = function(path) return pcall(io.open, path, "w") end,
+}`,
+	})
+	data := filepath.Join(dir, "data.txt")
+	if err := os.WriteFile(data, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	scriptPath := filepath.Join(dir, "main.lua")
+	script := `local reader = require("reader")
+local ok, err = reader.write(arg[1])
+print(reader.read(arg[1]), ok, err)`
+	if err := os.WriteFile(scriptPath, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outputPath := filepath.Join(dir, "app")
+
+	specs := []PluginSpec{{Name: "reader", Source: filepath.Join(dir, "reader")}}
+	err := buildExecutableWithOptions(scriptPath, outputPath, "current", specs, BuildOptions{})
+	if err == nil || !strings.Contains(err.Error(), "plugin reader requests fs:read, which is not allowed") {
+		t.Fatalf("Expected the build to fail without permission, got %v", err)
+	}
+
+	specs[0].Permissions = []string{"fs:read"}
+	if err := buildExecutableWithOptions(scriptPath, outputPath, "current", specs, BuildOptions{}); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	output, err := exec.Command(outputPath, data).CombinedOutput()
+	if err != nil {
+		t.Fatalf("Built executable failed: %v\n%s", err, output)
+	}
+	if got := string(output); !strings.HasPrefix(got, "secret\tfalse\t") || !strings.Contains(got, "does not have the fs:write permission") {
+		t.Errorf("Output = %q", got)
+	}
+}
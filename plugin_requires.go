@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Plugins declare the other hype plugins they build on with requires: in
+// hype-plugin.yaml, mapping plugin names to version ranges:
+//
+//	requires:
+//	  bubbletea: ^1.0.0
+//
+// Go module dependencies stay under dependencies:. LoadPlugins resolves the
+// plugins required, transitively, and loads and registers every plugin
+// after the plugins it requires, so a plugin can require their modules
+// while it registers.
+
+// resolvePluginGraph resolves the versions of the plugins in specs and of
+// the plugins they require. A required plugin that is not among specs is
+// looked up by name like a bare --plugins name: under plugins/,
+// examples/plugins/ and in $HYPE_PLUGIN_PATH, at the highest version the
+// first plugin requiring it allows. Every plugin must then satisfy the
+// ranges of all the plugins requiring it; there is no backtracking to
+// other versions. The listings returned hold the plugins in specs, in
+// order, followed by the plugins added for them.
+func (r *PluginRegistry) resolvePluginGraph(ctx context.Context, specs []PluginSpec) ([]pluginListing, error) {
+	var listings []pluginListing
+	byName := make(map[string]int)
+	via := make(map[string]string) // Why a plugin was added, for errors
+
+	resolve := func(spec PluginSpec) (pluginListing, error) {
+		listing := pluginListing{Spec: spec}
+		resolved, err := r.resolvePluginVersion(ctx, spec)
+		if err != nil {
+			return listing, err
+		}
+		listing.Resolved = resolved
+		// Plugins without a readable manifest are left to loadPlugin to
+		// report; they require nothing
+		listing.Manifest, listing.Err = r.loadManifest(resolved.Source)
+		return listing, nil
+	}
+
+	for _, spec := range specs {
+		listing, err := resolve(spec)
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s: %w", spec.Name, err)
+		}
+		if _, ok := byName[listing.Name()]; !ok {
+			byName[listing.Name()] = len(listings)
+		}
+		listings = append(listings, listing)
+	}
+
+	// Plugins added while walking the graph are appended to listings and
+	// walked in turn
+	for i := 0; i < len(listings); i++ {
+		dependent := listings[i]
+		if dependent.Manifest == nil {
+			continue
+		}
+		for _, name := range sortedRequires(dependent.Manifest) {
+			constraint := dependent.Manifest.Requires[name]
+			if _, err := parseVersionConstraint(constraint); err != nil {
+				return nil, fmt.Errorf("plugin %s requires %s: %w", dependent.Name(), name, err)
+			}
+			required := fmt.Sprintf("plugin %s requires %s %s", dependent.Name(), name, displayConstraint(constraint))
+
+			j, ok := byName[name]
+			if !ok {
+				source, found := findConventionalPlugin(".", name)
+				if !found {
+					return nil, fmt.Errorf("%s, which is not among the plugins and was not found in plugins/, examples/plugins/ or $%s", required, pluginPathEnv)
+				}
+				listing, err := resolve(PluginSpec{Name: name, Source: source, Version: constraint, RequiredBy: dependent.Name()})
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", required, err)
+				}
+				if listing.Err != nil {
+					return nil, fmt.Errorf("%s: %w", required, listing.Err)
+				}
+				if listing.Name() != name {
+					return nil, fmt.Errorf("%s, but %s holds plugin %s", required, source, listing.Name())
+				}
+				j = len(listings)
+				byName[name] = j
+				via[name] = fmt.Sprintf(" (added for %s %s)", dependent.Name(), displayConstraint(constraint))
+				listings = append(listings, listing)
+			}
+
+			if manifest := listings[j].Manifest; manifest != nil {
+				if _, ok := highestMatchingVersion(constraint, []string{manifest.Version}); !ok {
+					return nil, fmt.Errorf("%s, but %s %s is loaded%s", required, name, manifest.Version, via[name])
+				}
+			}
+		}
+	}
+	return listings, nil
+}
+
+// sortPluginGraph orders listings so that every plugin comes after the
+// plugins it requires, keeping them in their order otherwise. A plugin
+// that requires itself, directly or through other plugins, is an error.
+func sortPluginGraph(listings []pluginListing) ([]pluginListing, error) {
+	byName := make(map[string]int)
+	for i, listing := range listings {
+		if _, ok := byName[listing.Name()]; !ok {
+			byName[listing.Name()] = i
+		}
+	}
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make([]int, len(listings))
+	var sorted []pluginListing
+	var path []string
+	var visit func(i int) error
+	visit = func(i int) error {
+		name := listings[i].Name()
+		switch state[i] {
+		case done:
+			return nil
+		case visiting:
+			for start, visited := range path {
+				if visited == name {
+					return fmt.Errorf("plugins require each other: %s", strings.Join(append(path[start:], name), " -> "))
+				}
+			}
+		}
+		state[i] = visiting
+		path = append(path, name)
+		if manifest := listings[i].Manifest; manifest != nil {
+			for _, required := range sortedRequires(manifest) {
+				if j, ok := byName[required]; ok {
+					if err := visit(j); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = done
+		sorted = append(sorted, listings[i])
+		return nil
+	}
+
+	for i := range listings {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+// sortedRequires returns the names of the plugins a manifest requires, in
+// a stable order
+func sortedRequires(manifest *PluginManifest) []string {
+	names := make([]string, 0, len(manifest.Requires))
+	for name := range manifest.Requires {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// displayConstraint shows an empty version range as the any version it stands for
+func displayConstraint(constraint string) string {
+	if constraint == "" {
+		return "*"
+	}
+	return constraint
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"hype/hyperuntime"
+)
+
+// writeRequiringPlugin writes a Lua plugin that requires other plugins.
+// Its module reports its version and the versions of the plugins it
+// requires, as required from inside the plugin.
+func writeRequiringPlugin(t *testing.T, dir, name, version string, requires map[string]string) {
+	t.Helper()
+	manifest := fmt.Sprintf("name: %s\nversion: %s\ntype: lua\n", name, version)
+	main := fmt.Sprintf("local parts = {%q}\n", name+" "+version)
+	if len(requires) > 0 {
+		manifest += "requires:\n"
+		for _, required := range sortedRequires(&PluginManifest{Requires: requires}) {
+			manifest += fmt.Sprintf("  %s: %q\n", required, requires[required])
+			main += fmt.Sprintf("table.insert(parts, require(%q).describe())\n", required)
+		}
+	}
+	main += "return {describe = function() return table.concat(parts, \" < \") end}\n"
+	writeLuaFiles(t, filepath.Join(dir, version), map[string]string{
+		"hype-plugin.yaml": manifest,
+		"plugin.lua":       main,
+	})
+}
+
+func TestLoadPluginsRequires(t *testing.T) {
+	dir := t.TempDir()
+	plugins := filepath.Join(dir, "plugins")
+	writeRequiringPlugin(t, filepath.Join(plugins, "tea"), "tea", "1.0.0", nil)
+	writeRequiringPlugin(t, filepath.Join(plugins, "tea"), "tea", "1.5.0", nil)
+	writeRequiringPlugin(t, filepath.Join(plugins, "tea"), "tea", "2.0.0", nil)
+	writeRequiringPlugin(t, filepath.Join(plugins, "style"), "style", "1.0.0", map[string]string{"tea": ">=1.0.0"})
+	writeRequiringPlugin(t, filepath.Join(plugins, "uikit"), "uikit", "1.0.0", map[string]string{"tea": "^1.0.0", "style": ""})
+	t.Setenv(pluginPathEnv, plugins)
+
+	// tea and style are found by name. tea is loaded at the highest
+	// version uikit's ^1.0.0 allows, which satisfies style's >=1.0.0 too.
+	registry := NewPluginRegistry()
+	if err := registry.LoadPlugins(context.Background(), []PluginSpec{{Name: "uikit", Source: filepath.Join(plugins, "uikit")}}); err != nil {
+		t.Fatalf("LoadPlugins failed: %v", err)
+	}
+	var loaded []string
+	for _, plugin := range registry.plugins {
+		loaded = append(loaded, plugin.Name()+" "+plugin.Version())
+	}
+	if got := strings.Join(loaded, ", "); got != "tea 1.5.0, style 1.0.0, uikit 1.0.0" {
+		t.Errorf("Loaded %s, want every plugin after the plugins it requires", got)
+	}
+
+	L := hyperuntime.NewState("test.lua", nil)
+	defer L.Close()
+	if err := registry.RegisterAll(L); err != nil {
+		t.Fatalf("RegisterAll failed: %v", err)
+	}
+	if err := L.DoString(`result = require("uikit").describe()`); err != nil {
+		t.Fatalf("Script failed: %v", err)
+	}
+	if got := L.GetGlobal("result").String(); got != "uikit 1.0.0 < style 1.0.0 < tea 1.5.0 < tea 1.5.0" {
+		t.Errorf("result = %q", got)
+	}
+}
+
+func TestLoadPluginsRequiresErrors(t *testing.T) {
+	dir := t.TempDir()
+	plugins := filepath.Join(dir, "plugins")
+	writeRequiringPlugin(t, filepath.Join(plugins, "tea"), "tea", "1.0.0", nil)
+	writeRequiringPlugin(t, filepath.Join(plugins, "tea"), "tea", "2.0.0", nil)
+	writeRequiringPlugin(t, filepath.Join(plugins, "old"), "old", "1.0.0", map[string]string{"tea": "^1.0.0"})
+	writeRequiringPlugin(t, filepath.Join(plugins, "new"), "new", "1.0.0", map[string]string{"tea": "^2.0.0"})
+	writeRequiringPlugin(t, filepath.Join(plugins, "ping"), "ping", "1.0.0", map[string]string{"pong": "*"})
+	writeRequiringPlugin(t, filepath.Join(plugins, "pong"), "pong", "1.0.0", map[string]string{"ping": "*"})
+	writeRequiringPlugin(t, filepath.Join(plugins, "lonely"), "lonely", "1.0.0", map[string]string{"missing": "^1.0.0"})
+	writeRequiringPlugin(t, filepath.Join(plugins, "broken"), "broken", "1.0.0", map[string]string{"tea": "^one"})
+	t.Setenv(pluginPathEnv, plugins)
+
+	spec := func(name, version string) PluginSpec {
+		return PluginSpec{Name: name, Source: filepath.Join(plugins, name), Version: version}
+	}
+	tests := []struct {
+		name  string
+		specs []PluginSpec
+		want  string
+	}{
+		{"conflict with a given plugin", []PluginSpec{spec("tea", "1.0.0"), spec("new", "")}, "plugin new requires tea ^2.0.0, but tea 1.0.0 is loaded"},
+		{"conflict between requirements", []PluginSpec{spec("old", ""), spec("new", "")}, "plugin new requires tea ^2.0.0, but tea 1.0.0 is loaded (added for old ^1.0.0)"},
+		{"no matching version", []PluginSpec{spec("old", ""), {Name: "tea", Source: filepath.Join(plugins, "tea", "2.0.0")}}, "plugin old requires tea ^1.0.0, but tea 2.0.0 is loaded"},
+		{"cycle", []PluginSpec{spec("ping", "")}, "plugins require each other: ping -> pong -> ping"},
+		{"missing", []PluginSpec{spec("lonely", "")}, "plugin lonely requires missing ^1.0.0, which is not among the plugins"},
+		{"invalid range", []PluginSpec{spec("broken", "")}, "plugin broken requires tea: invalid version constraint"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewPluginRegistry().LoadPlugins(context.Background(), tt.specs)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadPlugins error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequiredPluginPermissions(t *testing.T) {
+	dir := t.TempDir()
+	plugins := filepath.Join(dir, "plugins")
+	writeLuaFiles(t, filepath.Join(plugins, "files", "1.0.0"), map[string]string{
+		"hype-plugin.yaml": "name: files\nversion: 1.0.0\ntype: lua\npermissions: [fs:read]\n",
+		"plugin.lua":       "return {}",
+	})
+	writeRequiringPlugin(t, filepath.Join(plugins, "app"), "app", "1.0.0", map[string]string{"files": "^1.0.0"})
+	t.Setenv(pluginPathEnv, plugins)
+	app := PluginSpec{Name: "app", Source: filepath.Join(plugins, "app")}
+
+	registry := NewPluginRegistry()
+	if err := registry.LoadPlugins(context.Background(), []PluginSpec{app}); err != nil {
+		t.Fatalf("LoadPlugins failed: %v", err)
+	}
+	err := checkPluginPermissions(registry.plugins, registry.specs)
+	if err == nil || !strings.Contains(err.Error(), "plugin files, required by app, requests fs:read") || !strings.Contains(err.Error(), "name: files") {
+		t.Errorf("Expected a denied permission naming the requiring plugin, got %v", err)
+	}
+
+	// An entry for the required plugin grants it permissions, and app
+	// uses the plugin loaded for it
+	source, ok := findConventionalPlugin(".", "files")
+	if !ok {
+		t.Fatalf("files not found in $%s", pluginPathEnv)
+	}
+	files := PluginSpec{Name: "files", Source: source, Version: "^1.0.0", Permissions: []string{"fs:read"}}
+	registry = NewPluginRegistry()
+	if err := registry.LoadPlugins(context.Background(), []PluginSpec{app, files}); err != nil {
+		t.Fatalf("LoadPlugins failed: %v", err)
+	}
+	if len(registry.plugins) != 2 {
+		t.Errorf("Loaded %d plugins, want files once", len(registry.plugins))
+	}
+	if err := checkPluginPermissions(registry.plugins, registry.specs); err != nil {
+		t.Errorf("checkPluginPermissions failed: %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"hype/hyperuntime"
+	"hype/pluginrpc"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// Go plugins with transport: rpc run as a child process that speaks the
+// pluginrpc protocol over stdio, instead of being loaded with plugin.Open.
+// They need neither cgo nor the exact toolchain and dependency versions hype
+// was built with.
+const (
+	transportPlugin = "plugin" // -buildmode=plugin, the default
+	transportRPC    = "rpc"
+)
+
+// rpcPluginStartTimeout is how long a plugin process gets to answer the
+// describe request after it starts
+const rpcPluginStartTimeout = 30 * time.Second
+
+// loadRPCPlugin starts an out-of-process plugin. Plugins that list a command
+// in their manifest run it from their source directory; other Go plugins are
+// built into a temporary executable first.
+func (r *PluginRegistry) loadRPCPlugin(ctx context.Context, spec PluginSpec, manifest *PluginManifest, pluginDir string) (HypePlugin, error) {
+	sourceDir, err := filepath.Abs(spec.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapper := &RPCPluginWrapper{manifest: manifest, spec: spec}
+	var cmd *exec.Cmd
+	if len(manifest.Command) > 0 {
+		program := manifest.Command[0]
+		if local := filepath.Join(sourceDir, program); !filepath.IsAbs(program) && fileExists(local) {
+			program = local
+		}
+		cmd = exec.Command(program, manifest.Command[1:]...)
+	} else {
+		if manifest.Type != "go" {
+			return nil, fmt.Errorf("rpc plugins of type %s need a command in hype-plugin.yaml", manifest.Type)
+		}
+		if _, err := os.Stat(filepath.Join(pluginDir, "go.mod")); os.IsNotExist(err) {
+			if err := writePluginModule(pluginDir, manifest.Name); err != nil {
+				return nil, err
+			}
+		}
+
+		// pluginDir is removed once the plugin is loaded, so the executable
+		// lives in a directory of its own until Close
+		wrapper.binDir, err = os.MkdirTemp("", "hype-rpc-plugin-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temp dir: %w", err)
+		}
+		program := filepath.Join(wrapper.binDir, "plugin")
+		if runtime.GOOS == "windows" {
+			program += ".exe"
+		}
+		build := exec.CommandContext(ctx, "go", "build", "-o", program, ".")
+		build.Dir = pluginDir
+		if output, err := build.CombinedOutput(); err != nil {
+			os.RemoveAll(wrapper.binDir)
+			return nil, fmt.Errorf("failed to build plugin: %w\nOutput: %s", err, output)
+		}
+		cmd = exec.Command(program)
+	}
+	cmd.Dir = sourceDir
+	cmd.Stderr = os.Stderr
+
+	client, err := pluginrpc.Start(cmd)
+	if err != nil {
+		wrapper.Close()
+		return nil, err
+	}
+	wrapper.client = client
+
+	// A plugin that never answers the handshake must not hang hype
+	startCtx, cancel := context.WithTimeout(ctx, rpcPluginStartTimeout)
+	defer cancel()
+	if wrapper.description, err = client.Describe(startCtx); err != nil {
+		wrapper.Close()
+		return nil, fmt.Errorf("plugin did not describe itself: %w", err)
+	}
+	return wrapper, nil
+}
+
+// fileExists reports whether path is an existing file
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// RPCPluginWrapper wraps a plugin running as a child process
+type RPCPluginWrapper struct {
+	client      *pluginrpc.Client
+	description *pluginrpc.Description
+	binDir      string // Built executable; empty for plugins with a command
+	manifest    *PluginManifest
+	spec        PluginSpec
+}
+
+func (w *RPCPluginWrapper) Name() string {
+	if w.spec.Alias != "" {
+		return w.spec.Alias
+	}
+	return w.manifest.Name
+}
+
+func (w *RPCPluginWrapper) Version() string     { return w.manifest.Version }
+func (w *RPCPluginWrapper) Description() string { return w.manifest.Description }
+func (w *RPCPluginWrapper) Dependencies() []string {
+	return w.manifest.Dependencies
+}
+
+func (w *RPCPluginWrapper) Permissions() []string { return w.manifest.Permissions }
+
+// Register makes the plugin's exported functions a Lua module. Arguments and
+// results are converted to and from JSON values, and errors the plugin
+// returns are raised as Lua errors. Plugins with an init handler get their
+// config first, and the process is shut down when the script finishes.
+func (w *RPCPluginWrapper) Register(L *lua.LState) error {
+	name := w.Name()
+	if w.description.Init {
+		if err := w.client.Init(w.spec.Config); err != nil {
+			return fmt.Errorf("plugin %s: init: %w", name, err)
+		}
+	}
+	hyperuntime.OnPluginShutdown(L, name, func(ctx context.Context) error {
+		return w.client.CloseContext(ctx)
+	})
+	L.PreloadModule(name, func(L *lua.LState) int {
+		module := L.NewTable()
+		for _, function := range w.description.Functions {
+			function := function
+			L.SetField(module, function, L.NewFunction(func(L *lua.LState) int {
+				args := make([]interface{}, L.GetTop())
+				for i := range args {
+					args[i] = hyperuntime.LuaToGo(L, L.Get(i+1))
+				}
+				results, err := w.client.Call(function, args)
+				if err != nil {
+					L.RaiseError("%s.%s: %v", name, function, err)
+				}
+				for _, result := range results {
+					L.Push(hyperuntime.GoToLua(L, result))
+				}
+				return len(results)
+			}))
+		}
+		L.Push(module)
+		return 1
+	})
+	return nil
+}
+
+// Close shuts the plugin process down and removes its built executable
+func (w *RPCPluginWrapper) Close() error {
+	var err error
+	if w.client != nil {
+		err = w.client.Close()
+	}
+	if w.binDir != "" {
+		os.RemoveAll(w.binDir)
+		w.binDir = ""
+	}
+	return err
+}
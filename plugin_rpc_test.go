@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"hype/hyperuntime"
+	"hype/pluginrpc"
+)
+
+// rpcPluginSource is an out-of-process plugin built against this checkout's
+// pluginrpc package
+const rpcPluginSource = `package main
+
+import (
+	"errors"
+	"os"
+
+	"hype/pluginrpc"
+)
+
+func main() {
+	var precision interface{}
+	pluginrpc.Serve(pluginrpc.Plugin{
+		Name:    "calc",
+		Version: "1.0.0",
+		Init: func(config map[string]interface{}) error {
+			precision = config["precision"]
+			return nil
+		},
+		Functions: map[string]pluginrpc.Func{
+			"precision": func(args []interface{}) ([]interface{}, error) {
+				return []interface{}{precision}, nil
+			},
+			"add": func(args []interface{}) ([]interface{}, error) {
+				sum := 0.0
+				for _, arg := range args {
+					n, ok := arg.(float64)
+					if !ok {
+						return nil, errors.New("add expects numbers")
+					}
+					sum += n
+				}
+				return []interface{}{sum}, nil
+			},
+			"split": func(args []interface{}) ([]interface{}, error) {
+				wd, _ := os.Getwd()
+				return []interface{}{args[0].(map[string]interface{})["name"], []interface{}{"a", "b"}, wd}, nil
+			},
+		},
+	})
+}
+`
+
+func TestRPCPlugin(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a plugin executable")
+	}
+	repo, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	goSum, err := os.ReadFile("go.sum")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "calc")
+	writeLuaFiles(t, dir, map[string]string{
+		"hype-plugin.yaml": "name: calc\nversion: 1.0.0\ntype: go\ntransport: rpc\n",
+		"main.go":          rpcPluginSource,
+		"go.mod":           "module calc\n\ngo 1.21\n\nrequire hype v0.0.0\n\nreplace hype => " + filepath.ToSlash(repo) + "\n",
+		"go.sum":           string(goSum),
+	})
+	// Out-of-process plugins do not need cgo
+	t.Setenv("CGO_ENABLED", "0")
+
+	registry := NewPluginRegistry()
+	if err := registry.LoadPlugins(context.Background(), []PluginSpec{{Name: "calc", Source: dir, Config: map[string]interface{}{"precision": 2.0}}}); err != nil {
+		t.Fatalf("LoadPlugins failed: %v", err)
+	}
+	defer registry.Close()
+
+	L := hyperuntime.NewState("test.lua", nil)
+	defer L.Close()
+	if err := registry.RegisterAll(L); err != nil {
+		t.Fatalf("RegisterAll failed: %v", err)
+	}
+
+	script := `
+local calc = require("calc")
+sum = calc.add(1, 2, 3.5)
+name, list, wd = calc.split({name = "hype"})
+second = list[2]
+local ok, err = pcall(calc.add, "x")
+failed = tostring(ok) .. " " .. err
+precision = calc.precision()
+`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %v", err)
+	}
+	checks := map[string]string{
+		"sum":       "6.5",
+		"name":      "hype",
+		"second":    "b",
+		"precision": "2",
+		"wd":        dir,
+		"failed":    "false <string>:6: calc.add: add expects numbers",
+	}
+	for name, want := range checks {
+		if got := L.GetGlobal(name).String(); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	if err := registry.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+}
+
+func TestRPCPluginStartTimeout(t *testing.T) {
+	// As the plugin process, never answer
+	if os.Getenv("HYPE_TEST_SILENT_PLUGIN") == "1" {
+		time.Sleep(time.Minute)
+		return
+	}
+
+	dir := filepath.Join(t.TempDir(), "silent")
+	writeLuaFiles(t, dir, map[string]string{
+		"hype-plugin.yaml": fmt.Sprintf("name: silent\nversion: 1.0.0\ntype: go\ntransport: rpc\ncommand: [%q, \"-test.run=^TestRPCPluginStartTimeout$\"]\n", os.Args[0]),
+	})
+	t.Setenv("HYPE_TEST_SILENT_PLUGIN", "1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	registry := NewPluginRegistry()
+	err := registry.LoadPlugins(ctx, []PluginSpec{{Name: "silent", Source: dir}})
+	if err == nil {
+		registry.Close()
+		t.Fatalf("Expected a plugin that never answers to fail to load")
+	}
+	if !strings.Contains(err.Error(), "did not answer") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Loading took %s; the plugin should have been killed", elapsed)
+	}
+}
+
+func TestRPCPluginShutdownTimeout(t *testing.T) {
+	// As the plugin process, describe itself but never finish shutting down
+	if os.Getenv("HYPE_TEST_STUCK_PLUGIN") == "1" {
+		pluginrpc.Serve(pluginrpc.Plugin{
+			Name:     "stuck",
+			Version:  "1.0.0",
+			Shutdown: func() error { time.Sleep(time.Minute); return nil },
+		})
+		return
+	}
+
+	dir := filepath.Join(t.TempDir(), "stuck")
+	writeLuaFiles(t, dir, map[string]string{
+		"hype-plugin.yaml": fmt.Sprintf("name: stuck\nversion: 1.0.0\ntype: go\ntransport: rpc\ncommand: [%q, \"-test.run=^TestRPCPluginShutdownTimeout$\"]\n", os.Args[0]),
+	})
+	t.Setenv("HYPE_TEST_STUCK_PLUGIN", "1")
+	load := func() *PluginRegistry {
+		t.Helper()
+		registry := NewPluginRegistry()
+		if err := registry.LoadPlugins(context.Background(), []PluginSpec{{Name: "stuck", Source: dir}}); err != nil {
+			t.Fatalf("LoadPlugins failed: %v", err)
+		}
+		return registry
+	}
+
+	registry := load()
+	start := time.Now()
+	err := registry.Close()
+	if err == nil || !strings.Contains(err.Error(), "killed") {
+		t.Errorf("Expected the plugin to be killed, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Second {
+		t.Errorf("Closing took %s; the plugin should have been killed", elapsed)
+	}
+
+	// The script's shutdown hook honors the deadline it is given
+	registry = load()
+	defer registry.Close()
+	L := hyperuntime.NewState("test.lua", nil)
+	defer L.Close()
+	if err := registry.RegisterAll(L); err != nil {
+		t.Fatalf("RegisterAll failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	err = hyperuntime.ShutdownPlugins(ctx, L)
+	if err == nil || !strings.Contains(err.Error(), "killed") {
+		t.Errorf("Expected the plugin to be killed, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Shutting down took %s; the hook should have honored its deadline", elapsed)
+	}
+}
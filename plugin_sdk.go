@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Go plugins import hype/pluginsdk. Built executables hold the SDK in their
+// build module (see writeRuntimeSources); plugins that hype run builds with
+// -buildmode=plugin get the SDK as a module of its own, written from the
+// sources hype embeds. The module is named hype, like this one, so plugin
+// authors point a replace directive at a hype checkout or at the module
+// `hype plugin sdk` writes.
+
+// buildCacheSDK holds the SDK modules under the build cache
+const buildCacheSDK = "sdk"
+
+// pluginSDKFiles returns the files of the SDK module by slash-separated path
+func pluginSDKFiles() (map[string][]byte, error) {
+	goMod, err := pluginSDKGoMod()
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{"go.mod": goMod}
+
+	entries, err := runtimeSources.ReadDir("pluginsdk")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded pluginsdk: %w", err)
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), "_test.go") {
+			continue
+		}
+		name := "pluginsdk/" + entry.Name()
+		if files[name], err = runtimeSources.ReadFile(name); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// writePluginSDK writes the SDK module into dir
+func writePluginSDK(dir string) error {
+	files, err := pluginSDKFiles()
+	if err != nil {
+		return err
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// pluginSDKDir returns the directory of the SDK module in the build cache,
+// writing it on first use. Every plugin a process opens must compile the
+// SDK from the same directory, or plugin.Open refuses all but the first as
+// built with a different version of hype/pluginsdk, so the directory is
+// named after the SDK's content and shared. Its content is checked before
+// it is reused, as whatever it holds is compiled into every plugin.
+func pluginSDKDir() (string, error) {
+	files, err := pluginSDKFiles()
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	hash := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(hash, "%s %d\n", name, len(files[name]))
+		hash.Write(files[name])
+	}
+
+	cacheDir, err := buildCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sdkDir := filepath.Join(cacheDir, buildCacheSDK)
+	dir := filepath.Join(sdkDir, hex.EncodeToString(hash.Sum(nil))[:16])
+	if pluginSDKMatches(dir, files) {
+		return dir, nil
+	}
+
+	// Written next to its final location and renamed, so concurrent runs
+	// never build against a half-written SDK
+	if err := os.MkdirAll(sdkDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create plugin SDK directory: %w", err)
+	}
+	tempDir, err := os.MkdirTemp(sdkDir, ".tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create plugin SDK directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+	if err := writePluginSDK(tempDir); err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(dir); err == nil && !pluginSDKMatches(dir, files) {
+		if err := os.RemoveAll(dir); err != nil {
+			return "", fmt.Errorf("failed to replace plugin SDK: %w", err)
+		}
+	}
+	if err := os.Rename(tempDir, dir); err != nil {
+		// Another hype process wrote it first
+		if !pluginSDKMatches(dir, files) {
+			return "", fmt.Errorf("failed to store plugin SDK: %w", err)
+		}
+	}
+	return dir, nil
+}
+
+// pluginSDKMatches reports whether dir holds exactly the SDK module's files
+func pluginSDKMatches(dir string, files map[string][]byte) bool {
+	found := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		want, ok := files[filepath.ToSlash(rel)]
+		if !ok {
+			return fmt.Errorf("unexpected file %s", rel)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(data, want) {
+			return fmt.Errorf("%s differs", rel)
+		}
+		found++
+		return nil
+	})
+	return err == nil && found == len(files)
+}
+
+// pluginSDKGoMod returns the go.mod of the SDK module. It only requires
+// gopher-lua, at the version hype is built with, so plugins with their own
+// go.mod need no checksums for the rest of hype's dependencies. Its go
+// version is hype's.
+func pluginSDKGoMod() ([]byte, error) {
+	hypeMod, err := runtimeSources.ReadFile("go.mod")
+	if err != nil {
+		return nil, err
+	}
+	luaVersion := goModRequirement(hypeMod, "github.com/yuin/gopher-lua")
+	if luaVersion == "" {
+		return nil, fmt.Errorf("hype's go.mod does not require gopher-lua")
+	}
+	goVersion := goModDirective(hypeMod, "go")
+	if goVersion == "" {
+		return nil, fmt.Errorf("hype's go.mod has no go directive")
+	}
+	return []byte(fmt.Sprintf("module hype\n\ngo %s\n\nrequire github.com/yuin/gopher-lua %s\n", goVersion, luaVersion)), nil
+}
+
+// goModRequirement returns the version of module path required in a go.mod
+// file, or "" when it is not required
+func goModRequirement(data []byte, path string) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(line), "require "))
+		if len(fields) >= 2 && fields[0] == path {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// goModDirective returns the argument of a single-line directive, such as
+// go or toolchain, in a go.mod file, or "" when there is none
+func goModDirective(data []byte, directive string) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == directive {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// goVersionLess reports whether Go version a, such as 1.21 or 1.23.4, is
+// older than b. A missing version is older than any other.
+func goVersionLess(a, b string) bool {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			return x < y
+		}
+	}
+	return false
+}
+
+// usePluginSDK makes the Go plugin copied to pluginDir require hype, for
+// hype/pluginsdk, replaced with the SDK module, and raises its go version to
+// the SDK's when it is lower. A replacement of hype in the plugin's own
+// go.mod, which lets it build on its own, is overridden.
+func usePluginSDK(ctx context.Context, pluginDir string) error {
+	sdkDir, err := pluginSDKDir()
+	if err != nil {
+		return err
+	}
+	args := []string{"mod", "edit", "-require=hype@v0.0.0", "-replace=hype=" + sdkDir}
+
+	// A module cannot require one that needs a newer Go than it declares
+	goMod, err := os.ReadFile(filepath.Join(pluginDir, "go.mod"))
+	if err != nil {
+		return err
+	}
+	sdkMod, err := pluginSDKGoMod()
+	if err != nil {
+		return err
+	}
+	if sdkGo := goModDirective(sdkMod, "go"); goVersionLess(goModDirective(goMod, "go"), sdkGo) {
+		args = append(args, "-go="+sdkGo)
+	}
+
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = pluginDir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to add the plugin SDK to go.mod: %w\nOutput: %s", err, output)
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"hype/hyperuntime"
+)
+
+// sdkPluginSource is a Go plugin written against hype/pluginsdk. Its
+// module returns points as userdata, converted from and to tables, and
+// reports the config it was initialized with.
+const sdkPluginSource = `package main
+
+import (
+	"fmt"
+
+	"hype/pluginsdk"
+
+	"github.com/yuin/gopher-lua"
+)
+
+type point struct {
+	X int ` + "`lua:\"x\"`" + `
+	Y int ` + "`lua:\"y\"`" + `
+}
+
+var pointType = &pluginsdk.Type[*point]{
+	Name: "geo.point",
+	Methods: map[string]pluginsdk.Method[*point]{
+		"table": func(L *lua.LState, p *point) int {
+			L.Push(pluginsdk.ToLua(L, p))
+			return 1
+		},
+	},
+	Metamethods: map[string]pluginsdk.Method[*point]{
+		"__tostring": func(L *lua.LState, p *point) int {
+			L.Push(lua.LString(fmt.Sprintf("(%d, %d)", p.X, p.Y)))
+			return 1
+		},
+	},
+}
+
+type geo struct {
+	config struct {
+		Unit string ` + "`lua:\"unit\"`" + `
+	}
+}
+
+func NewPlugin() pluginsdk.Plugin { return &geo{} }
+
+func (g *geo) APIVersion() int { return 1 }
+
+func (g *geo) Init(config map[string]interface{}) error {
+	g.config.Unit, _ = config["unit"].(string)
+	return nil
+}
+
+func (g *geo) Register(L *lua.LState) error {
+	pluginsdk.Module{
+		Functions: map[string]lua.LGFunction{
+			"point": func(L *lua.LState) int {
+				p := &point{}
+				if err := pluginsdk.FromLua(L.CheckTable(1), p); err != nil {
+					L.ArgError(1, err.Error())
+				}
+				L.Push(pointType.New(L, p))
+				return 1
+			},
+		},
+		Values: map[string]interface{}{"config": g.config},
+	}.Preload(L, "geo")
+	return nil
+}
+`
+
+// sdkPluginScript sets result to what the SDK plugin returns
+const sdkPluginScript = `local geo = require("geo")
+local p = geo.point({x = 1, y = 2})
+local ok, err = pcall(geo.point, {x = 1.5})
+result = table.concat({tostring(p), p:table().y, geo.config.unit, err}, "\t")`
+
+func TestGoPluginSDK(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds Go plugins")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("Go plugins are not supported on Windows")
+	}
+	if output, err := exec.Command("go", "env", "CGO_ENABLED").Output(); err != nil || strings.TrimSpace(string(output)) != "1" {
+		t.Skip("Go plugins need cgo")
+	}
+
+	dir := t.TempDir()
+	writeLuaFiles(t, filepath.Join(dir, "geo"), map[string]string{
+		"hype-plugin.yaml": "name: geo\nversion: 1.0.0\ntype: go\nmain: plugin.go\n",
+		"plugin.go":        sdkPluginSource,
+	})
+	specs := []PluginSpec{{Name: "geo", Source: filepath.Join(dir, "geo"), Config: map[string]interface{}{"unit": "m"}}}
+	check := func(got string) {
+		t.Helper()
+		if !strings.HasPrefix(got, "(1, 2)\t2\tm\t") || !strings.Contains(got, "x: 1.5 does not fit in int") {
+			t.Errorf("result = %q", got)
+		}
+	}
+
+	// hype run builds the plugin with -buildmode=plugin against the SDK
+	// hype embeds
+	registry := NewPluginRegistry()
+	if err := registry.LoadPlugins(context.Background(), specs); err != nil {
+		t.Fatalf("LoadPlugins failed: %v", err)
+	}
+	defer registry.Close()
+	L := hyperuntime.NewState("test.lua", nil)
+	defer L.Close()
+	if err := registry.RegisterAll(L); err != nil {
+		t.Fatalf("RegisterAll failed: %v", err)
+	}
+	if err := L.DoString(sdkPluginScript); err != nil {
+		t.Fatalf("Script failed: %v", err)
+	}
+	check(L.GetGlobal("result").String())
+
+	// Built executables compile it against the SDK in the build module.
+	// hype build loads the plugin too, and a process cannot open a plugin
+	// of the same module path twice, so the plugin gets a go.mod of its own.
+	goSum, err := os.ReadFile("go.sum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeLuaFiles(t, filepath.Join(dir, "geo"), map[string]string{
+		"go.mod": "module example.com/geo\n\ngo 1.21\n\nrequire (\n\tgithub.com/yuin/gopher-lua v1.1.1\n\thype v0.0.0\n)\n",
+		"go.sum": string(goSum),
+	})
+	scriptPath := filepath.Join(dir, "main.lua")
+	if err := os.WriteFile(scriptPath, []byte(sdkPluginScript+"\nprint(result)"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outputPath := filepath.Join(dir, "app")
+	if err := buildExecutableWithOptions(scriptPath, outputPath, "current", specs, BuildOptions{NoCache: true}); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	output, err := exec.Command(outputPath).CombinedOutput()
+	if err != nil {
+		t.Fatalf("Built executable failed: %v\n%s", err, output)
+	}
+	check(strings.TrimSpace(string(output)))
+}
+
+func TestPluginSDKDir(t *testing.T) {
+	cacheDir := t.TempDir()
+	t.Setenv(buildCacheEnv, cacheDir)
+
+	dir, err := pluginSDKDir()
+	if err != nil {
+		t.Fatalf("pluginSDKDir failed: %v", err)
+	}
+	if !strings.HasPrefix(dir, filepath.Join(cacheDir, buildCacheSDK)) {
+		t.Errorf("SDK written to %s, outside the build cache", dir)
+	}
+	goMod, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hypeMod, err := os.ReadFile("go.mod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := goModDirective(goMod, "go"), goModDirective(hypeMod, "go"); got != want {
+		t.Errorf("SDK go version = %q, want hype's %q", got, want)
+	}
+
+	// Whatever the directory holds is compiled into plugins, so anything
+	// else in it is replaced
+	evil := filepath.Join(dir, "pluginsdk", "evil.go")
+	if err := os.WriteFile(evil, []byte("package pluginsdk\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module hype\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	again, err := pluginSDKDir()
+	if err != nil {
+		t.Fatalf("pluginSDKDir failed: %v", err)
+	}
+	if again != dir {
+		t.Errorf("SDK moved from %s to %s", dir, again)
+	}
+	if _, err := os.Stat(evil); !os.IsNotExist(err) {
+		t.Errorf("Expected the unexpected file to be removed")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "go.mod")); string(data) != string(goMod) {
+		t.Errorf("Expected go.mod to be restored, got %q", data)
+	}
+}
+
+func TestGoVersionLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		less bool
+	}{
+		{"1.21", "1.23", true},
+		{"1.23", "1.23.0", false},
+		{"1.23.4", "1.23", false},
+		{"1.9", "1.10", true},
+		{"", "1.21", true},
+	}
+	for _, tt := range tests {
+		if got := goVersionLess(tt.a, tt.b); got != tt.less {
+			t.Errorf("goVersionLess(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.less)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"hype/hyperuntime"
+)
+
+// pluginSignatureFile is the detached signature hype plugin sign writes next
+// to the plugin manifest
+const pluginSignatureFile = "hype-plugin.sig"
+
+// Values of plugin_signatures in hype.yaml
+const (
+	signaturesWarn    = "warn"    // Warn about unsigned and untrusted plugins (default)
+	signaturesRequire = "require" // Refuse unsigned and untrusted plugins
+)
+
+// pluginSignature is the content of hype-plugin.sig: a signature over the
+// hash of the plugin directory, as computed by hashPluginDir
+type pluginSignature struct {
+	Hash      string `json:"hash"`
+	Alg       string `json:"alg"`
+	Kid       string `json:"kid"`       // kid of the signing key, or its JWK thumbprint
+	Signature string `json:"signature"` // base64url
+}
+
+// jwkSet is a JWKS file listing trusted public keys
+type jwkSet struct {
+	Keys []hyperuntime.JWK `json:"keys"`
+}
+
+// hashPluginDir hashes a plugin directory the way hashModuleDir hashes a
+// library, leaving out the signature file and version control directories,
+// so copying a plugin or checking it out again keeps its hash
+func hashPluginDir(dir string) (string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && (d.Name() == ".git" || d.Name() == ".hg") && path != dir {
+			return filepath.SkipDir
+		}
+		if d.Type().IsRegular() && path != filepath.Join(dir, pluginSignatureFile) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hashFiles(dir, files)
+}
+
+// loadJWK reads a single JWK from a JSON file
+func loadJWK(path string) (*hyperuntime.JWK, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	var jwk hyperuntime.JWK
+	if err := json.Unmarshal(data, &jwk); err != nil {
+		return nil, fmt.Errorf("failed to parse key %s: %w", path, err)
+	}
+	if jwk.Kty == "" {
+		return nil, fmt.Errorf("%s is not a JWK", path)
+	}
+	return &jwk, nil
+}
+
+// loadJWKSet reads the public keys of a JWKS file
+func loadJWKSet(path string) ([]hyperuntime.JWK, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trusted keys: %w", err)
+	}
+	var set jwkSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse trusted keys %s: %w", path, err)
+	}
+	if len(set.Keys) == 0 {
+		return nil, fmt.Errorf("%s has no keys", path)
+	}
+	return set.Keys, nil
+}
+
+// jwkID is the key ID signatures name a key by: its kid, or its thumbprint
+// when it has none
+func jwkID(jwk *hyperuntime.JWK) (string, error) {
+	if jwk.Kid != "" {
+		return jwk.Kid, nil
+	}
+	return hyperuntime.JWKThumbprint(jwk)
+}
+
+// signPlugin signs the plugin in dir with a private JWK and writes the
+// signature to hype-plugin.sig. The signature covers every file in the
+// directory, so the plugin is signed once it is ready to publish.
+func signPlugin(dir string, key *hyperuntime.JWK) (*pluginSignature, error) {
+	if _, err := findManifest(dir); err != nil {
+		return nil, err
+	}
+	kid, err := jwkID(key)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := hashPluginDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash plugin: %w", err)
+	}
+	signature, err := hyperuntime.SignWithJWK(key, []byte(hash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign plugin: %w", err)
+	}
+
+	sig := &pluginSignature{
+		Hash:      hash,
+		Alg:       key.Alg,
+		Kid:       kid,
+		Signature: base64.RawURLEncoding.EncodeToString(signature),
+	}
+	data, err := json.MarshalIndent(sig, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, pluginSignatureFile), append(data, '\n'), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write signature: %w", err)
+	}
+	return sig, nil
+}
+
+// UseTrustedKeys makes LoadPlugins verify plugin signatures against the
+// public keys in a JWKS file. A plugin whose signature does not match its
+// files is always refused; with require set, so are plugins that are not
+// signed or are signed by a key not in the file. Otherwise they load with a
+// warning.
+func (r *PluginRegistry) UseTrustedKeys(path string, require bool) error {
+	keys, err := loadJWKSet(path)
+	if err != nil {
+		return err
+	}
+	r.trustedKeys, r.requireSigned = keys, require
+	return nil
+}
+
+// verifyPluginSignature checks the signature of the plugin fetched into
+// pluginDir against the trusted keys
+func (r *PluginRegistry) verifyPluginSignature(spec PluginSpec, pluginDir string) error {
+	if r.trustedKeys == nil {
+		return nil
+	}
+	refuse := func(format string, args ...interface{}) error {
+		reason := fmt.Sprintf(format, args...)
+		if r.requireSigned {
+			return fmt.Errorf("plugin %s %s", spec.Name, reason)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: plugin %s %s\n", spec.Name, reason)
+		return nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(pluginDir, pluginSignatureFile))
+	if os.IsNotExist(err) {
+		return refuse("is not signed")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read signature of plugin %s: %w", spec.Name, err)
+	}
+	var sig pluginSignature
+	if err := json.Unmarshal(data, &sig); err != nil {
+		return fmt.Errorf("invalid signature of plugin %s: %w", spec.Name, err)
+	}
+
+	// Keys made by crypto.generate_jwk in the same second share a kid, so
+	// every trusted key with the signature's kid is tried
+	var keys []*hyperuntime.JWK
+	for i := range r.trustedKeys {
+		trusted := &r.trustedKeys[i]
+		thumbprint, _ := hyperuntime.JWKThumbprint(trusted)
+		if (trusted.Kid != "" && trusted.Kid == sig.Kid) || thumbprint == sig.Kid {
+			keys = append(keys, trusted)
+		}
+	}
+	if len(keys) == 0 {
+		return refuse("is signed by untrusted key %s", sig.Kid)
+	}
+
+	hash, err := hashPluginDir(pluginDir)
+	if err != nil {
+		return fmt.Errorf("failed to hash plugin: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(sig.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature of plugin %s: %w", spec.Name, err)
+	}
+	if sig.Hash != hash {
+		return fmt.Errorf("plugin %s was changed after it was signed", spec.Name)
+	}
+	// The algorithm comes from the trusted key, not the signature file
+	for _, key := range keys {
+		if valid, err := hyperuntime.VerifyWithJWK(key, []byte(hash), signature); err == nil && valid {
+			return nil
+		}
+	}
+	return fmt.Errorf("signature of plugin %s does not verify with trusted key %s", spec.Name, sig.Kid)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"hype/hyperuntime"
+)
+
+// testJWK generates a private JWK and returns it with a JWKS file holding
+// its public key
+func testJWK(t *testing.T, alg string) (*hyperuntime.JWK, string) {
+	t.Helper()
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	var jwk hyperuntime.JWK
+	switch alg {
+	case "EdDSA":
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jwk = hyperuntime.JWK{Kty: "OKP", Alg: alg, Crv: "Ed25519", X: b64(public), D: b64(private.Seed())}
+	case "ES256":
+		private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jwk = hyperuntime.JWK{Kty: "EC", Alg: alg, Crv: "P-256", X: b64(private.X.FillBytes(make([]byte, 32))), Y: b64(private.Y.FillBytes(make([]byte, 32))), D: b64(private.D.FillBytes(make([]byte, 32)))}
+	}
+
+	public := jwk
+	public.D = ""
+	data, err := json.Marshal(jwkSet{Keys: []hyperuntime.JWK{public}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "trusted.jwks")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return &jwk, path
+}
+
+func TestPluginSignatures(t *testing.T) {
+	for _, alg := range []string{"EdDSA", "ES256"} {
+		t.Run(alg, func(t *testing.T) {
+			key, trusted := testJWK(t, alg)
+			_, untrusted := testJWK(t, alg)
+
+			dir := t.TempDir()
+			writeLuaFiles(t, dir, map[string]string{
+				"hype-plugin.yaml": "name: signed\nversion: 1.0.0\ntype: lua\n",
+				"plugin.lua":       "return { ok = true }\n",
+				".git/HEAD":        "ref: refs/heads/main\n",
+			})
+			sig, err := signPlugin(dir, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if thumbprint, _ := hyperuntime.JWKThumbprint(key); sig.Kid != thumbprint {
+				t.Errorf("kid = %q, want the key's thumbprint %q", sig.Kid, thumbprint)
+			}
+
+			load := func(keys string, require bool) error {
+				t.Helper()
+				registry := NewPluginRegistry()
+				defer registry.Close()
+				if err := registry.UseTrustedKeys(keys, require); err != nil {
+					t.Fatal(err)
+				}
+				return registry.LoadPlugins(context.Background(), []PluginSpec{{Name: "signed", Source: dir}})
+			}
+
+			if err := load(trusted, true); err != nil {
+				t.Fatalf("Signed plugin refused: %v", err)
+			}
+			// Version control files are not part of the signature
+			writeLuaFiles(t, dir, map[string]string{".git/HEAD": "ref: refs/heads/other\n"})
+			if err := load(trusted, true); err != nil {
+				t.Fatalf("Signed plugin refused after a checkout: %v", err)
+			}
+
+			if err := load(untrusted, true); err == nil || !strings.Contains(err.Error(), "is signed by untrusted key") {
+				t.Errorf("Expected an untrusted key to be refused, got %v", err)
+			}
+			if err := load(untrusted, false); err != nil {
+				t.Errorf("Expected only a warning for an untrusted key, got %v", err)
+			}
+
+			writeLuaFiles(t, dir, map[string]string{"plugin.lua": "return { ok = false }\n"})
+			for _, require := range []bool{true, false} {
+				if err := load(trusted, require); err == nil || !strings.Contains(err.Error(), "was changed after it was signed") {
+					t.Errorf("Expected a changed plugin to be refused, got %v", err)
+				}
+			}
+
+			if err := os.Remove(filepath.Join(dir, pluginSignatureFile)); err != nil {
+				t.Fatal(err)
+			}
+			if err := load(trusted, true); err == nil || !strings.Contains(err.Error(), "plugin signed is not signed") {
+				t.Errorf("Expected an unsigned plugin to be refused, got %v", err)
+			}
+			if err := load(trusted, false); err != nil {
+				t.Errorf("Expected only a warning for an unsigned plugin, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPluginSignatureForged(t *testing.T) {
+	key, trusted := testJWK(t, "EdDSA")
+	dir := t.TempDir()
+	writeLuaFiles(t, dir, map[string]string{
+		"hype-plugin.yaml": "name: forged\nversion: 1.0.0\ntype: lua\n",
+		"plugin.lua":       "return {}\n",
+	})
+	if _, err := signPlugin(dir, key); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changing the plugin and the hash in the signature file does not help
+	writeLuaFiles(t, dir, map[string]string{"plugin.lua": "return { evil = true }\n"})
+	data, err := os.ReadFile(filepath.Join(dir, pluginSignatureFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sig pluginSignature
+	if err := json.Unmarshal(data, &sig); err != nil {
+		t.Fatal(err)
+	}
+	if sig.Hash, err = hashPluginDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = json.Marshal(sig)
+	if err := os.WriteFile(filepath.Join(dir, pluginSignatureFile), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := NewPluginRegistry()
+	defer registry.Close()
+	if err := registry.UseTrustedKeys(trusted, false); err != nil {
+		t.Fatal(err)
+	}
+	err = registry.LoadPlugins(context.Background(), []PluginSpec{{Name: "forged", Source: dir}})
+	if err == nil || !strings.Contains(err.Error(), "does not verify with trusted key") {
+		t.Errorf("Expected a forged signature to be refused, got %v", err)
+	}
+}
+
+func TestSignedPluginChangedAfterLoading(t *testing.T) {
+	key, trusted := testJWK(t, "EdDSA")
+	dir := t.TempDir()
+	writeLuaFiles(t, dir, map[string]string{
+		"hype-plugin.yaml": "name: signed\nversion: 1.0.0\ntype: lua\n",
+		"plugin.lua":       "return require('signed.value')\n",
+		"value.lua":        "return 'verified'\n",
+	})
+	if _, err := signPlugin(dir, key); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := NewPluginRegistry()
+	defer registry.Close()
+	if err := registry.UseTrustedKeys(trusted, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.LoadPlugins(context.Background(), []PluginSpec{{Name: "signed", Source: dir}}); err != nil {
+		t.Fatalf("Signed plugin refused: %v", err)
+	}
+
+	// What runs and what builds embed is what was verified, not the files
+	// on disk when they are required
+	writeLuaFiles(t, dir, map[string]string{
+		"plugin.lua": "return 'changed'\n",
+		"value.lua":  "return 'changed'\n",
+	})
+	L := hyperuntime.NewState("test.lua", nil)
+	defer L.Close()
+	if err := registry.RegisterAll(L); err != nil {
+		t.Fatalf("RegisterAll failed: %v", err)
+	}
+	if err := L.DoString(`value = require("signed")`); err != nil {
+		t.Fatalf("Script failed: %v", err)
+	}
+	if got := L.GetGlobal("value").String(); got != "verified" {
+		t.Errorf("require returned %q, want the verified plugin's value", got)
+	}
+	files, err := registry.plugins[0].(*LuaPluginWrapper).Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(files["value.lua"]); got != "return 'verified'\n" {
+		t.Errorf("Files returned %q for value.lua", got)
+	}
+}
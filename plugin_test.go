@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeVersionedPlugin writes a Lua plugin version under dir/<version>
+func writeVersionedPlugin(t *testing.T, dir, name, version string) {
+	t.Helper()
+	writeLuaFiles(t, filepath.Join(dir, version), map[string]string{
+		"hype-plugin.yaml": fmt.Sprintf("name: %s\nversion: %s\ntype: lua\nmain: plugin.lua\n", name, version),
+		"plugin.lua":       fmt.Sprintf("return {version = %q}", version),
+	})
+}
+
+func TestLoadPluginsPicksHighestMatch(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "greet")
+	for _, version := range []string{"1.0.0", "1.2.0", "1.3.0-beta.1", "2.0.0"} {
+		writeVersionedPlugin(t, source, "greet", version)
+	}
+	spec := PluginSpec{Name: "greet", Source: source, Version: "^1.0.0"}
+
+	load := func(frozen bool) (*PluginRegistry, error) {
+		registry := NewPluginRegistry()
+		if err := registry.UseLockFile(dir, frozen); err != nil {
+			t.Fatal(err)
+		}
+		return registry, registry.LoadPlugins(context.Background(), []PluginSpec{spec})
+	}
+
+	registry, err := load(false)
+	if err != nil {
+		t.Fatalf("LoadPlugins failed: %v", err)
+	}
+	if got := registry.plugins[0].Version(); got != "1.2.0" {
+		t.Errorf("Loaded greet %s, want 1.2.0", got)
+	}
+	if got := registry.specs[0].Source; got != filepath.Join(source, "1.2.0") {
+		t.Errorf("Resolved source = %s", got)
+	}
+	lock, err := loadLockFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lock.Plugins) != 1 || lock.Plugins[0].Version != "1.2.0" || lock.Plugins[0].Constraint != "^1.0.0" {
+		t.Fatalf("Unexpected lock %+v", lock.Plugins)
+	}
+
+	// A newer match does not replace the locked version
+	writeVersionedPlugin(t, source, "greet", "1.4.0")
+	if registry, err = load(true); err != nil {
+		t.Fatalf("LoadPlugins with the lock failed: %v", err)
+	}
+	if got := registry.plugins[0].Version(); got != "1.2.0" {
+		t.Errorf("Loaded greet %s, want the locked 1.2.0", got)
+	}
+
+	// Once the locked version is gone, --locked fails and a normal load
+	// moves to the highest match
+	os.RemoveAll(filepath.Join(source, "1.2.0"))
+	if _, err := load(true); err == nil || !strings.Contains(err.Error(), "--locked") {
+		t.Errorf("Expected a frozen lock error, got %v", err)
+	}
+	if registry, err = load(false); err != nil {
+		t.Fatalf("LoadPlugins failed: %v", err)
+	}
+	if got := registry.plugins[0].Version(); got != "1.4.0" {
+		t.Errorf("Loaded greet %s, want 1.4.0", got)
+	}
+
+	spec.Version = "^3.0.0"
+	if _, err := load(false); err == nil || !strings.Contains(err.Error(), "no version matches") {
+		t.Errorf("Expected no match for ^3.0.0, got %v", err)
+	}
+}
+
+func TestValidatePluginVersion(t *testing.T) {
+	registry := NewPluginRegistry()
+	manifest := &PluginManifest{Version: "1.4.2"}
+	for _, version := range []string{"", "latest", "1.4.2", "^1.0.0", "~1.4.0", ">=1.0.0 <2.0.0"} {
+		if err := registry.validatePluginVersion(PluginSpec{Version: version}, manifest); err != nil {
+			t.Errorf("Expected %q to accept 1.4.2: %v", version, err)
+		}
+	}
+	for _, version := range []string{"1.4.3", "^2.0.0", "~1.3.0"} {
+		if err := registry.validatePluginVersion(PluginSpec{Version: version}, manifest); err == nil {
+			t.Errorf("Expected %q to reject 1.4.2", version)
+		}
+	}
+}
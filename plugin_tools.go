@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"hype/hyperuntime"
+
+	"gopkg.in/yaml.v2"
+)
+
+// pluginListing is a plugin as shown by hype plugin list and info
+type pluginListing struct {
+	Spec     PluginSpec // As requested
+	Resolved PluginSpec // With the version picked and the directory holding it
+	Manifest *PluginManifest
+	Err      error
+}
+
+// Name is the module name the plugin is registered under
+func (l pluginListing) Name() string {
+	if l.Spec.Alias == "" && l.Manifest != nil && l.Manifest.Name != "" {
+		return l.Manifest.Name
+	}
+	return l.Spec.Name
+}
+
+// listPlugins resolves the version of each plugin and reads its manifest,
+// fetching git and Go module plugins that are not cached yet. Plugins are
+// not built or loaded, and the lock file is left as it is.
+func (r *PluginRegistry) listPlugins(ctx context.Context, specs []PluginSpec) []pluginListing {
+	listings := make([]pluginListing, 0, len(specs))
+	for _, spec := range specs {
+		listing := pluginListing{Spec: spec}
+		listing.Resolved, listing.Err = r.resolvePluginVersion(ctx, spec)
+		if listing.Err == nil {
+			listing.Manifest, listing.Err = r.loadManifest(listing.Resolved.Source)
+		}
+		listings = append(listings, listing)
+	}
+	return listings
+}
+
+// discoverPlugins returns specs for the plugins in the conventional local
+// plugin directories under baseDir and in $HYPE_PLUGIN_PATH: each
+// subdirectory with a plugin manifest
+func discoverPlugins(baseDir string) []PluginSpec {
+	dirs := []string{localPluginPath(baseDir, "plugins"), localPluginPath(baseDir, "examples/plugins")}
+	for _, dir := range filepath.SplitList(os.Getenv(pluginPathEnv)) {
+		if dir == "" {
+			continue
+		}
+		if !filepath.IsAbs(dir) {
+			dir = localPluginPath(".", dir)
+		}
+		dirs = append(dirs, dir)
+	}
+
+	var sources []string
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			source := localPluginPath(dir, entry.Name())
+			if !entry.IsDir() || seen[source] {
+				continue
+			}
+			if _, err := findManifest(source); err != nil {
+				continue
+			}
+			seen[source] = true
+			sources = append(sources, source)
+		}
+	}
+
+	specs, _ := ParsePluginSpecs(sources)
+	return specs
+}
+
+// printPluginList writes a table of plugins with their versions,
+// permissions and sources, followed by the errors of plugins that could not be resolved
+func printPluginList(w io.Writer, listings []pluginListing) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tVERSION\tTYPE\tPERMISSIONS\tSOURCE")
+	for _, listing := range listings {
+		version, kind, permissions := "-", "-", "-"
+		if listing.Manifest != nil {
+			version, kind = listing.Manifest.Version, listing.Manifest.Type
+			if listing.Manifest.Transport == transportRPC {
+				kind += " (rpc)"
+			}
+			if len(listing.Manifest.Permissions) > 0 {
+				permissions = strings.Join(listing.Manifest.Permissions, ",")
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", listing.Name(), version, kind, permissions, listing.Spec.Source)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, listing := range listings {
+		if listing.Err != nil {
+			fmt.Fprintf(w, "\n%s: %v\n", listing.Name(), listing.Err)
+		}
+	}
+	return nil
+}
+
+// printPluginManifest writes a plugin's manifest fields, leaving out the
+// ones that are not set, and where the plugin was found
+func printPluginManifest(w io.Writer, listing pluginListing) error {
+	manifest := listing.Manifest
+	fields := [][2]string{
+		{"Name", manifest.Name},
+		{"Version", manifest.Version},
+		{"Type", manifest.Type},
+		{"Transport", manifest.Transport},
+		{"Command", strings.Join(manifest.Command, " ")},
+		{"Main", manifest.Main},
+		{"Module", manifest.Module},
+		{"Description", manifest.Description},
+		{"Author", manifest.Author},
+		{"License", manifest.License},
+		{"Dependencies", strings.Join(manifest.Dependencies, ", ")},
+		{"Requires", formatRequires(manifest)},
+		{"Permissions", strings.Join(manifest.Permissions, ", ")},
+		{"Source", listing.Spec.Source},
+	}
+	if listing.Resolved.Source != listing.Spec.Source {
+		fields = append(fields, [2]string{"Path", listing.Resolved.Source})
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	for _, field := range fields {
+		if field[1] != "" {
+			fmt.Fprintf(tw, "%s:\t%s\n", field[0], field[1])
+		}
+	}
+	return tw.Flush()
+}
+
+// formatRequires lists the plugins a manifest requires with their version
+// ranges, e.g. "bubbletea ^1.0.0, json *"
+func formatRequires(manifest *PluginManifest) string {
+	var requires []string
+	for _, name := range sortedRequires(manifest) {
+		requires = append(requires, name+" "+displayConstraint(manifest.Requires[name]))
+	}
+	return strings.Join(requires, ", ")
+}
+
+// validatePlugin checks that dir holds a plugin with a complete manifest,
+// that the plugin loads and that its module can be required. It returns the
+// problems found; the plugin is only loaded once the manifest is valid.
+func validatePlugin(ctx context.Context, dir string) []string {
+	manifestPath, err := findManifest(dir)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return []string{fmt.Sprintf("failed to read manifest: %v", err)}
+	}
+	var manifest PluginManifest
+	if err := yaml.UnmarshalStrict(data, &manifest); err != nil {
+		return []string{fmt.Sprintf("invalid manifest: %v", err)}
+	}
+
+	var problems []string
+	switch {
+	case manifest.Name == "":
+		problems = append(problems, "name is missing")
+	case !projectNamePattern.MatchString(manifest.Name):
+		problems = append(problems, fmt.Sprintf("name %q is invalid: use letters, digits, '-' and '_', starting with a letter", manifest.Name))
+	}
+	if manifest.Version == "" {
+		problems = append(problems, "version is missing")
+	} else if _, err := parseSemVersion(manifest.Version); err != nil {
+		problems = append(problems, fmt.Sprintf("version is not a semantic version: %v", err))
+	}
+	switch manifest.Transport {
+	case "", transportPlugin, transportRPC:
+	default:
+		problems = append(problems, fmt.Sprintf("transport %q is invalid: use %s or %s", manifest.Transport, transportPlugin, transportRPC))
+	}
+	if err := hyperuntime.ValidatePermissions(manifest.Permissions); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if len(manifest.Command) > 0 && manifest.Transport != transportRPC {
+		problems = append(problems, "command is only used with transport: rpc")
+	}
+	for _, name := range sortedRequires(&manifest) {
+		if !projectNamePattern.MatchString(name) {
+			problems = append(problems, fmt.Sprintf("required plugin name %q is invalid", name))
+		} else if _, err := parseVersionConstraint(manifest.Requires[name]); err != nil {
+			problems = append(problems, fmt.Sprintf("requires %s: %v", name, err))
+		}
+	}
+
+	switch manifest.Type {
+	case "lua":
+		main := manifest.Main
+		if main == "" {
+			main = "plugin.lua"
+		}
+		if !fileExists(filepath.Join(dir, filepath.FromSlash(main))) {
+			problems = append(problems, fmt.Sprintf("main file %s not found", main))
+		}
+		if manifest.Transport == transportRPC && len(manifest.Command) == 0 {
+			problems = append(problems, "rpc plugins of type lua need a command")
+		}
+	case "go":
+		if manifest.Main != "" && !fileExists(filepath.Join(dir, filepath.FromSlash(manifest.Main))) {
+			problems = append(problems, fmt.Sprintf("main file %s not found", manifest.Main))
+		}
+		if sources, _ := filepath.Glob(filepath.Join(dir, "*.go")); len(sources) == 0 {
+			problems = append(problems, "no Go source files")
+		}
+	case "":
+		problems = append(problems, "type is missing")
+	default:
+		problems = append(problems, fmt.Sprintf("type %q is invalid: use go or lua", manifest.Type))
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+
+	source, err := filepath.Abs(dir)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	registry := NewPluginRegistry()
+	defer registry.Close()
+	spec := PluginSpec{Name: manifest.Name, Source: source, Version: "latest"}
+	if err := registry.LoadPlugins(ctx, []PluginSpec{spec}); err != nil {
+		return []string{err.Error()}
+	}
+
+	L := hyperuntime.NewState(filepath.Join(source, "validate.lua"), nil)
+	defer L.Close()
+	if err := registry.RegisterAll(L); err != nil {
+		return []string{fmt.Sprintf("failed to register plugin: %v", err)}
+	}
+	if err := L.DoString(fmt.Sprintf("require(%q)", manifest.Name)); err != nil {
+		return []string{fmt.Sprintf("require(%q) failed: %v", manifest.Name, err)}
+	}
+	return nil
+}
+
+// pluginTestFiles returns the Lua tests bundled with the plugin in dir: the
+// *_test.lua files in the plugin directory and in its test and tests
+// directories, as slash paths relative to dir
+func pluginTestFiles(dir string) ([]string, error) {
+	var files []string
+	for _, pattern := range []string{"*_test.lua", "test/*_test.lua", "tests/*_test.lua"} {
+		matches, err := filepath.Glob(filepath.Join(dir, filepath.FromSlash(pattern)))
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			rel, err := filepath.Rel(dir, match)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// runPluginTests runs each Lua test bundled with the plugin in dir as a
+// script of its own with the hype executable, the plugin loaded from dir.
+// Tests run in the plugin directory, and fail by raising an error or
+// exiting with a non-zero status. Their output goes to w, followed by a
+// line per test; the tests that failed are returned.
+func runPluginTests(hype, dir string, w io.Writer) ([]string, error) {
+	source, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := NewPluginRegistry().loadManifest(source)
+	if err != nil {
+		return nil, err
+	}
+	tests, err := pluginTestFiles(source)
+	if err != nil {
+		return nil, err
+	}
+	if len(tests) == 0 {
+		return nil, fmt.Errorf("no tests found in %s (looked for *_test.lua, test/*_test.lua and tests/*_test.lua)", dir)
+	}
+
+	var failed []string
+	for _, test := range tests {
+		fmt.Fprintf(w, "=== %s\n", test)
+		cmd := exec.Command(hype, "run", test, "--plugins", manifest.Name+"="+source)
+		cmd.Dir = source
+		cmd.Stdout = w
+		cmd.Stderr = w
+		if err := cmd.Run(); err != nil {
+			if _, ok := err.(*exec.ExitError); !ok {
+				return failed, fmt.Errorf("failed to run %s: %w", test, err)
+			}
+			fmt.Fprintf(w, "--- FAIL %s\n", test)
+			failed = append(failed, test)
+			continue
+		}
+		fmt.Fprintf(w, "--- ok   %s\n", test)
+	}
+	return failed, nil
+}
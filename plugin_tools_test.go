@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestValidatePlugin(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "greeter")
+	if err := initProject(dir, "lua-plugin"); err != nil {
+		t.Fatal(err)
+	}
+	if problems := validatePlugin(context.Background(), dir); len(problems) > 0 {
+		t.Fatalf("Scaffolded plugin is invalid: %v", problems)
+	}
+
+	tests := []struct {
+		name     string
+		manifest string
+		main     string
+		want     []string
+	}{
+		{"unknown field", "name: greeter\nversion: 1.0.0\ntype: lua\nmian: plugin.lua\n", "", []string{"field mian not found"}},
+		{"bad fields", "name: my plugin\nversion: \"1.0\"\ntype: rust\ntransport: grpc\n", "", []string{"name \"my plugin\" is invalid", "not a semantic version", "transport \"grpc\" is invalid", "type \"rust\" is invalid"}},
+		{"missing fields", "description: nothing\n", "", []string{"name is missing", "version is missing", "type is missing"}},
+		{"missing main", "name: greeter\nversion: 1.0.0\ntype: lua\nmain: lib/main.lua\n", "", []string{"main file lib/main.lua not found"}},
+		{"unknown permission", "name: greeter\nversion: 1.0.0\ntype: lua\npermissions: [fs:read, fs:delete]\n", "", []string{"unknown permission \"fs:delete\""}},
+		{"bad requires", "name: greeter\nversion: 1.0.0\ntype: lua\nrequires:\n  my tea: ^1.0.0\n  json: ^one\n", "", []string{"required plugin name \"my tea\" is invalid", "requires json: invalid version constraint"}},
+		{"rpc without command", "name: greeter\nversion: 1.0.0\ntype: lua\ntransport: rpc\n", "", []string{"need a command"}},
+		{"require fails", "name: greeter\nversion: 1.0.0\ntype: lua\n", "error('broken plugin')\n", []string{"require(\"greeter\") failed", "broken plugin"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "hype-plugin.yaml"), []byte(tt.manifest), 0644); err != nil {
+				t.Fatal(err)
+			}
+			main := tt.main
+			if main == "" {
+				main = "return {}\n"
+			}
+			if err := os.WriteFile(filepath.Join(dir, "plugin.lua"), []byte(main), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			problems := strings.Join(validatePlugin(context.Background(), dir), "\n")
+			for _, want := range tt.want {
+				if !strings.Contains(problems, want) {
+					t.Errorf("Problems do not mention %q:\n%s", want, problems)
+				}
+			}
+		})
+	}
+
+	if problems := validatePlugin(context.Background(), t.TempDir()); len(problems) != 1 || !strings.Contains(problems[0], "manifest not found") {
+		t.Errorf("Expected a missing manifest, got %v", problems)
+	}
+}
+
+func TestDiscoverPlugins(t *testing.T) {
+	dir := t.TempDir()
+	extra := t.TempDir()
+	for _, plugin := range []string{"plugins/json", "plugins/not-a-plugin", "examples/plugins/fs-plugin"} {
+		pluginDir := filepath.Join(dir, filepath.FromSlash(plugin))
+		if err := os.MkdirAll(pluginDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(plugin, "not-a-plugin") {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(pluginDir, "hype-plugin.yaml"), []byte("name: x\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(extra, "kv"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(extra, "kv", "hype-plugin.yml"), []byte("name: kv\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(pluginPathEnv, extra)
+
+	var sources []string
+	for _, spec := range discoverPlugins(dir) {
+		sources = append(sources, spec.Source)
+	}
+	want := []string{
+		filepath.ToSlash(filepath.Join(dir, "plugins", "json")),
+		filepath.ToSlash(filepath.Join(dir, "examples", "plugins", "fs-plugin")),
+		filepath.ToSlash(filepath.Join(extra, "kv")),
+	}
+	if !reflect.DeepEqual(sources, want) {
+		t.Errorf("discoverPlugins() = %v, want %v", sources, want)
+	}
+}
+
+func TestPrintPluginList(t *testing.T) {
+	specs, err := ParsePluginSpecs([]string{"./plugins/bubbletea-plugin", "tea=./plugins/bubbletea-plugin", "./plugins/missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listings := NewPluginRegistry().listPlugins(context.Background(), specs)
+	if listings[0].Err != nil || listings[1].Err != nil {
+		t.Fatalf("Failed to list bubbletea: %v, %v", listings[0].Err, listings[1].Err)
+	}
+	if listings[2].Err == nil {
+		t.Errorf("Expected an error for a missing plugin")
+	}
+
+	var out bytes.Buffer
+	if err := printPluginList(&out, listings); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	if fields := strings.Fields(lines[1]); !reflect.DeepEqual(fields, []string{"bubbletea", "1.0.0", "lua", "-", "./plugins/bubbletea-plugin"}) {
+		t.Errorf("Unexpected row %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "tea ") {
+		t.Errorf("Aliased plugin not listed under its alias: %q", lines[2])
+	}
+	if !strings.Contains(out.String(), "missing: plugin manifest not found") {
+		t.Errorf("Error not reported:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := printPluginManifest(&out, listings[0]); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Name:        bubbletea\n", "Main:        plugin.lua\n", "Source:      ./plugins/bubbletea-plugin\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Manifest output lacks %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRunPluginTests(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the hype binary")
+	}
+
+	hype := filepath.Join(t.TempDir(), "hype")
+	if runtime.GOOS == "windows" {
+		hype += ".exe"
+	}
+	if output, err := exec.Command("go", "build", "-o", hype, ".").CombinedOutput(); err != nil {
+		t.Fatalf("Failed to build hype: %v\n%s", err, output)
+	}
+
+	dir := filepath.Join(t.TempDir(), "greeter")
+	if err := initProject(dir, "lua-plugin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "extra_test.lua"), []byte("assert(require('greeter').hello)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	failed, err := runPluginTests(hype, dir, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) > 0 {
+		t.Fatalf("Scaffolded tests failed: %v\n%s", failed, out.String())
+	}
+	if !strings.Contains(out.String(), "--- ok   extra_test.lua") || !strings.Contains(out.String(), "--- ok   test/plugin_test.lua") {
+		t.Errorf("Not every test ran:\n%s", out.String())
+	}
+
+	// A failing assertion makes the test script exit with status 1
+	main := filepath.Join(dir, "plugin.lua")
+	source, err := os.ReadFile(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(main, bytes.ReplaceAll(source, []byte("Hello from"), []byte("Hi from")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	failed, err = runPluginTests(hype, dir, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(failed, []string{"test/plugin_test.lua"}) {
+		t.Errorf("failed = %v, want [test/plugin_test.lua]\n%s", failed, out.String())
+	}
+
+	if _, err := runPluginTests(hype, t.TempDir(), &out); err == nil {
+		t.Errorf("Expected an error for a directory without a plugin")
+	}
+}
@@ -0,0 +1,200 @@
+package pluginrpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// maxMessageSize bounds a single request or response line
+const maxMessageSize = 64 * 1024 * 1024
+
+// shutdownTimeout is how long Close waits for a plugin to exit before
+// killing it
+const shutdownTimeout = 5 * time.Second
+
+// Client is hype's side of the connection to a plugin process. Calls are
+// serialized; the protocol has one request in flight at a time.
+type Client struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	scanner *bufio.Scanner
+
+	mu     sync.Mutex
+	nextID uint64
+	closed bool
+}
+
+// Start runs cmd as a plugin process and connects to it. The plugin's log
+// output goes wherever cmd.Stderr points.
+func Start(cmd *exec.Cmd) (*Client, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start plugin: %w", err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	return &Client{cmd: cmd, stdin: stdin, scanner: scanner}, nil
+}
+
+// Describe asks the plugin for its name, version and functions, and checks
+// that it speaks this protocol version. A plugin that does not answer before
+// ctx is done is killed.
+func (c *Client) Describe(ctx context.Context) (*Description, error) {
+	var description Description
+	if err := c.requestContext(ctx, MethodDescribe, nil, &description); err != nil {
+		return nil, err
+	}
+	if description.Protocol != ProtocolVersion {
+		return nil, fmt.Errorf("plugin speaks protocol version %d, hype speaks %d", description.Protocol, ProtocolVersion)
+	}
+	return &description, nil
+}
+
+// Init passes the plugin its config. Only plugins whose description has
+// Init set expect it.
+func (c *Client) Init(config map[string]interface{}) error {
+	if config == nil {
+		config = map[string]interface{}{}
+	}
+	return c.request(MethodInit, InitParams{Config: config}, nil)
+}
+
+// Call calls an exported function of the plugin
+func (c *Client) Call(function string, args []interface{}) ([]interface{}, error) {
+	if args == nil {
+		args = []interface{}{}
+	}
+	var results []interface{}
+	if err := c.request(MethodCall, CallParams{Function: function, Args: args}, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Close is CloseContext with a deadline of shutdownTimeout
+func (c *Client) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return c.CloseContext(ctx)
+}
+
+// CloseContext asks the plugin to shut down and waits for it to exit,
+// killing it if it has not answered and exited when ctx is done. Closing a
+// closed client does nothing.
+func (c *Client) CloseContext(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.mu.Unlock()
+
+	// A plugin that already exited fails the request; waiting still reaps
+	// it. An error the plugin's own shutdown returned is reported.
+	var failed *Error
+	if err := c.requestContext(ctx, MethodShutdown, nil, nil); !errors.As(err, &failed) {
+		failed = nil
+	}
+
+	c.mu.Lock()
+	c.closed = true
+	c.stdin.Close()
+	c.mu.Unlock()
+
+	done := make(chan error, 1)
+	go func() { done <- c.cmd.Wait() }()
+	select {
+	case err := <-done:
+		if ctx.Err() != nil {
+			return errors.New("plugin did not shut down in time and was killed")
+		}
+		if failed != nil {
+			return failed
+		}
+		return err
+	case <-ctx.Done():
+		c.cmd.Process.Kill()
+		<-done
+		return errors.New("plugin did not exit in time and was killed")
+	}
+}
+
+// requestContext sends a request like request does, killing the plugin if
+// it has not answered when ctx is done, which ends the pending read
+func (c *Client) requestContext(ctx context.Context, method string, params interface{}, result interface{}) error {
+	done := make(chan error, 1)
+	go func() { done <- c.request(method, params, result) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		c.cmd.Process.Kill()
+		<-done
+		return fmt.Errorf("plugin did not answer %s: %w", method, ctx.Err())
+	}
+}
+
+// request sends one request and decodes the result into result
+func (c *Client) request(method string, params interface{}, result interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errors.New("plugin is closed")
+	}
+
+	c.nextID++
+	req := Request{ID: c.nextID, Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("failed to encode arguments: %w", err)
+		}
+		req.Params = data
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	if _, err := c.stdin.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to send request to plugin: %w", err)
+	}
+
+	if !c.scanner.Scan() {
+		if err := c.scanner.Err(); err != nil {
+			return fmt.Errorf("failed to read plugin response: %w", err)
+		}
+		return errors.New("plugin exited")
+	}
+	var resp Response
+	if err := json.Unmarshal(c.scanner.Bytes(), &resp); err != nil {
+		return fmt.Errorf("invalid plugin response: %w", err)
+	}
+	if resp.ID != req.ID {
+		return fmt.Errorf("plugin answered request %d, expected %d", resp.ID, req.ID)
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("invalid plugin result: %w", err)
+	}
+	return nil
+}
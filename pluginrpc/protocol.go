@@ -0,0 +1,69 @@
+// Package pluginrpc implements the protocol hype speaks with out-of-process
+// plugins. The plugin is a child process; hype writes requests to its stdin
+// and reads responses from its stdout, one JSON object per line. The plugin's
+// stderr is passed through to hype's. See docs/PLUGIN_RPC.md.
+//
+// The package only uses the standard library, so plugins can import it
+// without pulling in hype's dependencies.
+package pluginrpc
+
+import "encoding/json"
+
+// ProtocolVersion is the protocol version this package speaks. Plugins
+// report theirs in the describe result and hype refuses other versions.
+const ProtocolVersion = 1
+
+// Methods hype calls on a plugin
+const (
+	MethodDescribe = "describe" // Returns Description
+	MethodInit     = "init"     // Passes InitParams, if the plugin's Description has Init set
+	MethodCall     = "call"     // Calls an exported function with CallParams
+	MethodShutdown = "shutdown" // Asks the plugin to exit after responding
+)
+
+// Request is a message from hype to a plugin
+type Request struct {
+	ID     uint64          `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// Response answers the request with the same ID. Exactly one of Result and
+// Error is set.
+type Response struct {
+	ID     uint64          `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *Error          `json:"error,omitempty"`
+}
+
+// Error is a failed request. For calls it is raised as a Lua error.
+type Error struct {
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Description is the result of describe
+type Description struct {
+	Protocol  int      `json:"protocol"`
+	Name      string   `json:"name"`
+	Version   string   `json:"version"`
+	Functions []string `json:"functions"`      // Exported as Lua functions of the module
+	Init      bool     `json:"init,omitempty"` // Wants an init request before the first call
+}
+
+// InitParams are the parameters of init: the config block of the plugin's
+// entry in hype.yaml, as JSON values
+type InitParams struct {
+	Config map[string]interface{} `json:"config"`
+}
+
+// CallParams are the parameters of call. Arguments and results are JSON
+// values: nil, bool, float64, string, []interface{} and
+// map[string]interface{}.
+type CallParams struct {
+	Function string        `json:"function"`
+	Args     []interface{} `json:"args"`
+}
@@ -0,0 +1,108 @@
+package pluginrpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// Func is an exported plugin function. It receives the Lua arguments and
+// returns the Lua results, converted to JSON values.
+type Func func(args []interface{}) ([]interface{}, error)
+
+// Plugin describes a plugin served by Serve
+type Plugin struct {
+	Name      string
+	Version   string
+	Functions map[string]Func
+
+	// Init, if set, receives the plugin's config before the first call
+	Init func(config map[string]interface{}) error
+	// Shutdown, if set, runs when hype asks the plugin to shut down
+	Shutdown func() error
+}
+
+// Serve answers hype's requests on stdin and stdout until hype asks the
+// plugin to shut down or closes stdin. Plugins call it from main and must
+// not write anything else to stdout.
+func Serve(plugin Plugin) error {
+	return ServeConn(plugin, os.Stdin, os.Stdout)
+}
+
+// ServeConn is Serve over any reader and writer
+func ServeConn(plugin Plugin, r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	encoder := json.NewEncoder(w)
+
+	for scanner.Scan() {
+		var req Request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			return fmt.Errorf("invalid request: %w", err)
+		}
+
+		result, err := plugin.handle(req)
+		resp := Response{ID: req.ID}
+		if err != nil {
+			resp.Error = &Error{Message: err.Error()}
+		} else if resp.Result, err = json.Marshal(result); err != nil {
+			resp.Result = nil
+			resp.Error = &Error{Message: fmt.Sprintf("failed to encode result: %v", err)}
+		}
+		if err := encoder.Encode(resp); err != nil {
+			return err
+		}
+
+		if req.Method == MethodShutdown {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+func (p Plugin) handle(req Request) (interface{}, error) {
+	switch req.Method {
+	case MethodDescribe:
+		description := Description{Protocol: ProtocolVersion, Name: p.Name, Version: p.Version, Init: p.Init != nil}
+		for name := range p.Functions {
+			description.Functions = append(description.Functions, name)
+		}
+		sort.Strings(description.Functions)
+		return description, nil
+	case MethodInit:
+		var params InitParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, fmt.Errorf("invalid init parameters: %w", err)
+		}
+		if p.Init == nil {
+			return nil, nil
+		}
+		if params.Config == nil {
+			params.Config = map[string]interface{}{}
+		}
+		return nil, p.Init(params.Config)
+	case MethodCall:
+		var params CallParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, fmt.Errorf("invalid call parameters: %w", err)
+		}
+		fn, ok := p.Functions[params.Function]
+		if !ok {
+			return nil, fmt.Errorf("unknown function %s", params.Function)
+		}
+		results, err := fn(params.Args)
+		if results == nil {
+			results = []interface{}{}
+		}
+		return results, err
+	case MethodShutdown:
+		if p.Shutdown != nil {
+			return nil, p.Shutdown()
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown method %s", req.Method)
+}
@@ -0,0 +1,104 @@
+package pluginrpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestServeConn(t *testing.T) {
+	plugin := Plugin{
+		Name:    "calc",
+		Version: "1.0.0",
+		Functions: map[string]Func{
+			"add": func(args []interface{}) ([]interface{}, error) {
+				return []interface{}{args[0].(float64) + args[1].(float64)}, nil
+			},
+			"fail": func(args []interface{}) ([]interface{}, error) {
+				return nil, errors.New("failed on purpose")
+			},
+		},
+	}
+	requests := strings.Join([]string{
+		`{"id":1,"method":"describe"}`,
+		`{"id":2,"method":"call","params":{"function":"add","args":[1,2]}}`,
+		`{"id":3,"method":"call","params":{"function":"fail","args":[]}}`,
+		`{"id":4,"method":"call","params":{"function":"missing","args":[]}}`,
+		`{"id":5,"method":"shutdown"}`,
+		`{"id":6,"method":"describe"}`,
+	}, "\n")
+
+	var out strings.Builder
+	if err := ServeConn(plugin, strings.NewReader(requests), &out); err != nil {
+		t.Fatalf("ServeConn failed: %v", err)
+	}
+
+	var responses []Response
+	scanner := bufio.NewScanner(strings.NewReader(out.String()))
+	for scanner.Scan() {
+		var resp Response
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			t.Fatalf("Invalid response %s: %v", scanner.Text(), err)
+		}
+		responses = append(responses, resp)
+	}
+	if len(responses) != 5 {
+		t.Fatalf("Expected 5 responses before shutdown, got %d", len(responses))
+	}
+
+	want := []string{
+		`{"protocol":1,"name":"calc","version":"1.0.0","functions":["add","fail"]}`,
+		`[3]`,
+		`error: failed on purpose`,
+		`error: unknown function missing`,
+		`null`,
+	}
+	for i, resp := range responses {
+		got := string(resp.Result)
+		if resp.Error != nil {
+			got = "error: " + resp.Error.Message
+		}
+		if resp.ID != uint64(i+1) || got != want[i] {
+			t.Errorf("Response %d = %d %s, want %s", i+1, resp.ID, got, want[i])
+		}
+	}
+}
+
+func TestServeConnLifecycle(t *testing.T) {
+	var level interface{}
+	plugin := Plugin{
+		Name:      "logger",
+		Version:   "1.0.0",
+		Functions: map[string]Func{},
+		Init: func(config map[string]interface{}) error {
+			level = config["level"]
+			return nil
+		},
+		Shutdown: func() error { return errors.New("flush failed") },
+	}
+	requests := strings.Join([]string{
+		`{"id":1,"method":"describe"}`,
+		`{"id":2,"method":"init","params":{"config":{"level":"debug"}}}`,
+		`{"id":3,"method":"shutdown"}`,
+	}, "\n")
+
+	var out strings.Builder
+	if err := ServeConn(plugin, strings.NewReader(requests), &out); err != nil {
+		t.Fatalf("ServeConn failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 responses, got %q", out.String())
+	}
+	if !strings.Contains(lines[0], `"init":true`) {
+		t.Errorf("Description does not ask for init: %s", lines[0])
+	}
+	if level != "debug" {
+		t.Errorf("Init got level %v, want debug", level)
+	}
+	if !strings.Contains(lines[2], "flush failed") {
+		t.Errorf("Shutdown error not returned: %s", lines[2])
+	}
+}
@@ -339,40 +339,10 @@ function tea.windowSize(width, height)
     }
 end
 
--- Function to load component modules with proper path resolution
+-- Components live in lib/ and are loaded through the plugin's own search
+-- path, so they are also available as bubbletea.lib.<name>
 local function loadComponent(name)
-    -- Try different path combinations
-    local paths = {
-        "plugins/bubbletea-plugin/lib/" .. name,
-        "./plugins/bubbletea-plugin/lib/" .. name,
-        "bubbletea-plugin/lib/" .. name,
-        "./lib/" .. name,
-        "lib/" .. name
-    }
-    
-    for _, path in ipairs(paths) do
-        local ok, module = pcall(require, path)
-        if ok then
-            return module
-        end
-        -- Also try with .lua extension
-        ok, module = pcall(dofile, path .. ".lua")
-        if ok then
-            return module
-        end
-    end
-    
-    -- If all fails, try to load from the same directory as this plugin
-    local pluginPath = debug.getinfo(1, "S").source:match("@(.*/)")
-    if pluginPath then
-        local fullPath = pluginPath .. "lib/" .. name .. ".lua"
-        local ok, module = pcall(dofile, fullPath)
-        if ok then
-            return module
-        end
-    end
-    
-    error("Failed to load component: " .. name)
+    return require("lib." .. name)
 end
 
 -- Export components modules
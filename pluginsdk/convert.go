@@ -0,0 +1,377 @@
+package pluginsdk
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// Struct fields are converted to and from the table fields named by their
+// lua tag, or after the Go field when it has none:
+//
+//	type Options struct {
+//		Path    string `lua:"path"`
+//		MaxSize int    `lua:"max_size,omitempty"`
+//		Cache   *Cache `lua:"-"`
+//	}
+//
+// omitempty leaves the field out of the tables ToLua makes when it holds
+// its zero value, and - skips the field both ways. Unexported fields are
+// skipped, and the fields of embedded structs are promoted like they are
+// by encoding/json.
+
+var (
+	luaValueType   = reflect.TypeOf((*lua.LValue)(nil)).Elem()
+	goFunctionType = reflect.TypeOf(lua.LGFunction(nil))
+)
+
+// ToLua converts a Go value to Lua. Booleans, numbers and strings become
+// their Lua counterparts and []byte a string. Slices and arrays become
+// sequences, maps and structs tables, and pointers and interfaces the value
+// they point to; nil pointers, maps and slices become nil. Functions with
+// the signature of lua.LGFunction become Lua functions and lua.LValue
+// values are returned as they are. Values of other types, such as
+// channels, are wrapped in a userdata FromLua unwraps again.
+func ToLua(L *lua.LState, value interface{}) lua.LValue {
+	if value == nil {
+		return lua.LNil
+	}
+	return toLua(L, reflect.ValueOf(value))
+}
+
+func toLua(L *lua.LState, v reflect.Value) lua.LValue {
+	if !v.IsValid() {
+		return lua.LNil
+	}
+	if v.Type().Implements(luaValueType) {
+		if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+			return lua.LNil
+		}
+		return v.Interface().(lua.LValue)
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return lua.LBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return lua.LNumber(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return lua.LNumber(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return lua.LNumber(v.Float())
+	case reflect.String:
+		return lua.LString(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			return lua.LNil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return lua.LString(v.Bytes())
+		}
+		return sequenceToLua(L, v)
+	case reflect.Array:
+		return sequenceToLua(L, v)
+	case reflect.Map:
+		if v.IsNil() {
+			return lua.LNil
+		}
+		table := L.NewTable()
+		iter := v.MapRange()
+		for iter.Next() {
+			if key := toLua(L, iter.Key()); key != lua.LNil {
+				table.RawSet(key, toLua(L, iter.Value()))
+			}
+		}
+		return table
+	case reflect.Struct:
+		table := L.NewTable()
+		for _, field := range structFields(v.Type()) {
+			fv := v.FieldByIndex(field.index)
+			if field.omitEmpty && fv.IsZero() {
+				continue
+			}
+			table.RawSetString(field.name, toLua(L, fv))
+		}
+		return table
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return lua.LNil
+		}
+		return toLua(L, v.Elem())
+	case reflect.Func:
+		if v.IsNil() {
+			return lua.LNil
+		}
+		if v.Type().ConvertibleTo(goFunctionType) {
+			return L.NewFunction(v.Convert(goFunctionType).Interface().(lua.LGFunction))
+		}
+	}
+
+	ud := L.NewUserData()
+	ud.Value = v.Interface()
+	return ud
+}
+
+func sequenceToLua(L *lua.LState, v reflect.Value) *lua.LTable {
+	table := L.CreateTable(v.Len(), 0)
+	for i := 0; i < v.Len(); i++ {
+		table.RawSetInt(i+1, toLua(L, v.Index(i)))
+	}
+	return table
+}
+
+// FromLua stores the Lua value lv in the Go value target points to,
+// converting it the way ToLua converts the other way. Tables fill structs,
+// maps, slices and arrays; table fields without a struct field are ignored
+// and struct fields missing from the table are left as they are. Numbers
+// must fit the integer types they are stored in. An empty interface gets
+// the value ToGo returns, and targets of a Lua type, such as *lua.LTable or
+// *lua.LFunction, get the Lua value itself.
+func FromLua(lv lua.LValue, target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("FromLua needs a non-nil pointer, got %T", target)
+	}
+	return fromLua(lv, v.Elem(), "")
+}
+
+// fromLua stores lv in v. path names v in errors.
+func fromLua(lv lua.LValue, v reflect.Value, path string) error {
+	t := v.Type()
+	if lv == nil || lv == lua.LNil {
+		v.Set(reflect.Zero(t))
+		return nil
+	}
+	if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+		v.Set(reflect.ValueOf(ToGo(lv)))
+		return nil
+	}
+	if reflect.TypeOf(lv).AssignableTo(t) {
+		v.Set(reflect.ValueOf(lv))
+		return nil
+	}
+	if ud, ok := lv.(*lua.LUserData); ok && ud.Value != nil && reflect.TypeOf(ud.Value).AssignableTo(t) {
+		v.Set(reflect.ValueOf(ud.Value))
+		return nil
+	}
+
+	mismatch := func() error {
+		return convertError(path, "cannot store Lua %s in %s", lv.Type(), t)
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return fromLua(lv, v.Elem(), path)
+	case reflect.Bool:
+		b, ok := lv.(lua.LBool)
+		if !ok {
+			return mismatch()
+		}
+		v.SetBool(bool(b))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := lv.(lua.LNumber)
+		if !ok {
+			return mismatch()
+		}
+		f := float64(n)
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= -math.MinInt64 || v.OverflowInt(int64(f)) {
+			return convertError(path, "%v does not fit in %s", n, t)
+		}
+		v.SetInt(int64(f))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok := lv.(lua.LNumber)
+		if !ok {
+			return mismatch()
+		}
+		f := float64(n)
+		if f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 || v.OverflowUint(uint64(f)) {
+			return convertError(path, "%v does not fit in %s", n, t)
+		}
+		v.SetUint(uint64(f))
+	case reflect.Float32, reflect.Float64:
+		n, ok := lv.(lua.LNumber)
+		if !ok {
+			return mismatch()
+		}
+		v.SetFloat(float64(n))
+	case reflect.String:
+		// Lua converts numbers to strings where strings are expected
+		switch s := lv.(type) {
+		case lua.LString:
+			v.SetString(string(s))
+		case lua.LNumber:
+			v.SetString(s.String())
+		default:
+			return mismatch()
+		}
+	case reflect.Slice:
+		if s, ok := lv.(lua.LString); ok && t.Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(s))
+			return nil
+		}
+		table, ok := lv.(*lua.LTable)
+		if !ok {
+			return mismatch()
+		}
+		n := table.Len()
+		slice := reflect.MakeSlice(t, n, n)
+		for i := 0; i < n; i++ {
+			if err := fromLua(table.RawGetInt(i+1), slice.Index(i), fmt.Sprintf("%s[%d]", path, i+1)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	case reflect.Array:
+		table, ok := lv.(*lua.LTable)
+		if !ok {
+			return mismatch()
+		}
+		for i := 0; i < t.Len(); i++ {
+			if err := fromLua(table.RawGetInt(i+1), v.Index(i), fmt.Sprintf("%s[%d]", path, i+1)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		table, ok := lv.(*lua.LTable)
+		if !ok {
+			return mismatch()
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(t))
+		}
+		var err error
+		table.ForEach(func(key, value lua.LValue) {
+			if err != nil {
+				return
+			}
+			k := reflect.New(t.Key()).Elem()
+			if err = fromLua(key, k, path+"[key]"); err != nil {
+				return
+			}
+			elem := reflect.New(t.Elem()).Elem()
+			if err = fromLua(value, elem, fmt.Sprintf("%s[%s]", path, key)); err != nil {
+				return
+			}
+			v.SetMapIndex(k, elem)
+		})
+		return err
+	case reflect.Struct:
+		table, ok := lv.(*lua.LTable)
+		if !ok {
+			return mismatch()
+		}
+		for _, field := range structFields(t) {
+			value := table.RawGetString(field.name)
+			if value == lua.LNil {
+				continue
+			}
+			name := field.name
+			if path != "" {
+				name = path + "." + name
+			}
+			if err := fromLua(value, v.FieldByIndex(field.index), name); err != nil {
+				return err
+			}
+		}
+	default:
+		return mismatch()
+	}
+	return nil
+}
+
+func convertError(path, format string, args ...interface{}) error {
+	err := fmt.Errorf(format, args...)
+	if path == "" {
+		return err
+	}
+	return fmt.Errorf("%s: %w", path, err)
+}
+
+// ToGo converts a Lua value to a plain Go value: nil, bool, float64 or
+// string, []interface{} for sequences and map[string]interface{} for other
+// tables, converting their contents in turn. Userdata gives the value it
+// holds; functions and other values are returned as they are.
+func ToGo(lv lua.LValue) interface{} {
+	switch v := lv.(type) {
+	case nil, *lua.LNilType:
+		return nil
+	case lua.LBool:
+		return bool(v)
+	case lua.LNumber:
+		return float64(v)
+	case lua.LString:
+		return string(v)
+	case *lua.LTable:
+		count := 0
+		v.ForEach(func(lua.LValue, lua.LValue) { count++ })
+		if items, ok := sequenceToGo(v, count); ok {
+			return items
+		}
+		fields := make(map[string]interface{}, count)
+		v.ForEach(func(key, value lua.LValue) {
+			fields[key.String()] = ToGo(value)
+		})
+		return fields
+	case *lua.LUserData:
+		return v.Value
+	default:
+		return v
+	}
+}
+
+// sequenceToGo converts a table of count fields whose keys are 1..count
+func sequenceToGo(table *lua.LTable, count int) ([]interface{}, bool) {
+	if count == 0 {
+		return nil, false
+	}
+	items := make([]interface{}, count)
+	for i := range items {
+		item := table.RawGetInt(i + 1)
+		if item == lua.LNil {
+			return nil, false
+		}
+		items[i] = ToGo(item)
+	}
+	return items, true
+}
+
+// field is a struct field converted to and from a table field
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// structFields lists the fields of a struct type that are converted, with
+// the fields of embedded structs promoted
+func structFields(t reflect.Type) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("lua")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			for _, promoted := range structFields(sf.Type) {
+				promoted.index = append([]int{i}, promoted.index...)
+				fields = append(fields, promoted)
+			}
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, field{name: name, index: []int{i}, omitEmpty: options == "omitempty"})
+	}
+	return fields
+}
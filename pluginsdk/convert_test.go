@@ -0,0 +1,126 @@
+package pluginsdk
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+type address struct {
+	City string `lua:"city"`
+}
+
+type meta struct {
+	Tags []string `lua:"tags,omitempty"`
+}
+
+type person struct {
+	meta
+	Name     string            `lua:"name"`
+	Age      int               `lua:"age"`
+	Email    *string           `lua:"email,omitempty"`
+	Address  address           `lua:"address"`
+	Scores   map[string]uint16 `lua:"scores"`
+	Raw      []byte            `lua:"raw"`
+	Callback *lua.LFunction    `lua:"callback"`
+	Private  string            `lua:"-"`
+	Nickname string
+	secret   string
+}
+
+func TestToLuaFromLua(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	in := person{
+		meta:     meta{Tags: []string{"a", "b"}},
+		Name:     "Ada",
+		Age:      36,
+		Address:  address{City: "London"},
+		Scores:   map[string]uint16{"math": 10},
+		Raw:      []byte("bytes"),
+		Private:  "hidden",
+		Nickname: "ada",
+		secret:   "hidden",
+	}
+	L.SetGlobal("p", ToLua(L, in))
+	script := `
+result = table.concat({p.name, p.age, p.address.city, p.scores.math, p.raw, p.Nickname,
+    p.tags[1], p.tags[2], tostring(p.email), tostring(p.Private), tostring(p.secret)}, " ")
+p.callback = function() end
+p.age = 37
+p.email = "ada@example.com"
+`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %v", err)
+	}
+	if got := L.GetGlobal("result").String(); got != "Ada 36 London 10 bytes ada a b nil nil nil" {
+		t.Errorf("ToLua gave %q", got)
+	}
+
+	var out person
+	if err := FromLua(L.GetGlobal("p"), &out); err != nil {
+		t.Fatalf("FromLua failed: %v", err)
+	}
+	if out.Callback == nil || out.Email == nil || *out.Email != "ada@example.com" {
+		t.Errorf("FromLua lost callback or email: %+v", out)
+	}
+	out.Callback, out.Email = nil, nil
+	want := in
+	want.Age, want.Private, want.secret = 37, "", ""
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("FromLua = %+v, want %+v", out, want)
+	}
+}
+
+func TestFromLuaErrors(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	tests := []struct {
+		code   string
+		target interface{}
+		want   string
+	}{
+		{`{name = 1, age = "x"}`, &person{}, "age: cannot store Lua string in int"},
+		{`{scores = {math = -1}}`, &person{}, "scores[math]: -1 does not fit in uint16"},
+		{`{address = {city = {}}}`, &person{}, "address.city: cannot store Lua table in string"},
+		{`{1, 2.5}`, &[]int{}, "[2]: 2.5 does not fit in int"},
+		{`true`, person{}, "FromLua needs a non-nil pointer"},
+	}
+	for _, tt := range tests {
+		if err := L.DoString("value = " + tt.code); err != nil {
+			t.Fatal(err)
+		}
+		err := FromLua(L.GetGlobal("value"), tt.target)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("FromLua(%s) error = %v, want %q", tt.code, err, tt.want)
+		}
+	}
+}
+
+func TestToGo(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	if err := L.DoString(`value = {list = {1, "two", true}, empty = {}, [3] = "three"}`); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"list":  []interface{}{1.0, "two", true},
+		"empty": map[string]interface{}{},
+		"3":     "three",
+	}
+	if got := ToGo(L.GetGlobal("value")); !reflect.DeepEqual(got, want) {
+		t.Errorf("ToGo = %#v, want %#v", got, want)
+	}
+
+	// Values Lua cannot hold travel as userdata
+	ch := make(chan int)
+	var back chan int
+	if err := FromLua(ToLua(L, ch), &back); err != nil || back != ch {
+		t.Errorf("FromLua(ToLua(chan)) = %v, %v", back, err)
+	}
+}
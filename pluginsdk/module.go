@@ -0,0 +1,38 @@
+package pluginsdk
+
+import (
+	"github.com/yuin/gopher-lua"
+)
+
+// Module is a Lua module made of Go functions and values
+type Module struct {
+	Functions map[string]lua.LGFunction
+	Values    map[string]interface{} // Converted with ToLua
+}
+
+// Preload makes the module available to require under name. The module
+// table is built the first time it is required.
+func (m Module) Preload(L *lua.LState, name string) {
+	L.PreloadModule(name, func(L *lua.LState) int {
+		L.Push(m.Table(L))
+		return 1
+	})
+}
+
+// Table builds the module table, for plugins that register modules in a
+// loader of their own
+func (m Module) Table(L *lua.LState) *lua.LTable {
+	table := L.NewTable()
+	for name, fn := range m.Functions {
+		table.RawSetString(name, L.NewFunction(fn))
+	}
+	for name, value := range m.Values {
+		table.RawSetString(name, ToLua(L, value))
+	}
+	return table
+}
+
+// RegisterModule preloads a module made of functions under name
+func RegisterModule(L *lua.LState, name string, functions map[string]lua.LGFunction) {
+	Module{Functions: functions}.Preload(L, name)
+}
@@ -0,0 +1,69 @@
+// Package pluginsdk is the contract between hype and Go plugins, along with
+// helpers for writing them: Lua modules, userdata types and conversion of
+// Go values to and from Lua.
+//
+// A plugin is a main package whose NewPlugin function returns a Plugin:
+//
+//	package main
+//
+//	import (
+//		"hype/pluginsdk"
+//
+//		"github.com/yuin/gopher-lua"
+//	)
+//
+//	type greeter struct{}
+//
+//	func NewPlugin() pluginsdk.Plugin { return &greeter{} }
+//
+//	func (g *greeter) APIVersion() int { return 1 }
+//
+//	func (g *greeter) Register(L *lua.LState) error {
+//		pluginsdk.Module{
+//			Functions: map[string]lua.LGFunction{"hello": hello},
+//		}.Preload(L, "greeter")
+//		return nil
+//	}
+//
+// hype compiles plugins against the SDK of the hype running or building
+// them, and refuses plugins written for an API version it does not
+// support. The hype binary itself does not link this package: plugins
+// loaded by hype run are checked by their method sets.
+package pluginsdk
+
+import (
+	"context"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// APIVersion is the version of the plugin API this SDK implements. It is
+// raised when the contract between hype and plugins changes.
+const APIVersion = 1
+
+// Plugin is implemented by every Go plugin. NewPlugin returns a new one for
+// each script run or built executable.
+type Plugin interface {
+	// APIVersion returns the plugin API version the plugin was written
+	// for: the value of APIVersion at the time, as a constant, so a later
+	// hype knows which contract the plugin expects
+	APIVersion() int
+
+	// Register makes the plugin's modules available to require in L,
+	// typically with Module.Preload
+	Register(L *lua.LState) error
+}
+
+// Initializer is implemented by plugins that take the config block of
+// their entry in hype.yaml. Init is called before Register; config is
+// empty, not nil, when there is no config block.
+type Initializer interface {
+	Init(config map[string]interface{}) error
+}
+
+// Shutdowner is implemented by plugins that need to release resources or
+// flush state when the script finishes or is interrupted. ctx is cancelled
+// when hype stops waiting for the plugin.
+type Shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
@@ -0,0 +1,88 @@
+package pluginsdk
+
+import (
+	"github.com/yuin/gopher-lua"
+)
+
+// Method is a method of a userdata type. self is the userdata's value,
+// checked to be of the type; the method's arguments start at index 2.
+type Method[T any] func(L *lua.LState, self T) int
+
+// Type describes a userdata type whose values hold a T, such as a database
+// handle, with the methods Lua calls on it:
+//
+//	var connType = &pluginsdk.Type[*Conn]{
+//		Name: "mydb.conn",
+//		Methods: map[string]pluginsdk.Method[*Conn]{
+//			"query": connQuery,
+//			"close": connClose,
+//		},
+//	}
+//
+// Functions then return connType.New(L, conn), and Lua calls conn:query(sql).
+type Type[T any] struct {
+	// Name names the type's metatable in the Lua registry. It should be
+	// prefixed with the module name, since every plugin shares the
+	// registry.
+	Name string
+
+	// Methods are called with the colon syntax, value:method(...)
+	Methods map[string]Method[T]
+
+	// Metamethods such as __tostring, __len or __eq. __index is
+	// set to Methods and is not overridden.
+	Metamethods map[string]Method[T]
+}
+
+// Register creates the type's metatable in L, if it does not exist yet, and
+// returns it. New registers the type itself, so calling Register is only
+// needed to get the metatable.
+func (t *Type[T]) Register(L *lua.LState) *lua.LTable {
+	if mt, ok := L.GetTypeMetatable(t.Name).(*lua.LTable); ok {
+		return mt
+	}
+	mt := L.NewTypeMetatable(t.Name)
+	for name, method := range t.Metamethods {
+		mt.RawSetString(name, L.NewFunction(t.wrap(method)))
+	}
+	methods := L.NewTable()
+	for name, method := range t.Methods {
+		methods.RawSetString(name, L.NewFunction(t.wrap(method)))
+	}
+	mt.RawSetString("__index", methods)
+	return mt
+}
+
+// New returns a userdata of the type holding value
+func (t *Type[T]) New(L *lua.LState, value T) *lua.LUserData {
+	ud := L.NewUserData()
+	ud.Value = value
+	L.SetMetatable(ud, t.Register(L))
+	return ud
+}
+
+// Check returns the value of the userdata at stack index n, raising an
+// argument error if it is not of the type
+func (t *Type[T]) Check(L *lua.LState, n int) T {
+	value, ok := t.Value(L.Get(n))
+	if !ok {
+		L.ArgError(n, t.Name+" expected")
+	}
+	return value
+}
+
+// Value returns the value held by lv when it is a userdata of the type
+func (t *Type[T]) Value(lv lua.LValue) (T, bool) {
+	if ud, ok := lv.(*lua.LUserData); ok {
+		value, ok := ud.Value.(T)
+		return value, ok
+	}
+	var zero T
+	return zero, false
+}
+
+func (t *Type[T]) wrap(method Method[T]) lua.LGFunction {
+	return func(L *lua.LState) int {
+		return method(L, t.Check(L, 1))
+	}
+}
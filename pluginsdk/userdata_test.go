@@ -0,0 +1,87 @@
+package pluginsdk
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+
+	"hype/hyperuntime"
+)
+
+type counter struct{ n int }
+
+var counterType = &Type[*counter]{
+	Name: "test.counter",
+	Methods: map[string]Method[*counter]{
+		"add": func(L *lua.LState, c *counter) int {
+			c.n += L.OptInt(2, 1)
+			L.Push(lua.LNumber(c.n))
+			return 1
+		},
+	},
+	Metamethods: map[string]Method[*counter]{
+		"__tostring": func(L *lua.LState, c *counter) int {
+			L.Push(lua.LString(fmt.Sprintf("counter(%d)", c.n)))
+			return 1
+		},
+	},
+}
+
+// testPlugin is a plugin written against the SDK
+type testPlugin struct{}
+
+func (testPlugin) APIVersion() int { return 1 }
+
+func (testPlugin) Register(L *lua.LState) error {
+	Module{
+		Functions: map[string]lua.LGFunction{
+			"new": func(L *lua.LState) int {
+				L.Push(counterType.New(L, &counter{n: L.OptInt(1, 0)}))
+				return 1
+			},
+			"value": func(L *lua.LState) int {
+				L.Push(lua.LNumber(counterType.Check(L, 1).n))
+				return 1
+			},
+		},
+		Values: map[string]interface{}{"limits": []int{1, 10}},
+	}.Preload(L, "counter")
+	return nil
+}
+
+var _ Plugin = testPlugin{}
+
+func TestPluginModuleAndType(t *testing.T) {
+	L := hyperuntime.NewState("test.lua", nil)
+	defer L.Close()
+
+	// The runtime takes SDK plugins as they are
+	if err := hyperuntime.RegisterGoPlugin(L, "counter", testPlugin{}, nil); err != nil {
+		t.Fatalf("RegisterGoPlugin failed: %v", err)
+	}
+	script := `
+local counter = require("counter")
+local c = counter.new(5)
+c:add()
+c:add(counter.limits[2])
+result = tostring(c) .. " " .. counter.value(c)
+ok, err = pcall(counter.value, {})
+`
+	if err := L.DoString(script); err != nil {
+		t.Fatalf("Script failed: %v", err)
+	}
+	if got := L.GetGlobal("result").String(); got != "counter(16) 16" {
+		t.Errorf("result = %q", got)
+	}
+	if err := L.GetGlobal("err").String(); !strings.Contains(err, "test.counter expected") {
+		t.Errorf("Expected a type error, got %q", err)
+	}
+}
+
+func TestAPIVersionMatchesRuntime(t *testing.T) {
+	if APIVersion != hyperuntime.PluginAPIVersion {
+		t.Errorf("pluginsdk.APIVersion = %d, but the runtime loads version %d", APIVersion, hyperuntime.PluginAPIVersion)
+	}
+}
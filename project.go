@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"hype/hyperuntime"
+
+	"gopkg.in/yaml.v2"
+)
+
+// projectFileName is the project manifest hype looks for in the working
+// directory when build, run or bundle is given no script
+const projectFileName = "hype.yaml"
+
+// Project is a hype.yaml project manifest. It is the checked-in description
+// of how an app is built; CLI flags override individual settings.
+type Project struct {
+	Name    string                 `yaml:"name"`
+	Version string                 `yaml:"version"`
+	Entry   string                 `yaml:"entry"`   // Entry script, relative to the manifest
+	Output  string                 `yaml:"output"`  // Executable name (default: name)
+	Plugins []PluginSpec           `yaml:"plugins"` // Same format as --plugins-config
+	Embed   []string               `yaml:"embed"`   // Directories served by the assets module
+	Targets []string               `yaml:"targets"` // os or os/arch build targets
+	Defines map[string]interface{} `yaml:"defines"` // Values exposed to scripts as hype.defines
+	Paths   []string               `yaml:"paths"`   // Module search paths like package.path, before lua_modules
+
+	TrustedKeys      string `yaml:"trusted_keys"`      // JWKS file of the keys plugins must be signed with
+	PluginSignatures string `yaml:"plugin_signatures"` // warn (default) or require
+
+	// Dir is the directory containing the manifest. Relative paths in the
+	// manifest are resolved against it.
+	Dir string `yaml:"-"`
+}
+
+// LoadProject reads and validates a project manifest
+func LoadProject(path string) (*Project, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read project manifest: %w", err)
+	}
+
+	var project Project
+	if err := yaml.UnmarshalStrict(data, &project); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	project.Dir = filepath.Dir(path)
+
+	for key, value := range project.Defines {
+		switch value.(type) {
+		case map[interface{}]interface{}, []interface{}:
+			return nil, fmt.Errorf("%s: define %s must be a string, number or boolean", path, key)
+		}
+	}
+
+	for i := range project.Plugins {
+		spec := &project.Plugins[i]
+		if spec.Name == "" {
+			return nil, fmt.Errorf("%s: plugin %d has no name", path, i+1)
+		}
+		if spec.Source == "" {
+			spec.Source = spec.Name
+		}
+		if err := hyperuntime.ValidatePermissions(spec.Permissions); err != nil {
+			return nil, fmt.Errorf("%s: plugin %s: %w", path, spec.Name, err)
+		}
+		config, err := normalizePluginConfig(spec.Config)
+		if err != nil {
+			return nil, fmt.Errorf("%s: plugin %s: %w", path, spec.Name, err)
+		}
+		spec.Config = config
+	}
+
+	switch project.PluginSignatures {
+	case "", signaturesWarn:
+	case signaturesRequire:
+		if project.TrustedKeys == "" {
+			return nil, fmt.Errorf("%s: plugin_signatures: %s needs trusted_keys", path, signaturesRequire)
+		}
+	default:
+		return nil, fmt.Errorf("%s: plugin_signatures must be %s or %s", path, signaturesWarn, signaturesRequire)
+	}
+
+	return &project, nil
+}
+
+// findProject loads the manifest at path, or hype.yaml in the working
+// directory when path is empty. It returns nil without an error when no
+// path is given and there is no hype.yaml.
+func findProject(path string) (*Project, error) {
+	if path == "" {
+		if _, err := os.Stat(projectFileName); err != nil {
+			return nil, nil
+		}
+		path = projectFileName
+	}
+	return LoadProject(path)
+}
+
+// Path resolves a path from the manifest against the manifest directory
+func (p *Project) Path(rel string) string {
+	if filepath.IsAbs(rel) {
+		return rel
+	}
+	return filepath.Join(p.Dir, rel)
+}
+
+// EntryPath returns the entry script
+func (p *Project) EntryPath() (string, error) {
+	if p.Entry == "" {
+		return "", fmt.Errorf("%s has no entry script", projectFileName)
+	}
+	return p.Path(p.Entry), nil
+}
+
+// OutputName returns the executable name to build
+func (p *Project) OutputName() string {
+	switch {
+	case p.Output != "":
+		return p.Path(p.Output)
+	case p.Name != "":
+		return p.Path(p.Name)
+	}
+	return ""
+}
+
+// EmbedDirs returns the embedded directories
+func (p *Project) EmbedDirs() []string {
+	var dirs []string
+	for _, dir := range p.Embed {
+		dirs = append(dirs, p.Path(dir))
+	}
+	return dirs
+}
+
+// LuaPaths returns the module search paths: the configured paths, then
+// lua_modules
+func (p *Project) LuaPaths() []string {
+	return luaSearchPaths(p.Dir, p.Paths)
+}
+
+// TrustedKeysPath returns the JWKS file plugin signatures are verified
+// against, or "" when signatures are not checked
+func (p *Project) TrustedKeysPath() string {
+	if p.TrustedKeys == "" {
+		return ""
+	}
+	return p.Path(p.TrustedKeys)
+}
+
+// RequireSignedPlugins reports whether unsigned and untrusted plugins are refused
+func (p *Project) RequireSignedPlugins() bool {
+	return p.PluginSignatures == signaturesRequire
+}
+
+// TargetSpec returns the build targets in -t format
+func (p *Project) TargetSpec() string {
+	return strings.Join(p.Targets, ",")
+}
+
+// PluginSpecs returns the plugins with local sources resolved against the
+// manifest directory
+func (p *Project) PluginSpecs() []PluginSpec {
+	var specs []PluginSpec
+	for _, spec := range p.Plugins {
+		switch {
+		case filepath.IsAbs(spec.Source):
+		case strings.HasPrefix(spec.Source, "./"), strings.HasPrefix(spec.Source, "../"):
+			spec.Source = localPluginPath(p.Dir, spec.Source)
+		case !strings.Contains(spec.Source, "/"):
+			if path, ok := findConventionalPlugin(p.Dir, spec.Source); ok {
+				spec.Source = path
+			}
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+// DefineValues returns the defines as strings
+func (p *Project) DefineValues() map[string]string {
+	defines := make(map[string]string)
+	for key, value := range p.Defines {
+		if value == nil {
+			value = ""
+		}
+		defines[key] = fmt.Sprint(value)
+	}
+	return defines
+}
+
+// mergeDefines adds --define KEY=VALUE flags to the defines from the
+// project, replacing project values with the same key
+func mergeDefines(base map[string]string, flags []string) (map[string]string, error) {
+	defines := make(map[string]string, len(base)+len(flags))
+	for key, value := range base {
+		defines[key] = value
+	}
+	for _, flag := range flags {
+		key, value, ok := strings.Cut(flag, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid define %q: expected KEY=VALUE", flag)
+		}
+		defines[strings.TrimSpace(key)] = value
+	}
+	return defines, nil
+}
+
+// mergePluginSpecs combines plugins from the project with plugins given on
+// the command line. A command line plugin replaces a project plugin with the
+// same name, and keeps the permissions the project allows it and the config
+// the project gives it unless it lists its own.
+func mergePluginSpecs(base, overrides []PluginSpec) []PluginSpec {
+	overridden := make(map[string]bool)
+	for _, spec := range overrides {
+		overridden[spec.Name] = true
+	}
+
+	var merged []PluginSpec
+	allowed := make(map[string][]string)
+	configs := make(map[string]map[string]interface{})
+	for _, spec := range base {
+		allowed[spec.Name] = spec.Permissions
+		configs[spec.Name] = spec.Config
+		if !overridden[spec.Name] {
+			merged = append(merged, spec)
+		}
+	}
+	for _, spec := range overrides {
+		if spec.Permissions == nil {
+			spec.Permissions = allowed[spec.Name]
+		}
+		if spec.Config == nil {
+			spec.Config = configs[spec.Name]
+		}
+		merged = append(merged, spec)
+	}
+	return merged
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadProject(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "plugins", "greet"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := `
+name: app
+version: 1.2.0
+entry: src/main.lua
+embed: [public]
+targets: [linux/amd64, darwin/arm64]
+plugins:
+  - name: greet
+    config:
+      greeting: Hi
+      retries: 3
+      style: {bold: true}
+  - name: local
+    source: ./vendor/local
+    version: 1.0.0
+  - name: remote
+    source: github.com/example/remote
+defines:
+  API_URL: https://example.com
+  DEBUG: true
+  RETRIES: 3
+`
+	manifestPath := filepath.Join(dir, projectFileName)
+	if err := os.WriteFile(manifestPath, []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	project, err := LoadProject(manifestPath)
+	if err != nil {
+		t.Fatalf("LoadProject failed: %v", err)
+	}
+
+	entry, err := project.EntryPath()
+	if err != nil {
+		t.Fatalf("EntryPath failed: %v", err)
+	}
+	if want := filepath.Join(dir, "src", "main.lua"); entry != want {
+		t.Errorf("EntryPath = %q, want %q", entry, want)
+	}
+	if want := filepath.Join(dir, "app"); project.OutputName() != want {
+		t.Errorf("OutputName = %q, want %q", project.OutputName(), want)
+	}
+	if want := []string{filepath.Join(dir, "public")}; !reflect.DeepEqual(project.EmbedDirs(), want) {
+		t.Errorf("EmbedDirs = %v, want %v", project.EmbedDirs(), want)
+	}
+	if want := "linux/amd64,darwin/arm64"; project.TargetSpec() != want {
+		t.Errorf("TargetSpec = %q, want %q", project.TargetSpec(), want)
+	}
+
+	// Plugin config is normalized to the JSON values plugins receive
+	wantConfig := map[string]interface{}{"greeting": "Hi", "retries": 3.0, "style": map[string]interface{}{"bold": true}}
+	if config := project.Plugins[0].Config; !reflect.DeepEqual(config, wantConfig) {
+		t.Errorf("Plugin config = %#v, want %#v", config, wantConfig)
+	}
+
+	sources := map[string]string{}
+	for _, spec := range project.PluginSpecs() {
+		sources[spec.Name] = spec.Source
+	}
+	wantSources := map[string]string{
+		"greet":  filepath.ToSlash(filepath.Join(dir, "plugins", "greet")),
+		"local":  filepath.ToSlash(filepath.Join(dir, "vendor", "local")),
+		"remote": "github.com/example/remote",
+	}
+	if !reflect.DeepEqual(sources, wantSources) {
+		t.Errorf("Plugin sources = %v, want %v", sources, wantSources)
+	}
+
+	wantDefines := map[string]string{"API_URL": "https://example.com", "DEBUG": "true", "RETRIES": "3"}
+	if !reflect.DeepEqual(project.DefineValues(), wantDefines) {
+		t.Errorf("DefineValues = %v, want %v", project.DefineValues(), wantDefines)
+	}
+}
+
+func TestLoadProjectErrors(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":            "name: app\nentrypoint: main.lua\n",
+		"unnamed plugin":           "plugins:\n  - source: ./x\n",
+		"structured define":        "defines:\n  LIST: [1, 2]\n",
+		"unknown permission":       "plugins:\n  - name: fs\n    permissions: [fs:delete]\n",
+		"unknown signature policy": "trusted_keys: keys.jwks\nplugin_signatures: strict\n",
+		"require without keys":     "plugin_signatures: require\n",
+	}
+
+	for name, manifest := range tests {
+		path := filepath.Join(t.TempDir(), projectFileName)
+		if err := os.WriteFile(path, []byte(manifest), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadProject(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestMergePluginSpecs(t *testing.T) {
+	config := map[string]interface{}{"root": "/data"}
+	base := []PluginSpec{{Name: "fs", Version: "1.0.0", Permissions: []string{"fs:read"}, Config: config}, {Name: "kv2", Version: "2.0.0"}}
+	overrides := []PluginSpec{{Name: "fs", Version: "1.1.0"}, {Name: "extra"}}
+
+	// The project's permissions and config carry over to the plugin replacing its own
+	merged := mergePluginSpecs(base, overrides)
+	want := []PluginSpec{{Name: "kv2", Version: "2.0.0"}, {Name: "fs", Version: "1.1.0", Permissions: []string{"fs:read"}, Config: config}, {Name: "extra"}}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("mergePluginSpecs = %v, want %v", merged, want)
+	}
+}
+
+func TestMergeDefines(t *testing.T) {
+	base := map[string]string{"API_URL": "https://example.com", "DEBUG": "false"}
+
+	merged, err := mergeDefines(base, []string{"DEBUG=true", "VERSION=1.2.3", "EMPTY=", "EXPR=a=b"})
+	if err != nil {
+		t.Fatalf("mergeDefines failed: %v", err)
+	}
+	want := map[string]string{"API_URL": "https://example.com", "DEBUG": "true", "VERSION": "1.2.3", "EMPTY": "", "EXPR": "a=b"}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("mergeDefines = %v, want %v", merged, want)
+	}
+	if base["DEBUG"] != "false" {
+		t.Errorf("mergeDefines modified the project defines")
+	}
+
+	for _, flag := range []string{"NOVALUE", "=value"} {
+		if _, err := mergeDefines(nil, []string{flag}); err == nil {
+			t.Errorf("Expected an error for --define %q", flag)
+		}
+	}
+}
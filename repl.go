@@ -8,6 +8,8 @@ import (
 
 	"github.com/yuin/gopher-lua"
 	"github.com/spf13/cobra"
+
+	"hype/hyperuntime"
 )
 
 var replCmd = &cobra.Command{
@@ -59,12 +61,7 @@ func runREPL(simpleMode bool) error {
 	lua.OpenDebug(L)
 
 	// Register all modules
-	RegisterHTTPModule(L)
-	registerKVModule(L)
-	registerTUIFunctions(L)
-	registerCryptoModule(L)
-	registerHTTPSigModule(L)
-	registerWebSocketModule(L)
+	hyperuntime.RegisterModules(L)
 	
 
 	if simpleMode {
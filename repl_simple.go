@@ -8,6 +8,8 @@ import (
 
 	"github.com/yuin/gopher-lua"
 	"github.com/spf13/cobra"
+
+	"hype/hyperuntime"
 )
 
 var replSimpleCmd = &cobra.Command{
@@ -39,12 +41,7 @@ func runSimpleREPLDirect() error {
 	lua.OpenDebug(L)
 
 	// Register all modules
-	RegisterHTTPModule(L)
-	registerKVModule(L)
-	registerTUIFunctions(L)
-	registerCryptoModule(L)
-	registerHTTPSigModule(L)
-	registerWebSocketModule(L)
+	hyperuntime.RegisterModules(L)
 
 	fmt.Println("🚀 Hype Lua REPL v1.8.0")
 	fmt.Println("========================")
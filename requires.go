@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yuin/gopher-lua/ast"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// requireCall is a call to require found in a script
+type requireCall struct {
+	Name    string // Module name; empty for a dynamic require
+	Line    int
+	Dynamic bool // The module name is computed at runtime
+}
+
+// findRequires parses a script and returns its require calls. Every call
+// syntax counts: require("x"), require "x" and require [[x]]. Requires
+// inside comments and strings are not calls and are ignored. name is used in
+// syntax errors.
+func findRequires(source, name string) ([]requireCall, error) {
+	chunk, err := parse.Parse(strings.NewReader(source), name)
+	if err != nil {
+		return nil, fmt.Errorf("syntax error: %v", err)
+	}
+
+	var calls []requireCall
+	walkStmts(chunk, func(call *ast.FuncCallExpr) {
+		ident, ok := call.Func.(*ast.IdentExpr)
+		if !ok || ident.Value != "require" || call.Receiver != nil {
+			return
+		}
+		if len(call.Args) > 0 {
+			if str, ok := call.Args[0].(*ast.StringExpr); ok {
+				calls = append(calls, requireCall{Name: str.Value, Line: call.Line()})
+				return
+			}
+		}
+		calls = append(calls, requireCall{Line: call.Line(), Dynamic: true})
+	})
+	return calls, nil
+}
+
+// walkStmts calls fn for every function call in stmts, outer calls first
+func walkStmts(stmts []ast.Stmt, fn func(*ast.FuncCallExpr)) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.AssignStmt:
+			walkExprs(s.Lhs, fn)
+			walkExprs(s.Rhs, fn)
+		case *ast.LocalAssignStmt:
+			walkExprs(s.Exprs, fn)
+		case *ast.FuncCallStmt:
+			walkExpr(s.Expr, fn)
+		case *ast.DoBlockStmt:
+			walkStmts(s.Stmts, fn)
+		case *ast.WhileStmt:
+			walkExpr(s.Condition, fn)
+			walkStmts(s.Stmts, fn)
+		case *ast.RepeatStmt:
+			walkStmts(s.Stmts, fn)
+			walkExpr(s.Condition, fn)
+		case *ast.IfStmt:
+			walkExpr(s.Condition, fn)
+			walkStmts(s.Then, fn)
+			walkStmts(s.Else, fn)
+		case *ast.NumberForStmt:
+			walkExprs([]ast.Expr{s.Init, s.Limit, s.Step}, fn)
+			walkStmts(s.Stmts, fn)
+		case *ast.GenericForStmt:
+			walkExprs(s.Exprs, fn)
+			walkStmts(s.Stmts, fn)
+		case *ast.FuncDefStmt:
+			walkStmts(s.Func.Stmts, fn)
+		case *ast.ReturnStmt:
+			walkExprs(s.Exprs, fn)
+		}
+	}
+}
+
+// walkExprs calls fn for every function call in exprs
+func walkExprs(exprs []ast.Expr, fn func(*ast.FuncCallExpr)) {
+	for _, expr := range exprs {
+		walkExpr(expr, fn)
+	}
+}
+
+// walkExpr calls fn for every function call in expr
+func walkExpr(expr ast.Expr, fn func(*ast.FuncCallExpr)) {
+	switch e := expr.(type) {
+	case *ast.FuncCallExpr:
+		fn(e)
+		walkExpr(e.Func, fn)
+		walkExpr(e.Receiver, fn)
+		walkExprs(e.Args, fn)
+	case *ast.AttrGetExpr:
+		walkExpr(e.Object, fn)
+		walkExpr(e.Key, fn)
+	case *ast.TableExpr:
+		for _, field := range e.Fields {
+			walkExpr(field.Key, fn)
+			walkExpr(field.Value, fn)
+		}
+	case *ast.LogicalOpExpr:
+		walkExpr(e.Lhs, fn)
+		walkExpr(e.Rhs, fn)
+	case *ast.RelationalOpExpr:
+		walkExpr(e.Lhs, fn)
+		walkExpr(e.Rhs, fn)
+	case *ast.StringConcatOpExpr:
+		walkExpr(e.Lhs, fn)
+		walkExpr(e.Rhs, fn)
+	case *ast.ArithmeticOpExpr:
+		walkExpr(e.Lhs, fn)
+		walkExpr(e.Rhs, fn)
+	case *ast.UnaryMinusOpExpr:
+		walkExpr(e.Expr, fn)
+	case *ast.UnaryNotOpExpr:
+		walkExpr(e.Expr, fn)
+	case *ast.UnaryLenOpExpr:
+		walkExpr(e.Expr, fn)
+	case *ast.FunctionExpr:
+		walkStmts(e.Stmts, fn)
+	}
+}
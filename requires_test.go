@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindRequires(t *testing.T) {
+	source := `local a = require("a")
+local b = require 'b'
+local c = require [[c]]
+-- require("commented")
+--[[ require("block comment") ]]
+local s = "require('in a string')"
+local function load(name)
+  return require(name)
+end
+local t = {helper = require("d").helper}
+local obj = {require = function() end}
+obj.require("method")
+if x then require("lib.e") end
+`
+	calls, err := findRequires(source, "main.lua")
+	if err != nil {
+		t.Fatalf("findRequires failed: %v", err)
+	}
+
+	want := []requireCall{
+		{Name: "a", Line: 1},
+		{Name: "b", Line: 2},
+		{Name: "c", Line: 3},
+		{Line: 8, Dynamic: true},
+		{Name: "d", Line: 10},
+		{Name: "lib.e", Line: 13},
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("findRequires = %+v, want %+v", calls, want)
+	}
+}
+
+func TestFindRequiresSyntaxError(t *testing.T) {
+	_, err := findRequires("local x = \nfunction(", "broken.lua")
+	if err == nil || !strings.Contains(err.Error(), "broken.lua") {
+		t.Fatalf("Expected a syntax error naming the file, got %v", err)
+	}
+}
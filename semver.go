@@ -0,0 +1,365 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// semVersion is a parsed semantic version. Build metadata is dropped since
+// it does not take part in ordering.
+type semVersion struct {
+	Major, Minor, Patch int
+	Pre                 []string // Pre-release identifiers, e.g. alpha.1
+}
+
+// parseSemVersion parses a full version such as 1.2.3, v1.2.3 or
+// 1.2.3-rc.1+build.5
+func parseSemVersion(s string) (semVersion, error) {
+	v, parts, err := parsePartialVersion(s)
+	if err != nil {
+		return semVersion{}, err
+	}
+	if parts != 3 {
+		return semVersion{}, fmt.Errorf("invalid version %q: expected major.minor.patch", s)
+	}
+	return v, nil
+}
+
+// parsePartialVersion parses a version that may leave out trailing parts or
+// use x or * as a wildcard, as in 1.2, 1.x or 1.2.*, and returns how many
+// parts were given
+func parsePartialVersion(s string) (semVersion, int, error) {
+	var v semVersion
+	text := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexByte(text, '+'); i >= 0 {
+		text = text[:i]
+	}
+	core := text
+	if i := strings.IndexByte(text, '-'); i >= 0 {
+		core = text[:i]
+		v.Pre = strings.Split(text[i+1:], ".")
+		for _, id := range v.Pre {
+			if id == "" {
+				return v, 0, fmt.Errorf("invalid version %q: empty pre-release identifier", s)
+			}
+		}
+	}
+
+	fields := strings.Split(core, ".")
+	if core == "" || len(fields) > 3 {
+		return v, 0, fmt.Errorf("invalid version %q", s)
+	}
+	numbers := []*int{&v.Major, &v.Minor, &v.Patch}
+	parts := 0
+	for i, field := range fields {
+		if field == "x" || field == "X" || field == "*" {
+			break
+		}
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return v, 0, fmt.Errorf("invalid version %q", s)
+		}
+		*numbers[i] = n
+		parts++
+	}
+	if parts < 3 && v.Pre != nil {
+		return v, 0, fmt.Errorf("invalid version %q: pre-release needs major.minor.patch", s)
+	}
+	return v, parts, nil
+}
+
+// String formats the version without a v prefix
+func (v semVersion) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.Pre) > 0 {
+		s += "-" + strings.Join(v.Pre, ".")
+	}
+	return s
+}
+
+// compare orders versions by semver precedence: a pre-release sorts before
+// its release, and pre-release identifiers compare numerically when both
+// are numbers
+func (v semVersion) compare(o semVersion) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+	switch {
+	case len(v.Pre) == 0 && len(o.Pre) == 0:
+		return 0
+	case len(v.Pre) == 0:
+		return 1
+	case len(o.Pre) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.Pre) && i < len(o.Pre); i++ {
+		a, b := v.Pre[i], o.Pre[i]
+		an, aErr := strconv.Atoi(a)
+		bn, bErr := strconv.Atoi(b)
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				return sign(an - bn)
+			}
+		case aErr == nil:
+			return -1 // Numeric identifiers sort before alphanumeric ones
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(a, b); c != 0 {
+				return c
+			}
+		}
+	}
+	return sign(len(v.Pre) - len(o.Pre))
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// sameCore reports whether two versions share major.minor.patch
+func (v semVersion) sameCore(o semVersion) bool {
+	return v.Major == o.Major && v.Minor == o.Minor && v.Patch == o.Patch
+}
+
+// versionComparator is one bound of a range, e.g. >=1.2.0
+type versionComparator struct {
+	op      string // =, >, >=, <, <=
+	version semVersion
+}
+
+func (c versionComparator) matches(v semVersion) bool {
+	d := v.compare(c.version)
+	switch c.op {
+	case ">":
+		return d > 0
+	case ">=":
+		return d >= 0
+	case "<":
+		return d < 0
+	case "<=":
+		return d <= 0
+	}
+	return d == 0
+}
+
+// versionConstraint is a parsed version requirement: ranges joined by ||,
+// each a list of comparators that must all hold
+type versionConstraint struct {
+	raw    string
+	ranges [][]versionComparator
+}
+
+// parseVersionConstraint parses npm-style constraints: exact versions,
+// ^1.2.3, ~1.2.3, comparisons such as >=1.0.0 <2.0.0, x-ranges such as 1.x,
+// hyphen ranges such as 1.0.0 - 1.4.0 and alternatives joined by ||. An
+// empty constraint, latest and * match any release.
+func parseVersionConstraint(s string) (*versionConstraint, error) {
+	c := &versionConstraint{raw: s}
+	for _, alternative := range strings.Split(s, "||") {
+		alternative = strings.TrimSpace(alternative)
+		var comparators []versionComparator
+		var err error
+		if lower, upper, ok := strings.Cut(alternative, " - "); ok {
+			comparators, err = parseHyphenRange(lower, upper)
+		} else {
+			comparators, err = parseComparators(alternative)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint %q: %w", s, err)
+		}
+		c.ranges = append(c.ranges, comparators)
+	}
+	return c, nil
+}
+
+// parseComparators parses a space separated list of comparators
+func parseComparators(s string) ([]versionComparator, error) {
+	var comparators []versionComparator
+	fields := strings.Fields(s)
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		if field == "latest" || field == "*" || field == "x" || field == "X" {
+			continue
+		}
+
+		op := ""
+		for _, prefix := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+			if strings.HasPrefix(field, prefix) {
+				op = prefix
+				break
+			}
+		}
+		text := strings.TrimPrefix(field, op)
+		// Allow a space between the operator and the version, as in >= 1.0
+		if text == "" && op != "" && i+1 < len(fields) {
+			i++
+			text = fields[i]
+		}
+
+		expanded, err := expandComparator(op, text)
+		if err != nil {
+			return nil, err
+		}
+		comparators = append(comparators, expanded...)
+	}
+	return comparators, nil
+}
+
+// expandComparator turns one operator and partial version into plain
+// comparators
+func expandComparator(op, text string) ([]versionComparator, error) {
+	v, parts, err := parsePartialVersion(text)
+	if err != nil {
+		return nil, err
+	}
+
+	// bump returns the first version after the given parts, e.g. 1.3.0 for
+	// 1.2 and 2.0.0 for 1
+	bump := func(parts int) semVersion {
+		switch parts {
+		case 1:
+			return semVersion{Major: v.Major + 1}
+		case 2:
+			return semVersion{Major: v.Major, Minor: v.Minor + 1}
+		}
+		return semVersion{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}
+	}
+	lower := versionComparator{">=", v}
+	if parts == 0 {
+		if op == "<" || op == ">" {
+			return []versionComparator{{"<", semVersion{}}}, nil // Matches nothing
+		}
+		return nil, nil
+	}
+
+	switch op {
+	case "^":
+		// Changes that do not modify the left-most non-zero part
+		switch {
+		case v.Major > 0 || parts == 1:
+			return []versionComparator{lower, {"<", bump(1)}}, nil
+		case v.Minor > 0 || parts == 2:
+			return []versionComparator{lower, {"<", bump(2)}}, nil
+		}
+		return []versionComparator{lower, {"<", bump(3)}}, nil
+	case "~":
+		if parts == 1 {
+			return []versionComparator{lower, {"<", bump(1)}}, nil
+		}
+		return []versionComparator{lower, {"<", bump(2)}}, nil
+	case ">":
+		if parts < 3 {
+			return []versionComparator{{">=", bump(parts)}}, nil
+		}
+		return []versionComparator{{">", v}}, nil
+	case ">=":
+		return []versionComparator{lower}, nil
+	case "<":
+		return []versionComparator{{"<", v}}, nil
+	case "<=":
+		if parts < 3 {
+			return []versionComparator{{"<", bump(parts)}}, nil
+		}
+		return []versionComparator{{"<=", v}}, nil
+	}
+
+	// A bare or = version is exact, or a range when parts are left out
+	if parts < 3 {
+		return []versionComparator{lower, {"<", bump(parts)}}, nil
+	}
+	return []versionComparator{{"=", v}}, nil
+}
+
+// parseHyphenRange parses lower - upper, inclusive
+func parseHyphenRange(lower, upper string) ([]versionComparator, error) {
+	from, err := expandComparator(">=", strings.TrimSpace(lower))
+	if err != nil {
+		return nil, err
+	}
+	to, err := expandComparator("<=", strings.TrimSpace(upper))
+	if err != nil {
+		return nil, err
+	}
+	return append(from, to...), nil
+}
+
+// Matches reports whether v satisfies the constraint. A pre-release only
+// matches a range that names a pre-release of the same major.minor.patch,
+// so ^1.0.0 does not pick 1.1.0-beta but >=1.1.0-alpha does.
+func (c *versionConstraint) Matches(v semVersion) bool {
+	for _, comparators := range c.ranges {
+		if matchesAll(comparators, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAll(comparators []versionComparator, v semVersion) bool {
+	for _, comparator := range comparators {
+		if !comparator.matches(v) {
+			return false
+		}
+	}
+	if len(v.Pre) == 0 {
+		return true
+	}
+	for _, comparator := range comparators {
+		if len(comparator.version.Pre) > 0 && comparator.version.sameCore(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the constraint as written
+func (c *versionConstraint) String() string {
+	return c.raw
+}
+
+// highestMatchingVersion returns the highest of the available versions that
+// satisfies constraint. Versions that are not semantic versions, such as
+// commit hashes, only match a constraint equal to them.
+func highestMatchingVersion(constraint string, available []string) (string, bool) {
+	for _, version := range available {
+		if version == constraint && constraint != "" {
+			if _, err := parseSemVersion(version); err != nil {
+				return version, true
+			}
+		}
+	}
+
+	c, err := parseVersionConstraint(constraint)
+	if err != nil {
+		return "", false
+	}
+
+	type candidate struct {
+		raw     string
+		version semVersion
+	}
+	var matches []candidate
+	for _, raw := range available {
+		v, err := parseSemVersion(raw)
+		if err == nil && c.Matches(v) {
+			matches = append(matches, candidate{raw, v})
+		}
+	}
+	if len(matches) == 0 {
+		return "", false
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].version.compare(matches[j].version) > 0 })
+	return matches[0].raw, true
+}
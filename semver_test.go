@@ -0,0 +1,108 @@
+package main
+
+import "testing"
+
+func TestVersionOrdering(t *testing.T) {
+	// Each version sorts after the one before it
+	ordered := []string{
+		"0.9.9",
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"v1.0.1",
+		"1.2.0+build.5",
+		"1.10.0",
+		"2.0.0",
+	}
+	for i := 1; i < len(ordered); i++ {
+		a, err := parseSemVersion(ordered[i-1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := parseSemVersion(ordered[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.compare(b) >= 0 || b.compare(a) <= 0 {
+			t.Errorf("Expected %s < %s", ordered[i-1], ordered[i])
+		}
+	}
+
+	for _, invalid := range []string{"", "1.2", "1.2.3.4", "1.a.3", "1.2.3-", "1.2.3-a..b"} {
+		if _, err := parseSemVersion(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestVersionConstraints(t *testing.T) {
+	tests := []struct {
+		constraint string
+		matches    []string
+		rejects    []string
+	}{
+		{"latest", []string{"0.0.1", "3.2.1"}, []string{"1.0.0-beta"}},
+		{"1.2.3", []string{"1.2.3", "v1.2.3"}, []string{"1.2.4", "1.2.3-rc.1"}},
+		{"^1.2.3", []string{"1.2.3", "1.9.0"}, []string{"1.2.2", "2.0.0", "2.0.0-alpha", "1.3.0-beta"}},
+		{"^0.2.3", []string{"0.2.3", "0.2.9"}, []string{"0.3.0"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4"}},
+		{"~1.2.0", []string{"1.2.0", "1.2.9"}, []string{"1.3.0", "1.1.9"}},
+		{"~1", []string{"1.0.0", "1.9.9"}, []string{"2.0.0"}},
+		{">=1.0.0 <2.0.0", []string{"1.0.0", "1.99.0"}, []string{"0.9.0", "2.0.0"}},
+		{">= 1.5 <=1.7", []string{"1.5.0", "1.7.9"}, []string{"1.4.9", "1.8.0"}},
+		{">1.2", []string{"1.3.0"}, []string{"1.2.9"}},
+		{"1.x", []string{"1.0.0", "1.5.2"}, []string{"2.0.0"}},
+		{"1.0.0 - 1.4", []string{"1.0.0", "1.4.7"}, []string{"1.5.0"}},
+		{"^1.0.0 || ^3.0.0", []string{"1.1.0", "3.4.0"}, []string{"2.0.0"}},
+		{">=1.1.0-alpha <2.0.0", []string{"1.1.0-beta", "1.5.0"}, []string{"1.2.0-beta"}},
+	}
+	for _, tt := range tests {
+		c, err := parseVersionConstraint(tt.constraint)
+		if err != nil {
+			t.Fatalf("parseVersionConstraint(%q) failed: %v", tt.constraint, err)
+		}
+		for _, raw := range tt.matches {
+			if v, _ := parseSemVersion(raw); !c.Matches(v) {
+				t.Errorf("Expected %q to match %s", tt.constraint, raw)
+			}
+		}
+		for _, raw := range tt.rejects {
+			if v, _ := parseSemVersion(raw); c.Matches(v) {
+				t.Errorf("Expected %q not to match %s", tt.constraint, raw)
+			}
+		}
+	}
+
+	for _, invalid := range []string{"^", ">=abc", "1.2.3 - ", "~1.2.3.4"} {
+		if _, err := parseVersionConstraint(invalid); err == nil {
+			t.Errorf("Expected constraint %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestHighestMatchingVersion(t *testing.T) {
+	available := []string{"1.0.0", "1.4.2", "1.10.0", "2.0.0-rc.1", "2.0.0", "v2.1.0", "abc1234"}
+	tests := []struct {
+		constraint, want string
+		ok               bool
+	}{
+		{"latest", "v2.1.0", true},
+		{"^1.0.0", "1.10.0", true},
+		{"~1.4", "1.4.2", true},
+		{"<2.0.0", "1.10.0", true},
+		{"2.0.0-rc.1", "2.0.0-rc.1", true},
+		{"abc1234", "abc1234", true},
+		{"^3.0.0", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := highestMatchingVersion(tt.constraint, available)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("highestMatchingVersion(%q) = %q, %v, want %q, %v", tt.constraint, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// BuildTarget is a GOOS/GOARCH pair to build for
+type BuildTarget struct {
+	GOOS   string
+	GOARCH string
+}
+
+func (t BuildTarget) String() string {
+	return t.GOOS + "/" + t.GOARCH
+}
+
+// BuildResult records the outcome of building one target
+type BuildResult struct {
+	Target   BuildTarget
+	Output   string
+	Size     int64
+	Duration time.Duration
+	Err      error
+}
+
+// parseBuildTargets parses a comma-separated target list such as
+// "linux/arm64,darwin/arm64,windows/amd64". An entry without an architecture
+// (e.g. "linux") uses $GOARCH or the host architecture, and "current" uses
+// $GOOS/$GOARCH or the host platform.
+func parseBuildTargets(spec string) ([]BuildTarget, error) {
+	var targets []BuildTarget
+	seen := make(map[BuildTarget]bool)
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		target, err := parseBuildTarget(part)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[target] {
+			seen[target] = true
+			targets = append(targets, target)
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no build target specified")
+	}
+
+	return targets, nil
+}
+
+func parseBuildTarget(spec string) (BuildTarget, error) {
+	defaultArch := os.Getenv("GOARCH")
+	if defaultArch == "" {
+		defaultArch = runtime.GOARCH
+	}
+
+	if spec == "current" {
+		goos := os.Getenv("GOOS")
+		if goos == "" {
+			goos = runtime.GOOS
+		}
+		return BuildTarget{GOOS: goos, GOARCH: defaultArch}, nil
+	}
+
+	goos, goarch, hasArch := strings.Cut(spec, "/")
+	if !hasArch {
+		goarch = defaultArch
+	}
+
+	if goos == "" || goarch == "" || strings.Contains(goarch, "/") {
+		return BuildTarget{}, fmt.Errorf("invalid build target %q (expected os or os/arch)", spec)
+	}
+
+	return BuildTarget{GOOS: goos, GOARCH: goarch}, nil
+}
+
+// targetOutputPath returns the absolute executable path for a target. A
+// single-target build writes to outputName; a multi-target build appends
+// -<os>-<arch> so every target gets a predictable, distinct name.
+func targetOutputPath(outputName string, target BuildTarget, multi bool) (string, error) {
+	outputPath, err := filepath.Abs(outputName)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve output path: %w", err)
+	}
+
+	if multi {
+		outputPath = strings.TrimSuffix(outputPath, ".exe") + "-" + target.GOOS + "-" + target.GOARCH
+	}
+	if target.GOOS == "windows" && !strings.HasSuffix(outputPath, ".exe") {
+		outputPath += ".exe"
+	}
+
+	return outputPath, nil
+}
+
+// buildTargets builds every target in parallel and returns the results in
+// target order
+func buildTargets(targets []BuildTarget, outputName string, build func(BuildTarget, string) error) []BuildResult {
+	results := make([]BuildResult, len(targets))
+	multi := len(targets) > 1
+
+	sem := make(chan struct{}, runtime.NumCPU())
+	var wg sync.WaitGroup
+
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target BuildTarget) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			result := BuildResult{Target: target}
+			start := time.Now()
+
+			result.Output, result.Err = targetOutputPath(outputName, target, multi)
+			if result.Err == nil {
+				result.Err = build(target, result.Output)
+			}
+			if result.Err == nil {
+				if info, err := os.Stat(result.Output); err == nil {
+					result.Size = info.Size()
+				}
+			}
+
+			result.Duration = time.Since(start)
+			results[i] = result
+		}(i, target)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// printBuildSummary prints a table of build results
+func printBuildSummary(w io.Writer, results []BuildResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TARGET\tSTATUS\tSIZE\tTIME\tOUTPUT")
+	for _, result := range results {
+		status, size := "ok", formatSize(result.Size)
+		if result.Err != nil {
+			status, size = "failed", "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", result.Target, status, size, result.Duration.Round(time.Millisecond), result.Output)
+	}
+	tw.Flush()
+
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Fprintf(w, "\n%s: %v\n", result.Target, result.Err)
+		}
+	}
+}
+
+// formatSize formats a byte count for display
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestParseBuildTargets(t *testing.T) {
+	t.Setenv("GOOS", "")
+	t.Setenv("GOARCH", "")
+
+	targets, err := parseBuildTargets("linux/arm64, darwin/arm64,windows/amd64,linux/arm64")
+	if err != nil {
+		t.Fatalf("parseBuildTargets failed: %v", err)
+	}
+
+	expected := []BuildTarget{
+		{GOOS: "linux", GOARCH: "arm64"},
+		{GOOS: "darwin", GOARCH: "arm64"},
+		{GOOS: "windows", GOARCH: "amd64"},
+	}
+	if len(targets) != len(expected) {
+		t.Fatalf("Expected %d targets, got %v", len(expected), targets)
+	}
+	for i := range expected {
+		if targets[i] != expected[i] {
+			t.Fatalf("Target %d: expected %s, got %s", i, expected[i], targets[i])
+		}
+	}
+
+	// An OS-only target keeps the host architecture instead of forcing amd64
+	targets, err = parseBuildTargets("linux")
+	if err != nil {
+		t.Fatalf("parseBuildTargets failed: %v", err)
+	}
+	if targets[0].GOARCH != runtime.GOARCH {
+		t.Fatalf("Expected host architecture %s, got %s", runtime.GOARCH, targets[0].GOARCH)
+	}
+
+	t.Setenv("GOARCH", "arm")
+	targets, err = parseBuildTargets("current")
+	if err != nil {
+		t.Fatalf("parseBuildTargets failed: %v", err)
+	}
+	if targets[0] != (BuildTarget{GOOS: runtime.GOOS, GOARCH: "arm"}) {
+		t.Fatalf("Expected current target to honor GOARCH, got %s", targets[0])
+	}
+
+	for _, invalid := range []string{"", "linux/", "/amd64", "linux/arm/v7"} {
+		if _, err := parseBuildTargets(invalid); err == nil {
+			t.Fatalf("Expected error for target %q", invalid)
+		}
+	}
+}
+
+func TestTargetOutputPath(t *testing.T) {
+	linux := BuildTarget{GOOS: "linux", GOARCH: "arm64"}
+	windows := BuildTarget{GOOS: "windows", GOARCH: "amd64"}
+
+	tests := []struct {
+		target   BuildTarget
+		multi    bool
+		expected string
+	}{
+		{linux, false, "app"},
+		{windows, false, "app.exe"},
+		{linux, true, "app-linux-arm64"},
+		{windows, true, "app-windows-amd64.exe"},
+	}
+
+	for _, tt := range tests {
+		got, err := targetOutputPath(filepath.Join("dist", "app"), tt.target, tt.multi)
+		if err != nil {
+			t.Fatalf("targetOutputPath failed: %v", err)
+		}
+		if filepath.Base(got) != tt.expected || !filepath.IsAbs(got) {
+			t.Fatalf("%s (multi=%v): expected .../%s, got %s", tt.target, tt.multi, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// luaModulesDir holds vendored Lua libraries, one directory each
+	luaModulesDir = "lua_modules"
+
+	// lockFileName records the exact revision and content of every
+	// vendored library and the version picked for every plugin
+	lockFileName = "hype.lock"
+)
+
+// LockFile is the hype.lock written by hype add and by plugin loading
+type LockFile struct {
+	Modules []LockedModule `yaml:"modules,omitempty"`
+	Plugins []LockedPlugin `yaml:"plugins,omitempty"`
+}
+
+// LockedModule is a library vendored into lua_modules/<name>
+type LockedModule struct {
+	Name     string `yaml:"name"`
+	Source   string `yaml:"source"`             // Git URL or local path, as given to hype add
+	Version  string `yaml:"version,omitempty"`  // Requested tag, branch or commit
+	Revision string `yaml:"revision,omitempty"` // Commit checked out; empty for plain directories
+	Hash     string `yaml:"hash"`               // Hash of the vendored files, see hashModuleDir
+}
+
+// LockedPlugin is the version picked for a plugin spec. It is reused as
+// long as the spec's name, source and constraint stay the same.
+type LockedPlugin struct {
+	Name       string `yaml:"name"`
+	Source     string `yaml:"source"`
+	Constraint string `yaml:"constraint"`         // Version as requested, e.g. ^1.2.0
+	Version    string `yaml:"version"`            // Version picked
+	Revision   string `yaml:"revision,omitempty"` // Commit of the version, for git sources
+}
+
+// luaSearchPaths returns the module search paths for a project in dir:
+// the configured package.path style templates, then lua_modules/?.lua and
+// lua_modules/?/init.lua, then the root of every vendored library so a
+// library's own files can be required by name
+func luaSearchPaths(dir string, configured []string) []string {
+	var paths []string
+	for _, template := range configured {
+		if !filepath.IsAbs(template) {
+			template = filepath.Join(dir, template)
+		}
+		paths = append(paths, template)
+	}
+
+	modulesDir := filepath.Join(dir, luaModulesDir)
+	paths = append(paths, filepath.Join(modulesDir, "?.lua"), filepath.Join(modulesDir, "?", "init.lua"))
+	entries, _ := os.ReadDir(modulesDir)
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			root := filepath.Join(modulesDir, entry.Name())
+			paths = append(paths, filepath.Join(root, "?.lua"), filepath.Join(root, "?", "init.lua"))
+		}
+	}
+	return paths
+}
+
+// splitSourceVersion splits a source@version argument, as given to hype add
+// and --plugins, into source and version. The
+// version follows the last @ after the final path separator, so
+// git@host:org/lib.git is a source without a version.
+func splitSourceVersion(arg string) (source, version string) {
+	at := strings.LastIndex(arg, "@")
+	if at <= 0 || at < strings.LastIndexAny(arg, "/:") {
+		return arg, ""
+	}
+	return arg[:at], arg[at+1:]
+}
+
+// moduleNameFromSource derives a library name from its source, e.g.
+// inspect from https://github.com/kikito/inspect.lua.git
+func moduleNameFromSource(source string) string {
+	name := strings.TrimRight(filepath.ToSlash(source), "/")
+	if i := strings.LastIndexAny(name, "/:"); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.TrimSuffix(name, ".git")
+	return strings.TrimSuffix(name, ".lua")
+}
+
+// isGitSource reports whether a source is cloned with git rather than
+// copied: URLs, scp-style addresses, *.git paths and local repositories
+func isGitSource(source string) bool {
+	for _, prefix := range []string{"file://", "https://", "http://", "ssh://", "git://", "git@"} {
+		if strings.HasPrefix(source, prefix) {
+			return true
+		}
+	}
+	if strings.HasSuffix(source, ".git") {
+		return true
+	}
+	if _, err := os.Stat(filepath.Join(source, ".git")); err == nil {
+		return true
+	}
+	return false
+}
+
+// loadLockFile reads hype.lock from dir. A missing lock file is empty.
+func loadLockFile(dir string) (*LockFile, error) {
+	data, err := os.ReadFile(filepath.Join(dir, lockFileName))
+	if os.IsNotExist(err) {
+		return &LockFile{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", lockFileName, err)
+	}
+
+	var lock LockFile
+	if err := yaml.UnmarshalStrict(data, &lock); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", lockFileName, err)
+	}
+	return &lock, nil
+}
+
+// save writes the lock file to dir with modules and plugins sorted by name
+func (l *LockFile) save(dir string) error {
+	sort.Slice(l.Modules, func(i, j int) bool { return l.Modules[i].Name < l.Modules[j].Name })
+	sort.SliceStable(l.Plugins, func(i, j int) bool { return l.Plugins[i].Name < l.Plugins[j].Name })
+	data, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	header := "# Generated by hype. Do not edit by hand.\n"
+	return os.WriteFile(filepath.Join(dir, lockFileName), append([]byte(header), data...), 0644)
+}
+
+// set adds a module, replacing one with the same name
+func (l *LockFile) set(module LockedModule) {
+	for i := range l.Modules {
+		if l.Modules[i].Name == module.Name {
+			l.Modules[i] = module
+			return
+		}
+	}
+	l.Modules = append(l.Modules, module)
+}
+
+// setPlugin adds a plugin, replacing one with the same name and source
+func (l *LockFile) setPlugin(plugin LockedPlugin) {
+	for i := range l.Plugins {
+		if l.Plugins[i].Name == plugin.Name && l.Plugins[i].Source == plugin.Source {
+			l.Plugins[i] = plugin
+			return
+		}
+	}
+	l.Plugins = append(l.Plugins, plugin)
+}
+
+// addLuaModule vendors a library into dir/lua_modules/<name> and records it
+// in dir/hype.lock. An empty name is derived from the source.
+func addLuaModule(dir, name, source, version string) (*LockedModule, error) {
+	if name == "" {
+		name = moduleNameFromSource(source)
+	}
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("invalid module name %q; use --name", name)
+	}
+
+	lock, err := loadLockFile(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	module := LockedModule{Name: name, Source: source, Version: version}
+	if err := vendorModule(dir, &module, version); err != nil {
+		return nil, err
+	}
+
+	lock.set(module)
+	if err := lock.save(dir); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", lockFileName, err)
+	}
+	return &module, nil
+}
+
+// restoreLuaModules vendors every module in dir/hype.lock again at its
+// locked revision and checks that the files match the locked hash
+func restoreLuaModules(dir string) ([]LockedModule, error) {
+	lock, err := loadLockFile(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, locked := range lock.Modules {
+		module := locked
+		ref := locked.Revision
+		if ref == "" {
+			ref = locked.Version
+		}
+		if err := vendorModule(dir, &module, ref); err != nil {
+			return nil, err
+		}
+		if module.Hash != locked.Hash {
+			return nil, fmt.Errorf("%s: vendored files do not match %s (got %s, locked %s)", locked.Name, lockFileName, module.Hash, locked.Hash)
+		}
+	}
+	return lock.Modules, nil
+}
+
+// vendorModule fetches module.Source at ref into dir/lua_modules and fills
+// in the revision and hash. The previous copy is only replaced once the new
+// one is complete.
+func vendorModule(dir string, module *LockedModule, ref string) error {
+	modulesDir := filepath.Join(dir, luaModulesDir)
+	if err := os.MkdirAll(modulesDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", luaModulesDir, err)
+	}
+	staging, err := os.MkdirTemp(modulesDir, ".tmp-"+module.Name+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	// Local paths in the lock file are relative to the project
+	source := module.Source
+	if !strings.Contains(source, "://") && !strings.HasPrefix(source, "git@") && !filepath.IsAbs(source) {
+		source = filepath.Join(dir, source)
+	}
+
+	fetched := filepath.Join(staging, "src")
+	if isGitSource(source) {
+		revision, err := cloneGitRevision(source, ref, fetched)
+		if err != nil {
+			return fmt.Errorf("failed to fetch %s: %w", module.Source, err)
+		}
+		module.Revision = revision
+	} else {
+		info, err := os.Stat(source)
+		if err != nil || !info.IsDir() {
+			return fmt.Errorf("%s is not a git repository or directory", module.Source)
+		}
+		if err := copyModuleTree(source, fetched); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", module.Source, err)
+		}
+		module.Revision = ""
+	}
+
+	hash, err := hashModuleDir(fetched)
+	if err != nil {
+		return err
+	}
+	module.Hash = hash
+
+	target := filepath.Join(modulesDir, module.Name)
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+	return os.Rename(fetched, target)
+}
+
+// cloneGitRevision checks out ref (HEAD when empty) of a git repository into
+// dest without its .git directory and returns the commit checked out. url
+// and ref come from hype.yaml or hype.lock, so neither may pass for a git
+// option.
+func cloneGitRevision(url, ref, dest string) (string, error) {
+	if strings.HasPrefix(ref, "-") {
+		return "", fmt.Errorf("invalid version %q", ref)
+	}
+	clone := dest + ".git"
+	if err := runGit("", "clone", "--quiet", "--no-checkout", "--", url, clone); err != nil {
+		return "", err
+	}
+	if ref == "" {
+		ref = "HEAD"
+	}
+	// Branches other than the default one only exist as remote branches
+	if err := runGit(clone, "checkout", "--quiet", "--detach", ref); err != nil {
+		if runGit(clone, "checkout", "--quiet", "--detach", "origin/"+ref) != nil {
+			return "", fmt.Errorf("version %s: %w", ref, err)
+		}
+	}
+	out, err := exec.Command("git", "-C", clone, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "", fmt.Errorf("git rev-parse: %w", err)
+	}
+	if err := copyModuleTree(clone, dest); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// runGit runs a git command, in dir when it is not empty, and includes
+// git's output in the error
+func runGit(dir string, args ...string) error {
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	cmd := exec.Command("git", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git %s: %v\n%s", args[len(args)-1], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// copyModuleTree copies a library's files, leaving out version control
+// directories
+func copyModuleTree(src, dest string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && (d.Name() == ".git" || d.Name() == ".hg") && rel != "." {
+			return filepath.SkipDir
+		}
+		target := filepath.Join(dest, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0644)
+	})
+}
+
+// hashModuleDir hashes the paths and contents of every file in dir, so the
+// hash only changes when the vendored files do
+func hashModuleDir(dir string) (string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hashFiles(dir, files)
+}
+
+// hashFiles hashes the paths relative to dir and the contents of files
+func hashFiles(dir string, files []string) (string, error) {
+	sort.Strings(files)
+
+	hash := sha256.New()
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		content := sha256.Sum256(data)
+		fmt.Fprintf(hash, "%s %s\n", hex.EncodeToString(content[:]), filepath.ToSlash(rel))
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yuin/gopher-lua"
+)
+
+func TestParseAddArg(t *testing.T) {
+	tests := []struct {
+		arg, source, version string
+	}{
+		{"https://github.com/kikito/inspect.lua.git@v3.1.3", "https://github.com/kikito/inspect.lua.git", "v3.1.3"},
+		{"file:///srv/git/lib.git", "file:///srv/git/lib.git", ""},
+		{"git@github.com:org/lib.git", "git@github.com:org/lib.git", ""},
+		{"git@github.com:org/lib.git@main", "git@github.com:org/lib.git", "main"},
+		{"../libs/strings@1.0", "../libs/strings", "1.0"},
+	}
+	for _, tt := range tests {
+		source, version := splitSourceVersion(tt.arg)
+		if source != tt.source || version != tt.version {
+			t.Errorf("splitSourceVersion(%q) = %q, %q, want %q, %q", tt.arg, source, version, tt.source, tt.version)
+		}
+	}
+
+	if name := moduleNameFromSource("https://github.com/kikito/inspect.lua.git"); name != "inspect" {
+		t.Errorf("moduleNameFromSource = %q, want inspect", name)
+	}
+}
+
+func TestAddLuaModuleFromGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	repo := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+	}
+	git("init", "-q")
+	writeLuaFiles(t, repo, map[string]string{
+		"strx/init.lua":      `return {version = require("strx.version")}`,
+		"strx/version.lua":   `return "1.0"`,
+		"spec/strx_spec.lua": `-- not needed at runtime, vendored anyway`,
+	})
+	git("add", "-A")
+	git("commit", "-qm", "v1")
+	git("tag", "v1.0.0")
+	writeLuaFiles(t, repo, map[string]string{"strx/version.lua": `return "2.0"`})
+	git("commit", "-qam", "v2")
+
+	project := t.TempDir()
+	writeLuaFiles(t, project, map[string]string{"main.lua": `result = require("strx").version`})
+	source := "file://" + filepath.ToSlash(repo)
+	module, err := addLuaModule(project, "strx", source, "v1.0.0")
+	if err != nil {
+		t.Fatalf("addLuaModule failed: %v", err)
+	}
+	if len(module.Revision) != 40 || !strings.HasPrefix(module.Hash, "sha256:") {
+		t.Errorf("Expected a commit and hash to be recorded, got %+v", module)
+	}
+	if _, err := os.Stat(filepath.Join(project, "lua_modules", "strx", ".git")); !os.IsNotExist(err) {
+		t.Errorf("Expected .git to be left out of the vendored copy")
+	}
+	if got := runBundled(t, project); got != "1.0" {
+		t.Errorf("result = %q, want 1.0 from v1.0.0", got)
+	}
+
+	// Adding again moves to the new version and keeps one lock entry
+	if _, err := addLuaModule(project, "strx", source, ""); err != nil {
+		t.Fatalf("addLuaModule failed: %v", err)
+	}
+	if got := runBundled(t, project); got != "2.0" {
+		t.Errorf("result = %q, want 2.0 from the default branch", got)
+	}
+	lock, err := loadLockFile(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lock.Modules) != 1 || lock.Modules[0].Revision == module.Revision {
+		t.Fatalf("Expected the lock entry to be updated, got %+v", lock.Modules)
+	}
+
+	// Restoring reproduces the locked files
+	os.RemoveAll(filepath.Join(project, "lua_modules"))
+	if _, err := restoreLuaModules(project); err != nil {
+		t.Fatalf("restoreLuaModules failed: %v", err)
+	}
+	if got := runBundled(t, project); got != "2.0" {
+		t.Errorf("result = %q after restore, want 2.0", got)
+	}
+
+	lock.Modules[0].Hash = "sha256:0000"
+	if err := lock.save(project); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restoreLuaModules(project); err == nil || !strings.Contains(err.Error(), "do not match") {
+		t.Errorf("Expected a hash mismatch error, got %v", err)
+	}
+}
+
+func TestAddLuaModuleFromPath(t *testing.T) {
+	dir := t.TempDir()
+	writeLuaFiles(t, dir, map[string]string{
+		"libs/greet/greet.lua":       `return function(name) return "hi " .. name end`,
+		"app/main.lua":               `result = require("greet")("lua") .. "," .. require("shared.util")`,
+		"app/vendor/shared/util.lua": `return "util"`,
+	})
+	project := filepath.Join(dir, "app")
+
+	module, err := addLuaModule(project, "", "../libs/greet", "")
+	if err != nil {
+		t.Fatalf("addLuaModule failed: %v", err)
+	}
+	if module.Name != "greet" || module.Revision != "" {
+		t.Errorf("Unexpected lock entry %+v", module)
+	}
+
+	// Configured paths are searched as well as lua_modules
+	visited := make(map[string]bool)
+	bundled, err := bundleDependencies(filepath.Join(project, "main.lua"), visited, map[string]bool{}, luaSearchPaths(project, []string{"vendor/?.lua"}))
+	if err != nil {
+		t.Fatalf("bundleDependencies failed: %v", err)
+	}
+	L := lua.NewState()
+	defer L.Close()
+	if err := L.DoString(bundled.Source); err != nil {
+		t.Fatalf("Bundled script failed: %v\n%s", err, bundled.Source)
+	}
+	if got := L.GetGlobal("result").String(); got != "hi lua,util" {
+		t.Errorf("result = %q, want hi lua,util", got)
+	}
+}
+
+// runBundled bundles main.lua in a project with its lua_modules and returns
+// the global result it sets
+func runBundled(t *testing.T, project string) string {
+	t.Helper()
+	bundled, err := bundleDependencies(filepath.Join(project, "main.lua"), make(map[string]bool), map[string]bool{}, luaSearchPaths(project, nil))
+	if err != nil {
+		t.Fatalf("bundleDependencies failed: %v", err)
+	}
+	L := lua.NewState()
+	defer L.Close()
+	if err := L.DoString(bundled.Source); err != nil {
+		t.Fatalf("Bundled script failed: %v\n%s", err, bundled.Source)
+	}
+	return L.GetGlobal("result").String()
+}
+
+func TestCloneGitRevisionRejectsOptions(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	// Without a separator git reads the URL as an option and the clone
+	// target, an existing repository here, as the repository
+	dir := t.TempDir()
+	if output, err := exec.Command("git", "init", "-q", "--bare", filepath.Join(dir, "clone.git")).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, output)
+	}
+	marker := filepath.Join(dir, "pwned")
+	if _, err := cloneGitRevision("--upload-pack=touch "+marker, "", filepath.Join(dir, "clone")); err == nil {
+		t.Errorf("Expected an option passed as the URL to fail")
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Errorf("The URL was passed to git clone as an option")
+	}
+	if _, err := cloneGitRevision(dir, "--orphan=x", filepath.Join(dir, "clone")); err == nil || !strings.Contains(err.Error(), "invalid version") {
+		t.Errorf("Expected an option passed as the version to be refused, got %v", err)
+	}
+}
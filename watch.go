@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"hype/hyperuntime"
+)
+
+// watchPollInterval is how often watched files are checked for changes
+const watchPollInterval = 300 * time.Millisecond
+
+// watchStopGrace is how long a cancelled run gets to return after its
+// servers have been shut down
+const watchStopGrace = 2 * time.Second
+
+// fileState is what a watched file is compared by
+type fileState struct {
+	modTime time.Time
+	size    int64
+	exists  bool
+}
+
+// watchScript runs a script and restarts it whenever the script, a module it
+// requires or a file in a local plugin directory changes. Errors, including
+// syntax errors, are printed and the watcher waits for the next change. It
+// returns on SIGINT or SIGTERM. Once a Go plugin has been loaded, restarts
+// replace the whole process.
+func watchScript(scriptPath string, scriptArgs []string, pluginSpecs []PluginSpec, options RunOptions) error {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		files := watchedFiles(scriptPath, pluginSpecs, options.LuaPaths)
+		snapshot := statFiles(files)
+		fmt.Fprintf(os.Stderr, "[watch] running %s (watching %d files)\n", scriptPath, len(files))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- runScriptContext(ctx, scriptPath, scriptArgs, pluginSpecs, options)
+		}()
+
+		running := true
+		var changed []string
+		for len(changed) == 0 {
+			select {
+			case <-interrupt:
+				cancel()
+				if running {
+					waitForRun(done)
+				}
+				return nil
+
+			case err := <-done:
+				running = false
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "[watch] %v\n", err)
+				} else {
+					fmt.Fprintf(os.Stderr, "[watch] %s finished\n", scriptPath)
+				}
+				fmt.Fprintln(os.Stderr, "[watch] waiting for changes...")
+
+			case <-ticker.C:
+				changed = changedFiles(files, snapshot)
+			}
+		}
+
+		fmt.Fprintf(os.Stderr, "[watch] %s changed, restarting\n", displayPath(changed[0]))
+		cancel()
+		if running {
+			waitForRun(done)
+		}
+		if goPluginsOpened.Load() {
+			return restartProcess()
+		}
+	}
+}
+
+// restartProcess replaces the process with a new run of the same command.
+// Runs that opened a Go plugin restart this way, as the plugin cannot be
+// opened again in the same process.
+func restartProcess() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to restart with Go plugins: %w", err)
+	}
+	if err := syscall.Exec(executable, os.Args, os.Environ()); err != nil {
+		return fmt.Errorf("failed to restart with Go plugins: %w", err)
+	}
+	return nil
+}
+
+// waitForRun waits for a cancelled run to return. A script blocked in a Go
+// call that ignores cancellation is left behind so the watcher can restart.
+func waitForRun(done <-chan error) {
+	select {
+	case <-done:
+	case <-time.After(hyperuntime.ShutdownTimeout + watchStopGrace):
+		fmt.Fprintln(os.Stderr, "[watch] previous run did not stop in time; starting a new one anyway")
+	}
+}
+
+// watchedFiles returns the entry script, every module it requires and the
+// files of local plugins, as absolute paths
+func watchedFiles(scriptPath string, pluginSpecs []PluginSpec, luaPaths []string) []string {
+	availableModules := make(map[string]bool)
+	for _, spec := range pluginSpecs {
+		availableModules[spec.Name] = true
+	}
+
+	// Resolution errors and warnings surface when the script runs; watch
+	// what was found
+	visited := make(map[string]bool)
+	bundleRunDependencies(scriptPath, visited, availableModules, luaPaths)
+	if absPath, err := filepath.Abs(scriptPath); err == nil {
+		visited[absPath] = true
+	}
+
+	for _, spec := range pluginSpecs {
+		if !isLocalPluginSource(spec.Source) {
+			continue
+		}
+		filepath.WalkDir(spec.Source, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if absPath, err := filepath.Abs(path); err == nil {
+				visited[absPath] = true
+			}
+			return nil
+		})
+	}
+
+	files := make([]string, 0, len(visited))
+	for file := range visited {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// statFiles records the current state of files
+func statFiles(files []string) map[string]fileState {
+	states := make(map[string]fileState, len(files))
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			states[file] = fileState{modTime: info.ModTime(), size: info.Size(), exists: true}
+		} else {
+			states[file] = fileState{}
+		}
+	}
+	return states
+}
+
+// changedFiles returns the files whose state differs from the snapshot
+func changedFiles(files []string, snapshot map[string]fileState) []string {
+	var changed []string
+	current := statFiles(files)
+	for _, file := range files {
+		if current[file] != snapshot[file] {
+			changed = append(changed, file)
+		}
+	}
+	return changed
+}
+
+// displayPath shortens an absolute path relative to the working directory
+func displayPath(path string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil {
+			return rel
+		}
+	}
+	return path
+}
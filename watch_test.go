@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatchedFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.lua":                       `local lib = require("lib")` + "\n" + `local greet = require("greet")`,
+		"lib.lua":                        `return require("./util")`,
+		"util.lua":                       `return {}`,
+		"plugins/greet/plugin.lua":       `return {}`,
+		"plugins/greet/hype-plugin.yaml": "name: greet\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	specs := []PluginSpec{{Name: "greet", Source: filepath.Join(dir, "plugins", "greet")}}
+	got := watchedFiles(filepath.Join(dir, "main.lua"), specs, nil)
+
+	want := []string{
+		filepath.Join(dir, "lib.lua"),
+		filepath.Join(dir, "main.lua"),
+		filepath.Join(dir, "plugins", "greet", "hype-plugin.yaml"),
+		filepath.Join(dir, "plugins", "greet", "plugin.lua"),
+		filepath.Join(dir, "util.lua"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("watchedFiles = %v, want %v", got, want)
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "main.lua")
+	missing := filepath.Join(dir, "later.lua")
+	if err := os.WriteFile(script, []byte("print(1)"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files := []string{script, missing}
+	snapshot := statFiles(files)
+	if changed := changedFiles(files, snapshot); len(changed) != 0 {
+		t.Fatalf("Unexpected changes: %v", changed)
+	}
+
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(script, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(missing, []byte("print(2)"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if changed := changedFiles(files, snapshot); !reflect.DeepEqual(changed, files) {
+		t.Errorf("changedFiles = %v, want %v", changed, files)
+	}
+}